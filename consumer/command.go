@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"grpc-in-go/pb"
+	"grpc-in-go/util/logger"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandWaitDelay bounds how long a killed command may keep its output pipes open,
+// e.g. through a grandchild that escaped the process group
+const commandWaitDelay = time.Second
+
+// defaultMaxOutputBytes bounds what a command may write to stdout, and to stderr, when max_output_bytes is not set
+const defaultMaxOutputBytes = 1 << 20
+
+// errOutputLimit stops copying the output of a command past its limit, which closes the pipe on the command
+var errOutputLimit = errors.New("output limit exceeded")
+
+// limitedBuffer keeps the output of a command up to max bytes and refuses the rest, so a runaway command
+// cannot exhaust memory. It wraps rather than embeds bytes.Buffer, whose ReadFrom would bypass the limit.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		b.exceeded = true
+		n, _ := b.buf.Write(p[:b.max-b.buf.Len()])
+		return n, errOutputLimit
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// commandPayload is the JSON document written to a command's stdin
+type commandPayload struct {
+	ID        int32  `json:"id"`
+	Type      int32  `json:"type"`
+	Value     int32  `json:"value"`
+	Namespace string `json:"namespace"`
+}
+
+// newCommandHandler returns a handler that runs an external executable for each task. The task is
+// written to its stdin as JSON; stdout becomes the result and stderr the error if the command fails.
+// The command runs in its own process group, which is killed on timeout or cancellation and once the
+// command exits, and fails once it writes more than max_output_bytes to stdout or stderr.
+func newCommandHandler(config CommandHandler) (taskHandler, error) {
+	path, err := exec.LookPath(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	if config.WorkDir != "" {
+		info, err := os.Stat(config.WorkDir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("work dir %s is not a directory", config.WorkDir)
+		}
+	}
+	timeout := time.Duration(config.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	maxOutput := config.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = defaultMaxOutputBytes
+	}
+	env := allowedEnv(config.EnvAllowlist)
+
+	return func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+		payload, err := json.Marshal(commandPayload{
+			ID:        req.Id,
+			Type:      req.Type,
+			Value:     req.Value,
+			Namespace: req.Namespace,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		stdout := &limitedBuffer{max: maxOutput}
+		stderr := &limitedBuffer{max: maxOutput}
+		cmd := exec.CommandContext(ctx, path, config.Args...)
+		cmd.Dir = config.WorkDir
+		cmd.Env = env
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.WaitDelay = commandWaitDelay
+		setProcessGroup(cmd)
+		cmd.Cancel = func() error {
+			return killProcessGroup(cmd)
+		}
+
+		start := time.Now()
+		err = cmd.Run()
+		// Whatever the command left running, e.g. in the background, does not outlive it
+		if cmd.Process != nil {
+			_ = killProcessGroup(cmd)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("command %s timed out after %s", config.Path, timeout)
+			}
+			return nil, ctxErr
+		}
+		if stdout.exceeded || stderr.exceeded {
+			return nil, fmt.Errorf("command %s wrote more than max_output_bytes (%d bytes) of output", config.Path, maxOutput)
+		}
+		if err != nil {
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				return nil, fmt.Errorf("command %s failed: %w: %s", config.Path, err, message)
+			}
+			return nil, fmt.Errorf("command %s failed: %w", config.Path, err)
+		}
+
+		logger.LogInfo("Command handler finished", &logger.LogContext{
+			"task_id":  req.Id,
+			"command":  config.Path,
+			"duration": time.Since(start),
+		})
+
+		return commandResult(stdout.Bytes())
+	}, nil
+}
+
+// commandResult stores JSON output as is and any other output as a JSON string, since results are JSONB
+func commandResult(stdout []byte) (json.RawMessage, error) {
+	output := bytes.TrimSpace(stdout)
+	if len(output) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	if json.Valid(output) {
+		return output, nil
+	}
+	return json.Marshal(string(output))
+}
+
+// allowedEnv returns the variables of the consumer's environment named in the allowlist;
+// everything else is withheld from commands
+func allowedEnv(allowlist []string) []string {
+	env := []string{}
+	for _, name := range allowlist {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// newCommandHandlers builds the handlers of the configured command task types
+func newCommandHandlers(configs []CommandHandler) (map[int32]taskHandler, error) {
+	handlers := make(map[int32]taskHandler, len(configs))
+	for _, config := range configs {
+		if _, ok := handlers[config.TaskType]; ok {
+			return nil, fmt.Errorf("task type %d has more than one command handler", config.TaskType)
+		}
+		handler, err := newCommandHandler(config)
+		if err != nil {
+			return nil, fmt.Errorf("command handler for task type %d: %w", config.TaskType, err)
+		}
+		handlers[config.TaskType] = handler
+	}
+	return handlers, nil
+}
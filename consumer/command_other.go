@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are not supported
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills only the command itself where process groups are not supported
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
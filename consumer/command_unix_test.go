@@ -0,0 +1,130 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"grpc-in-go/pb"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCommandHandlerResult validates that the task is passed on stdin and stdout becomes the result
+func TestCommandHandlerResult(t *testing.T) {
+	handler, err := newCommandHandler(CommandHandler{TaskType: 1, Path: "cat"})
+	assert.NoError(t, err)
+
+	result, err := handler(context.Background(), &pb.TaskRequest{Id: 3, Type: 1, Value: 42, Namespace: "team-a"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":3,"type":1,"value":42,"namespace":"team-a"}`, string(result))
+
+	handler, err = newCommandHandler(CommandHandler{TaskType: 1, Path: "sh", Args: []string{"-c", "echo plain text"}})
+	assert.NoError(t, err)
+
+	result, err = handler(context.Background(), &pb.TaskRequest{Id: 3})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `"plain text"`, string(result))
+}
+
+// TestCommandHandlerFailure validates that stderr is reported when the command exits non-zero
+func TestCommandHandlerFailure(t *testing.T) {
+	handler, err := newCommandHandler(CommandHandler{TaskType: 1, Path: "sh", Args: []string{"-c", "echo bad input >&2; exit 3"}})
+	assert.NoError(t, err)
+
+	_, err = handler(context.Background(), &pb.TaskRequest{Id: 4})
+	assert.ErrorContains(t, err, "exit status 3")
+	assert.ErrorContains(t, err, "bad input")
+}
+
+// TestCommandHandlerOutputLimit validates that a command writing more than max_output_bytes fails its task
+func TestCommandHandlerOutputLimit(t *testing.T) {
+	handler, err := newCommandHandler(CommandHandler{TaskType: 1, Path: "sh", Args: []string{"-c", "echo 0123456789"}, MaxOutputBytes: 8})
+	assert.NoError(t, err)
+
+	_, err = handler(context.Background(), &pb.TaskRequest{Id: 6})
+	assert.ErrorContains(t, err, "max_output_bytes")
+
+	handler, err = newCommandHandler(CommandHandler{TaskType: 1, Path: "sh", Args: []string{"-c", "yes >&2"}, MaxOutputBytes: 1024})
+	assert.NoError(t, err)
+
+	_, err = handler(context.Background(), &pb.TaskRequest{Id: 6})
+	assert.ErrorContains(t, err, "max_output_bytes")
+}
+
+// TestCommandHandlerTimeoutKillsProcessGroup validates that a timed out command is killed along with its children
+func TestCommandHandlerTimeoutKillsProcessGroup(t *testing.T) {
+	handler, err := newCommandHandler(CommandHandler{
+		TaskType:  1,
+		Path:      "sh",
+		Args:      []string{"-c", "sleep 10 & sleep 10; wait"},
+		TimeoutMs: 100,
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_, err = handler(context.Background(), &pb.TaskRequest{Id: 5})
+	assert.ErrorContains(t, err, "timed out")
+	assert.Less(t, time.Since(start), commandWaitDelay)
+}
+
+// TestCommandHandlerKillsLeftoverChildren validates that children still running when the command exits are killed
+func TestCommandHandlerKillsLeftoverChildren(t *testing.T) {
+	leftover := filepath.Join(t.TempDir(), "leftover")
+	handler, err := newCommandHandler(CommandHandler{
+		TaskType: 1,
+		Path:     "sh",
+		Args:     []string{"-c", `(sleep 0.2; touch "$1") >/dev/null 2>&1 & echo started`, "sh", leftover},
+	})
+	assert.NoError(t, err)
+
+	result, err := handler(context.Background(), &pb.TaskRequest{Id: 7})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `"started"`, string(result))
+
+	time.Sleep(500 * time.Millisecond)
+	assert.NoFileExists(t, leftover)
+}
+
+// TestCommandHandlerEnvAndWorkDir validates that only allowlisted variables reach the command, in its work dir
+func TestCommandHandlerEnvAndWorkDir(t *testing.T) {
+	t.Setenv("HANDLER_ALLOWED", "visible")
+	t.Setenv("HANDLER_SECRET", "hidden")
+	dir := t.TempDir()
+
+	handler, err := newCommandHandler(CommandHandler{
+		TaskType:     1,
+		Path:         "sh",
+		Args:         []string{"-c", `printf '["%s","%s","%s"]' "$HANDLER_ALLOWED" "$HANDLER_SECRET" "$(pwd -P)"`},
+		WorkDir:      dir,
+		EnvAllowlist: []string{"HANDLER_ALLOWED"},
+	})
+	assert.NoError(t, err)
+
+	result, err := handler(context.Background(), &pb.TaskRequest{Id: 6})
+	assert.NoError(t, err)
+
+	var output []string
+	assert.NoError(t, json.Unmarshal(result, &output))
+	assert.Equal(t, "visible", output[0])
+	assert.Empty(t, output[1])
+	assert.Contains(t, output[2], filepath.Base(dir))
+
+	_, err = newCommandHandler(CommandHandler{TaskType: 1, Path: "sh", WorkDir: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+// TestNewCommandHandlers validates that a task type cannot have two command handlers
+func TestNewCommandHandlers(t *testing.T) {
+	handlers, err := newCommandHandlers([]CommandHandler{{TaskType: 1, Path: "cat"}, {TaskType: 2, Path: "cat"}})
+	assert.NoError(t, err)
+	assert.Len(t, handlers, 2)
+
+	_, err = newCommandHandlers([]CommandHandler{{TaskType: 1, Path: "cat"}, {TaskType: 1, Path: "sh"}})
+	assert.Error(t, err)
+
+	_, err = newCommandHandlers([]CommandHandler{{TaskType: 1, Path: "no-such-command-for-tests"}})
+	assert.Error(t, err)
+}
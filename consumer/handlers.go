@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"grpc-in-go/pb"
+	"grpc-in-go/util/logger"
+	"time"
+)
+
+// taskHandler processes a task and returns its result, which is persisted as JSON on completion
+type taskHandler func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error)
+
+// delayResult is the result recorded by simulateDelay
+type delayResult struct {
+	DelayMs int32 `json:"delay_ms"`
+}
+
+// simulateDelay is the default handler: it sleeps for the task value in milliseconds
+func simulateDelay(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+	delayTime := time.Duration(req.Value) * time.Millisecond
+
+	timer := time.NewTimer(delayTime)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	logger.LogInfo("Delaying task", &logger.LogContext{
+		"task_id":    req.Id,
+		"task_type":  req.Type,
+		"task_value": req.Value,
+		"delay":      delayTime,
+	})
+
+	return json.Marshal(delayResult{DelayMs: req.Value})
+}
+
+// handlerFor returns the handler registered for a task type, or the default one
+func (s *server) handlerFor(taskType int32) taskHandler {
+	if handler, ok := s.handlers[taskType]; ok {
+		return handler
+	}
+	return simulateDelay
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"time"
+)
+
+// Dispatch transports
+const (
+	transportGRPC   = "grpc"
+	transportNotify = "notify"
+)
+
+// notifyChannel is the channel the producer's notify transport fires pg_notify on
+const notifyChannel = "tasks"
+
+// defaultTaskLease is how long a consumer owns a task it processes when dispatch.lease_ms is not set
+const defaultTaskLease = 5 * time.Minute
+
+// taskListener consumes tasks on the notify transport: it LISTENs for the producer's notifications,
+// claims "received" tasks with FOR UPDATE SKIP LOCKED and processes them like pushed ones. It also
+// polls, so tasks whose notification was missed, e.g. while this consumer was down, are still claimed.
+// A claimed task is leased to this consumer, and claimed again by any consumer once its lease expires.
+type taskListener struct {
+	server *server
+	// notify is nil when only polling
+	notify       <-chan *pq.Notification
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	// workers bounds the tasks processed at once
+	workers chan struct{}
+}
+
+func newTaskListener(s *server, notify <-chan *pq.Notification, config Dispatch) *taskListener {
+	pollInterval := time.Duration(config.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = 10
+	}
+	return &taskListener{
+		server:       s,
+		notify:       notify,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		lease:        taskLease(config),
+		workers:      make(chan struct{}, workers),
+	}
+}
+
+// taskLease is how long a consumer owns a task it started, after which the task is handed out again
+func taskLease(config Dispatch) time.Duration {
+	lease := time.Duration(config.LeaseMs) * time.Millisecond
+	if lease <= 0 {
+		return defaultTaskLease
+	}
+	return lease
+}
+
+// listen connects a pq listener to the notify channel, logging connection events
+func listen(dbSource string) (*pq.Listener, error) {
+	listener := pq.NewListener(dbSource, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			logger.LogError("Task notifications disconnected, polling until reconnected", err, &logger.LogContext{})
+		case pq.ListenerEventReconnected:
+			logger.LogInfo("Task notifications reconnected", &logger.LogContext{})
+		case pq.ListenerEventConnectionAttemptFailed:
+			logger.LogError("Failed to connect for task notifications", err, &logger.LogContext{})
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// run claims tasks whenever a notification arrives or the poll interval passes
+func (l *taskListener) run() {
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification := <-l.notify:
+			// pq sends nil after a reconnect, when notifications may have been missed; the claim below picks those tasks up
+			if notification == nil {
+				logger.LogWarn("Task notifications may have been missed, claiming received tasks", &logger.LogContext{})
+			}
+		case <-ticker.C:
+		}
+
+		l.skipQueuedNotifications()
+		l.claim(context.Background())
+	}
+}
+
+// skipQueuedNotifications drops the notifications that arrived meanwhile, whose tasks the next claim picks up anyway
+func (l *taskListener) skipQueuedNotifications() {
+	for {
+		select {
+		case <-l.notify:
+		default:
+			return
+		}
+	}
+}
+
+// claim claims tasks and hands them to the workers until none are left. Claimed tasks are admitted like
+// pushed ones: nothing is claimed while the breaker is open, and a free worker, a slot under the
+// concurrency limit and a rate limit token are taken for every task before it is claimed, so claimed
+// tasks never wait out their lease.
+func (l *taskListener) claim(ctx context.Context) {
+	for {
+		held := l.acquireWorkers()
+		if l.server.breakerOpen() {
+			l.releaseWorkers(held)
+			return
+		}
+		held = l.admit(held)
+		// The concurrency limit is reached; the tasks are claimed on a later notification or poll
+		if held == 0 {
+			return
+		}
+		namespaces, err := l.server.queries.PeekClaimableTasks(ctx, int32(held))
+		if err != nil {
+			l.release(held)
+			logger.LogError("Failed to look for claimable tasks", err, &logger.LogContext{})
+			return
+		}
+		if len(namespaces) == 0 {
+			l.release(held)
+			return
+		}
+
+		// Claim the next tasks of one namespace, once its rate limiter lets every one of them through
+		namespace := namespaces[0]
+		count := 1
+		for count < len(namespaces) && namespaces[count] == namespace {
+			count++
+		}
+		for i := 0; i < count; i++ {
+			if err := l.server.waitForRate(ctx, namespace); err != nil {
+				logger.LogError("Rate limiter failed", err, &logger.LogContext{
+					"namespace": namespace,
+				})
+			}
+		}
+
+		tasks, err := l.server.queries.ClaimTasks(ctx, persistence.ClaimTasksParams{
+			LeaseExpiry: sql.NullTime{Time: time.Now().Add(l.lease), Valid: true},
+			Namespace:   namespace,
+			Limit:       int32(count),
+		})
+		if err != nil {
+			l.release(held)
+			logger.LogError("Failed to claim tasks", err, &logger.LogContext{
+				"namespace": namespace,
+				"count":     count,
+			})
+			return
+		}
+
+		l.release(held - len(tasks))
+		for _, task := range tasks {
+			go func(task persistence.Task) {
+				defer func() { <-l.workers }()
+				l.process(ctx, task)
+			}(task)
+		}
+		// Another consumer claimed the tasks first; wait for the next notification or poll
+		if len(tasks) == 0 {
+			return
+		}
+	}
+}
+
+// acquireWorkers waits for a free worker, then takes every other free one, up to the batch size
+func (l *taskListener) acquireWorkers() int {
+	l.workers <- struct{}{}
+	held := 1
+	for held < l.batchSize {
+		select {
+		case l.workers <- struct{}{}:
+			held++
+		default:
+			return held
+		}
+	}
+	return held
+}
+
+// admit takes a slot under the concurrency limit for as many of the held workers as it can, and frees the
+// workers left without one. It returns how many workers are admitted.
+func (l *taskListener) admit(held int) int {
+	if l.server.concurrency == nil {
+		return held
+	}
+	admitted := 0
+	for admitted < held && l.server.concurrency.Acquire() {
+		admitted++
+	}
+	l.releaseWorkers(held - admitted)
+	return admitted
+}
+
+// release frees n admitted workers, with their concurrency slots, for tasks that were not claimed
+func (l *taskListener) release(n int) {
+	l.releaseWorkers(n)
+	if l.server.concurrency != nil {
+		for i := 0; i < n; i++ {
+			l.server.concurrency.Cancel()
+		}
+	}
+}
+
+// releaseWorkers frees n workers taken by acquireWorkers
+func (l *taskListener) releaseWorkers(n int) {
+	for i := 0; i < n; i++ {
+		<-l.workers
+	}
+}
+
+// process runs a claimed task, whose worker, concurrency slot and rate limit token are already taken
+func (l *taskListener) process(ctx context.Context, task persistence.Task) {
+	req := &pb.TaskRequest{
+		Id:        task.ID,
+		Type:      task.Type.Int32,
+		Value:     task.Value.Int32,
+		Namespace: task.Namespace,
+	}
+
+	logger.LogInfo("Processing claimed task", &logger.LogContext{
+		"task_id":    req.Id,
+		"namespace":  req.Namespace,
+		"task_type":  req.Type,
+		"task_value": req.Value,
+	})
+
+	// The claimed row carries the lease as stored, which the task is completed or failed with
+	_, err := l.server.execute(func() (*pb.TaskResponse, error) {
+		return l.server.runTask(ctx, req, task.CreationTime, task.LeaseExpiry)
+	})
+	if err != nil {
+		logger.LogError("Failed to process claimed task", err, &logger.LogContext{
+			"task_id":   req.Id,
+			"namespace": req.Namespace,
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"grpc-in-go/pb"
+	"grpc-in-go/util/limiter"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drainWindow is how often the drain rate is measured, and drainSmoothing how much each measurement weighs
+const (
+	drainWindow    = time.Second
+	drainSmoothing = 0.5
+)
+
+// loadTracker counts the requests the consumer is holding, to report them to the producer as load hints
+type loadTracker struct {
+	queued   atomic.Int32
+	inFlight atomic.Int32
+
+	rateLimiter RateLimiter
+	// maxQueueDepth is the queue length above which the consumer reports itself overloaded
+	maxQueueDepth int32
+	// drain measures how fast the consumer finishes the tasks it is sent
+	drain drainMeter
+}
+
+func newLoadTracker(rateLimiter RateLimiter, config LoadHints) *loadTracker {
+	maxQueueDepth := config.MaxQueueDepth
+	if maxQueueDepth <= 0 {
+		maxQueueDepth = 10
+	}
+	return &loadTracker{rateLimiter: rateLimiter, maxQueueDepth: int32(maxQueueDepth)}
+}
+
+// finished records a task the consumer is done with, whatever its outcome
+func (l *loadTracker) finished() {
+	l.drain.mark(time.Now())
+}
+
+// hint describes the current load for a request of the namespace. concurrency is nil
+// unless the adaptive limiter is enabled.
+func (l *loadTracker) hint(namespace string, concurrency *limiter.Adaptive) *pb.LoadHint {
+	hint := &pb.LoadHint{
+		QueueDepth: l.queued.Load(),
+		InFlight:   l.inFlight.Load(),
+	}
+	hint.SuggestedRate = l.suggestedRate(namespace, hint.QueueDepth, time.Now())
+	hint.Overloaded = hint.QueueDepth > l.maxQueueDepth ||
+		(concurrency != nil && concurrency.InFlight() >= concurrency.Limit())
+
+	taskQueueDepth.Set(float64(hint.QueueDepth))
+	suggestedRate.With(prometheus.Labels{"namespace": namespace}).Set(hint.SuggestedRate)
+	return hint
+}
+
+// suggestedRate is the rate this consumer keeps up with. Without a queue the consumer is not the
+// bottleneck, and its share of the namespace's rate limit is suggested. Once requests queue up, the
+// measured drain rate is suggested instead, scaled down by the queue so that the queue shrinks:
+// a queue of max_queue_depth halves it.
+func (l *loadTracker) suggestedRate(namespace string, queued int32, now time.Time) float64 {
+	ceiling, _ := namespaceRate(l.rateLimiter, namespace)
+	// In shared mode tasks_per_second is the budget of every replica together
+	if l.rateLimiter.Mode == "shared" && l.rateLimiter.Replicas > 1 {
+		ceiling /= float64(l.rateLimiter.Replicas)
+	}
+	if queued <= 0 {
+		return ceiling
+	}
+
+	rate := ceiling
+	if drained := l.drain.rate(now); drained > 0 {
+		rate = math.Min(drained, ceiling)
+	}
+	return rate * float64(l.maxQueueDepth) / float64(l.maxQueueDepth+queued)
+}
+
+// drainMeter measures a rate of events per second, smoothed across windows of drainWindow
+type drainMeter struct {
+	mu sync.Mutex
+	// start is when the current window began, and count the events in it so far
+	start time.Time
+	count int
+	// perSecond is the smoothed rate of the windows that ended; 0 until the first one has
+	perSecond float64
+}
+
+// mark records an event at now
+func (m *drainMeter) mark(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.roll(now)
+	m.count++
+}
+
+// rate returns the rate as of now
+func (m *drainMeter) rate(now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.roll(now)
+	return m.perSecond
+}
+
+// roll folds the current window into the rate once it has lasted drainWindow; the caller holds m.mu
+func (m *drainMeter) roll(now time.Time) {
+	if m.start.IsZero() {
+		m.start = now
+		return
+	}
+	elapsed := now.Sub(m.start)
+	if elapsed < drainWindow {
+		return
+	}
+
+	measured := float64(m.count) / elapsed.Seconds()
+	if m.perSecond == 0 {
+		m.perSecond = measured
+	} else {
+		m.perSecond = drainSmoothing*measured + (1-drainSmoothing)*m.perSecond
+	}
+	m.start = now
+	m.count = 0
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,15 +12,21 @@ import (
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"grpc-in-go/pb"
 	"grpc-in-go/persistence"
 	"grpc-in-go/util"
+	"grpc-in-go/util/breaker"
+	"grpc-in-go/util/limiter"
 	"grpc-in-go/util/logger"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"net/url"
 	"os"
-	"sync"
+	"strconv"
 	"time"
 )
 
@@ -37,52 +45,128 @@ var (
 			Name: "tasks_by_type_total",
 			Help: "Total number of tasks processed by task type",
 		},
-		[]string{"task_type"},
-	)
-	taskValuesByType = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "task_values_by_type_total",
-			Help: "Total sum of task values processed by task type",
-		},
-		[]string{"task_type"},
+		[]string{"namespace", "task_type"},
 	)
 	tasksInProcessing = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "tasks_in_processing",
 		Help: "Number of tasks currently being processed by the consumer",
 	})
+	tasksRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tasks_rejected_total",
+		Help: "Total number of tasks rejected because the adaptive concurrency limit was reached",
+	})
+	concurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_concurrency_limit",
+		Help: "Current concurrency limit set by the adaptive limiter",
+	})
+	dbCircuitBreakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_circuit_breaker_state",
+		Help: "State of the database circuit breaker: 0 closed, 1 half-open, 2 open",
+	})
+	taskQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_consumer_queue_depth",
+		Help: "Number of requests waiting for the rate limiter, as last reported to the producer",
+	})
+	suggestedRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "task_consumer_suggested_rate",
+			Help: "Tasks per second the consumer suggests to the producer, per namespace",
+		},
+		[]string{"namespace"},
+	)
+	rateLimiterFallback = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "rate_limiter_fallback_active",
+		Help: "Whether the shared rate limiter has fallen back to a local limiter (1) or not (0)",
+	})
+	taskQueueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_queue_wait_seconds",
+			Help:    "Time between task creation and the start of processing",
+			Buckets: taskLatencyBuckets,
+		},
+		[]string{"namespace", "task_type", "outcome"},
+	)
+	taskProcessingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_processing_duration_seconds",
+			Help:    "Time between the start of processing and the task being marked done",
+			Buckets: taskLatencyBuckets,
+		},
+		[]string{"namespace", "task_type", "outcome"},
+	)
+	taskEndToEndLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_end_to_end_latency_seconds",
+			Help:    "Time between task creation and the task being marked done",
+			Buckets: taskLatencyBuckets,
+		},
+		[]string{"namespace", "task_type", "outcome"},
+	)
 )
 
-// Map to store the total sum of task values by type
-var (
-	taskTypeSums   = make(map[int32]float64)
-	taskTypeSumsMu sync.Mutex // Mutex for thread-safe access to the map
-)
+// taskLatencyBuckets spans 1ms to ~32s, covering both the simulated delays and queueing under backlog
+var taskLatencyBuckets = prometheus.ExponentialBuckets(0.001, 2, 16)
 
 func init() {
 	// Register the Prometheus metrics
 	prometheus.MustRegister(tasksProcessed)
 	prometheus.MustRegister(taskProcessingFailures)
 	prometheus.MustRegister(tasksByType)
-	prometheus.MustRegister(taskValuesByType)
 	prometheus.MustRegister(tasksInProcessing)
+	prometheus.MustRegister(tasksRejected)
+	prometheus.MustRegister(concurrencyLimit)
+	prometheus.MustRegister(rateLimiterFallback)
+	prometheus.MustRegister(taskQueueDepth)
+	prometheus.MustRegister(suggestedRate)
+	prometheus.MustRegister(dbCircuitBreakerState)
+	prometheus.MustRegister(taskQueueWait)
+	prometheus.MustRegister(taskProcessingDuration)
+	prometheus.MustRegister(taskEndToEndLatency)
+}
+
+// taskLimiter paces task processing; satisfied by both *rate.Limiter and *limiter.Shared
+type taskLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// txBeginner starts the transactions that span several queries; satisfied by *sql.DB and *breaker.DB
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
 type server struct {
 	pb.UnimplementedTaskServiceServer
-	limiter *rate.Limiter
-	queries *persistence.Queries
+	limiters    *namespaceLimiters
+	concurrency *limiter.Adaptive // nil unless the adaptive limiter is enabled
+	breaker     *breaker.Breaker  // nil when DB calls are not guarded by a circuit breaker
+	db          txBeginner
+	queries     *persistence.Queries  // nil on the sqlite driver, which only has the task lifecycle
+	store       persistence.TaskStore // the task lifecycle; queries serves the rest
+	handlers    map[int32]taskHandler // per-type handlers; types without one use simulateDelay
+	load        *loadTracker          // nil when no load hints are returned
+	lease       time.Duration         // how long a started task belongs to this consumer; defaultTaskLease when 0
+	dryRuns     bool                  // whether requests marked as dry runs are answered without the database
 }
 
 // Config struct to hold configuration values
 type Config struct {
-	Database    Database          `mapstructure:"database"`
-	Consumer    Consumer          `mapstructure:"consumer"`
-	Prometheus  Prometheus        `mapstructure:"prometheus"`
-	Logger      *logger.LogConfig `mapstructure:"logger"`
-	RateLimiter RateLimiter       `mapstructure:"rate_limiter"`
+	Database        Database          `mapstructure:"database"`
+	Consumer        Consumer          `mapstructure:"consumer"`
+	Prometheus      Prometheus        `mapstructure:"prometheus"`
+	Logger          *logger.LogConfig `mapstructure:"logger"`
+	RateLimiter     RateLimiter       `mapstructure:"rate_limiter"`
+	AdaptiveLimiter AdaptiveLimiter   `mapstructure:"adaptive_limiter"`
+	CircuitBreaker  CircuitBreaker    `mapstructure:"circuit_breaker"`
+	CommandHandlers []CommandHandler  `mapstructure:"command_handlers"`
+	LoadHints       LoadHints         `mapstructure:"load_hints"`
+	Dispatch        Dispatch          `mapstructure:"dispatch"`
+	DryRun          DryRun            `mapstructure:"dry_run"`
 }
 
 type Database struct {
+	// Driver is "postgres" (default) or "sqlite", which keeps the tasks in the file at Path
+	Driver   string `mapstructure:"driver"`
+	Path     string `mapstructure:"path"`
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	User     string `mapstructure:"user"`
@@ -103,6 +187,72 @@ type Prometheus struct {
 
 type RateLimiter struct {
 	TasksPerSecond float64 `mapstructure:"tasks_per_second"`
+	Burst          int     `mapstructure:"burst"`
+	// Mode is "local" (per replica) or "shared" (one budget across replicas, stored in Postgres)
+	Mode string `mapstructure:"mode"`
+	Name string `mapstructure:"name"`
+	// Replicas is how many consumers share the budget in shared mode; each falls back to its share while the DB is down
+	Replicas int `mapstructure:"replicas"`
+	// Namespaces gives individual namespaces a limiter of their own; the others share the default namespace's
+	Namespaces map[string]NamespaceRateLimit `mapstructure:"namespaces"`
+}
+
+type NamespaceRateLimit struct {
+	TasksPerSecond float64 `mapstructure:"tasks_per_second"`
+	Burst          int     `mapstructure:"burst"`
+}
+
+type Dispatch struct {
+	// Transport is "grpc" (default), serving the tasks the producer pushes, or "notify", which also
+	// LISTENs for the producer's notifications and claims tasks from the database
+	Transport string `mapstructure:"transport"`
+	// PollIntervalMs is how often received tasks are claimed when no notification arrives
+	PollIntervalMs int `mapstructure:"poll_interval_ms"`
+	// BatchSize bounds the tasks claimed at once, which are never more than the free workers
+	BatchSize int `mapstructure:"batch_size"`
+	// Workers bounds the claimed tasks processed at once
+	Workers int `mapstructure:"workers"`
+	// LeaseMs is how long a consumer owns a task it started or claimed; it should exceed the longest task
+	LeaseMs int `mapstructure:"lease_ms"`
+}
+
+type LoadHints struct {
+	// MaxQueueDepth is the number of requests waiting for the rate limiter above which responses report overload
+	MaxQueueDepth int `mapstructure:"max_queue_depth"`
+}
+
+type DryRun struct {
+	// Allow answers the requests a producer dry run marks with the x-dry-run header without touching the
+	// database. Any client can set the header, so it is rejected unless allowed.
+	Allow bool `mapstructure:"allow"`
+}
+
+type CircuitBreaker struct {
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	CooldownMs       int `mapstructure:"cooldown_ms"`
+}
+
+// CommandHandler maps a task type to an external executable run for each task of that type
+type CommandHandler struct {
+	TaskType  int32    `mapstructure:"task_type"`
+	Path      string   `mapstructure:"path"`
+	Args      []string `mapstructure:"args"`
+	TimeoutMs int      `mapstructure:"timeout_ms"`
+	WorkDir   string   `mapstructure:"work_dir"`
+	// EnvAllowlist names the consumer environment variables passed on to the command; all others are withheld
+	EnvAllowlist []string `mapstructure:"env_allowlist"`
+	// MaxOutputBytes bounds stdout and stderr each; a command writing more fails its task
+	MaxOutputBytes int `mapstructure:"max_output_bytes"`
+}
+
+type AdaptiveLimiter struct {
+	Enabled         bool    `mapstructure:"enabled"`
+	Algorithm       string  `mapstructure:"algorithm"`
+	InitialLimit    int     `mapstructure:"initial_limit"`
+	MinLimit        int     `mapstructure:"min_limit"`
+	MaxLimit        int     `mapstructure:"max_limit"`
+	TargetLatencyMs int     `mapstructure:"target_latency_ms"`
+	BackoffRatio    float64 `mapstructure:"backoff_ratio"`
 }
 
 var version string
@@ -184,20 +334,31 @@ func main() {
 	}()
 
 	// Set up DB connection
-	dbSource := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+	// The application_name identifies this instance as the actor of the task transitions it makes
+	dbSource := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s&application_name=%s",
 		config.Database.User,
 		config.Database.Password,
 		config.Database.Host,
 		config.Database.Port,
 		config.Database.DbName,
 		config.Database.SslMode,
+		url.QueryEscape(util.InstanceName("consumer")),
 	)
-	db, err := sql.Open("postgres", dbSource)
+	var db *sql.DB
+	switch config.Database.Driver {
+	case "", persistence.DriverPostgres:
+		db, err = sql.Open("postgres", dbSource)
+	case persistence.DriverSQLite:
+		db, err = persistence.OpenSQLite(config.Database.Path)
+	default:
+		err = fmt.Errorf("unknown database driver %q", config.Database.Driver)
+	}
 	if err != nil {
 		logger.LogError("Failed to connect to the database", err, &logger.LogContext{
-			"host": config.Database.Host,
-			"port": config.Database.Port,
-			"db":   config.Database.DbName,
+			"driver": config.Database.Driver,
+			"host":   config.Database.Host,
+			"port":   config.Database.Port,
+			"db":     config.Database.DbName,
 		})
 		return
 	}
@@ -208,18 +369,98 @@ func main() {
 		}
 	}(db)
 
-	// Initialize sqlc queries struct
-	queries := persistence.New(db)
+	// Guard every DB call with a circuit breaker so an unavailable database fails fast
+	dbBreaker := newDBBreaker(config.CircuitBreaker)
+	guardedDB := breaker.NewDB(db, dbBreaker)
+
+	// Initialize sqlc queries struct; SQLite only backs the task lifecycle
+	var queries *persistence.Queries
+	var store persistence.TaskStore
+	if config.Database.Driver == persistence.DriverSQLite {
+		if config.RateLimiter.Mode == "shared" || config.Dispatch.Transport == transportNotify {
+			logger.LogError("Failed to configure the sqlite driver", fmt.Errorf("the shared rate limiter and the notify transport need the %s driver", persistence.DriverPostgres), &logger.LogContext{})
+			return
+		}
+		store = persistence.NewSQLiteStore(guardedDB)
+		logger.LogInfo("Using SQLite database", &logger.LogContext{
+			"path": config.Database.Path,
+		})
+	} else {
+		queries = persistence.New(guardedDB)
+		store = persistence.NewPostgresStore(guardedDB)
+	}
+
+	// Create a rate limiter per configured namespace: allows consumptions of tasks per second as set in config
+	namespaces := make([]string, 0, len(config.RateLimiter.Namespaces))
+	for namespace := range config.RateLimiter.Namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	limiters, err := newNamespaceLimiters(namespaces, func(namespace string) (taskLimiter, error) {
+		return newTaskLimiter(config.RateLimiter, namespace, queries)
+	})
+	if err != nil {
+		logger.LogError("Failed to set up rate limiters", err, &logger.LogContext{})
+		return
+	}
+	taskServer := &server{
+		limiters: limiters,
+		breaker:  dbBreaker,
+		db:       guardedDB,
+		queries:  queries, // Inject queries into the server
+		store:    store,
+		load:     newLoadTracker(config.RateLimiter, config.LoadHints),
+		lease:    taskLease(config.Dispatch),
+		dryRuns:  config.DryRun.Allow,
+	}
+
+	// Run the configured task types through external commands instead of the built-in handler
+	handlers, err := newCommandHandlers(config.CommandHandlers)
+	if err != nil {
+		logger.LogError("Failed to set up command handlers", err, &logger.LogContext{})
+		return
+	}
+	taskServer.handlers = handlers
+	for _, handler := range config.CommandHandlers {
+		logger.LogInfo("Command handler registered", &logger.LogContext{
+			"task_type": handler.TaskType,
+			"command":   handler.Path,
+		})
+	}
 
-	// Create a rate limiter: allows consumptions of tasks per second as set in config
-	limiter := rate.NewLimiter(rate.Limit(config.RateLimiter.TasksPerSecond), 1)
+	// Optionally bound concurrency by a limit that adapts to observed processing and DB latency
+	if config.AdaptiveLimiter.Enabled {
+		taskServer.concurrency = newAdaptiveLimiter(config.AdaptiveLimiter)
+		logger.LogInfo("Adaptive concurrency limiter enabled", &logger.LogContext{
+			"algorithm":     config.AdaptiveLimiter.Algorithm,
+			"initial_limit": taskServer.concurrency.Limit(),
+		})
+	}
+
+	// On the notify transport, claim tasks from the database instead of waiting for the producer to push them
+	switch config.Dispatch.Transport {
+	case "", transportGRPC:
+	case transportNotify:
+		listener, err := listen(dbSource)
+		if err != nil {
+			logger.LogError("Failed to listen for task notifications", err, &logger.LogContext{
+				"channel": notifyChannel,
+			})
+			return
+		}
+		defer listener.Close()
+
+		go newTaskListener(taskServer, listener.Notify, config.Dispatch).run()
+		logger.LogInfo("Claiming tasks on notification", &logger.LogContext{
+			"channel": notifyChannel,
+		})
+	default:
+		logger.LogError("Failed to select dispatch transport", fmt.Errorf("unknown transport %q", config.Dispatch.Transport), &logger.LogContext{})
+		return
+	}
 
 	// Initialize gRPC server
 	grpcServer := grpc.NewServer()
-	pb.RegisterTaskServiceServer(grpcServer, &server{
-		limiter: limiter,
-		queries: queries, // Inject queries into the server
-	})
+	pb.RegisterTaskServiceServer(grpcServer, taskServer)
 
 	logger.LogInfo("Consumer service listening", &logger.LogContext{
 		"grpc_port": config.Consumer.GrpcPort,
@@ -233,84 +474,601 @@ func main() {
 	}
 }
 
+// namespaceRate returns the tasks per second and burst of a namespace, applying its override if any
+func namespaceRate(config RateLimiter, namespace string) (float64, int) {
+	tasksPerSecond := config.TasksPerSecond
+	burst := config.Burst
+	if override, ok := config.Namespaces[namespace]; ok {
+		tasksPerSecond = override.TasksPerSecond
+		burst = override.Burst
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return tasksPerSecond, burst
+}
+
+// newTaskLimiter creates the configured rate limiter of a namespace. In "shared" mode the budget is split across every
+// consumer replica through a token bucket in Postgres, falling back to a local limiter if the DB is unavailable.
+func newTaskLimiter(config RateLimiter, namespace string, queries *persistence.Queries) (taskLimiter, error) {
+	tasksPerSecond, burst := namespaceRate(config, namespace)
+
+	if config.Mode != "shared" {
+		if tasksPerSecond <= 0 {
+			return nil, fmt.Errorf("tasks_per_second must be positive, got %v", tasksPerSecond)
+		}
+		return rate.NewLimiter(rate.Limit(tasksPerSecond), burst), nil
+	}
+
+	name := config.Name
+	if name == "" {
+		name = "consumer"
+	}
+	// The default namespace keeps the bucket it used before namespaces existed
+	if namespace != defaultNamespace {
+		name = name + ":" + namespace
+	}
+	logger.LogInfo("Using shared rate limiter", &logger.LogContext{
+		"name":             name,
+		"namespace":        namespace,
+		"tasks_per_second": tasksPerSecond,
+	})
+
+	return limiter.NewShared(context.Background(), queries, limiter.SharedOptions{
+		Name:           name,
+		TasksPerSecond: tasksPerSecond,
+		Burst:          burst,
+		Replicas:       config.Replicas,
+		OnFallback: func(active bool) {
+			if active {
+				rateLimiterFallback.Set(1)
+			} else {
+				rateLimiterFallback.Set(0)
+			}
+		},
+	})
+}
+
+// newDBBreaker creates the circuit breaker guarding DB calls, exporting and logging its transitions
+func newDBBreaker(config CircuitBreaker) *breaker.Breaker {
+	return breaker.New(breaker.Options{
+		FailureThreshold: config.FailureThreshold,
+		Cooldown:         time.Duration(config.CooldownMs) * time.Millisecond,
+		OnStateChange: func(from breaker.State, to breaker.State) {
+			dbCircuitBreakerState.Set(float64(to))
+			logger.LogWarn("Database circuit breaker state changed", &logger.LogContext{
+				"from": from.String(),
+				"to":   to.String(),
+			})
+		},
+	})
+}
+
+func newAdaptiveLimiter(config AdaptiveLimiter) *limiter.Adaptive {
+	return limiter.NewAdaptive(limiter.AdaptiveOptions{
+		Algorithm:     limiter.Algorithm(config.Algorithm),
+		InitialLimit:  config.InitialLimit,
+		MinLimit:      config.MinLimit,
+		MaxLimit:      config.MaxLimit,
+		TargetLatency: time.Duration(config.TargetLatencyMs) * time.Millisecond,
+		BackoffRatio:  config.BackoffRatio,
+		OnLimitChange: func(limit int) {
+			concurrencyLimit.Set(float64(limit))
+		},
+	})
+}
+
+// dryRunMetadataKey marks the requests of a producer dry run, whose tasks are not in the database
+const dryRunMetadataKey = "x-dry-run"
+
+// isDryRun reports whether a request comes from a producer dry run
+func isDryRun(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(dryRunMetadataKey)
+	return len(values) > 0 && values[0] == "true"
+}
+
 func (s *server) SendTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
-	rateLimitError := s.limiter.Wait(ctx)
+	// Dry-run tasks were never stored, so they go through the limiters but never touch the database.
+	// Their IDs may be those of stored tasks, so they are refused rather than processed when not allowed.
+	dryRun := isDryRun(ctx)
+	if dryRun && !s.dryRuns {
+		taskProcessingFailures.Inc()
+		return nil, status.Error(codes.PermissionDenied, "dry runs are not allowed by this consumer")
+	}
+
+	// Refuse work outright while the database is known to be unavailable
+	if !dryRun && s.breakerOpen() {
+		taskProcessingFailures.Inc()
+		return nil, status.Errorf(codes.Unavailable, "database unavailable, retry in %s", s.breaker.RetryAfter())
+	}
+
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		taskProcessingFailures.Inc()
+		return nil, err
+	}
+	req.Namespace = namespace
+
+	// Tasks that are not due yet are scheduled for later rather than processed now
+	if runAt := req.GetRunAt(); !dryRun && runAt != nil && runAt.AsTime().After(time.Now()) {
+		return s.deferTask(ctx, req)
+	}
+
+	// Shed excess work up front rather than queueing it behind the rate limiter
+	if s.concurrency != nil && !s.concurrency.Acquire() {
+		tasksRejected.Inc()
+		logger.LogWarn("Concurrency limit reached, rejecting task", &logger.LogContext{
+			"task_id":   req.Id,
+			"namespace": req.Namespace,
+			"limit":     s.concurrency.Limit(),
+		})
+		return nil, status.Errorf(codes.ResourceExhausted, "concurrency limit of %d reached", s.concurrency.Limit())
+	}
+
+	rateLimitError := s.waitForRate(ctx, req.Namespace)
 	if rateLimitError != nil {
-		logger.LogError("Rate limiter failed", rateLimitError, &logger.LogContext{})
+		logger.LogError("Rate limiter failed", rateLimitError, &logger.LogContext{
+			"namespace": req.Namespace,
+		})
 	} else {
 		logger.LogInfo("Processing task ....", &logger.LogContext{
 			"task_id":    req.Id,
+			"namespace":  req.Namespace,
 			"task_type":  req.Type,
 			"task_value": req.Value,
 		})
 	}
 
+	res, err := s.execute(func() (*pb.TaskResponse, error) {
+		if dryRun {
+			return &pb.TaskResponse{Status: "Dry run", Result: fmt.Sprintf("dry run: task %d not processed", req.Id)}, nil
+		}
+		return s.processTask(ctx, req)
+	})
+	if err != nil {
+		return nil, s.dbError(err)
+	}
+
+	// Tell the producer how loaded this consumer is, so it can adapt its rate
+	if s.load != nil {
+		res.Load = s.load.hint(req.Namespace, s.concurrency)
+	}
+
+	return res, nil
+}
+
+// breakerOpen reports whether the database is known to be unavailable, so no work should be taken on
+func (s *server) breakerOpen() bool {
+	return s.breaker != nil && s.breaker.State() == breaker.Open
+}
+
+// waitForRate waits for the rate limiter of the namespace, counting the wait as queued load
+func (s *server) waitForRate(ctx context.Context, namespace string) error {
+	if s.load != nil {
+		s.load.queued.Add(1)
+		defer s.load.queued.Add(-1)
+	}
+	return s.limiters.forNamespace(namespace).Wait(ctx)
+}
+
+// execute runs a task that holds a slot under the concurrency limit, if there is one, tracking it as in
+// flight and releasing the slot with its latency. Only the processing and DB work is timed, so rate
+// limiter waits do not skew the adaptive limit.
+func (s *server) execute(process func() (*pb.TaskResponse, error)) (*pb.TaskResponse, error) {
+	start := time.Now()
+	if s.load != nil {
+		s.load.inFlight.Add(1)
+	}
+	res, err := process()
+	if s.load != nil {
+		s.load.inFlight.Add(-1)
+		s.load.finished()
+	}
+	if s.concurrency != nil {
+		s.concurrency.Release(time.Since(start), s.overloaded(err))
+	}
+	return res, err
+}
+
+// deferTask moves a task back to "scheduled" with its requested run time, so the producer's
+// scheduler dispatches it again once it is due. Like starting it, deferring needs the task to be
+// "received", so a task that is already running or finished is never run again.
+func (s *server) deferTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
+	if err := s.requirePostgres("deferred tasks"); err != nil {
+		return nil, err
+	}
+	runAt := req.GetRunAt().AsTime()
+
+	rescheduled, err := s.queries.RescheduleTask(ctx, persistence.RescheduleTaskParams{
+		ID:        req.Id,
+		RunAt:     runAt,
+		Namespace: req.Namespace,
+	})
+	if err != nil {
+		logger.LogError("Failed to schedule task", err, &logger.LogContext{
+			"task_id": req.Id,
+			"run_at":  runAt,
+		})
+		return nil, s.dbError(err)
+	}
+	if rescheduled == 0 {
+		return nil, s.notStartedError(ctx, req)
+	}
+
+	logger.LogInfo("Task scheduled", &logger.LogContext{
+		"task_id": req.Id,
+		"run_at":  runAt,
+	})
+
+	return &pb.TaskResponse{Status: "Scheduled"}, nil
+}
+
+// requirePostgres rejects the requests for a feature the sqlite driver does not have, as it only covers the task lifecycle
+func (s *server) requirePostgres(feature string) error {
+	if s.queries == nil {
+		return status.Errorf(codes.Unimplemented, "%s need the %s database driver; the %s driver only covers the task lifecycle", feature, persistence.DriverPostgres, persistence.DriverSQLite)
+	}
+	return nil
+}
+
+// dbError reports DB failures as Unavailable once they have tripped the circuit breaker,
+// so callers can tell a down database apart from a problem with an individual task
+func (s *server) dbError(err error) error {
+	if errors.Is(err, breaker.ErrOpen) || (s.breaker != nil && s.breaker.State() == breaker.Open) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return err
+}
+
+// overloaded reports whether err says that the consumer or its database cannot keep up, rather than
+// that something is wrong with the task, so only such errors shrink the concurrency limit
+func (s *server) overloaded(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(s.dbError(err)) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *server) processTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
 	// Step 1: Update task state to "processing" immediately when received by the consumer
-	err := s.updateTaskState(req.Id, "processing")
+	leaseExpiry := s.leaseExpiry()
+	creationTime, err := s.startTask(req, leaseExpiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		taskProcessingFailures.Inc() // Increment the failure metric
+		return nil, s.notStartedError(ctx, req)
+	}
 	if err != nil {
 		taskProcessingFailures.Inc() // Increment the failure metric
 		return nil, err
 	}
 
-	// Increment the "in processing" gauge
-	tasksInProcessing.Inc()
+	return s.runTask(ctx, req, creationTime, leaseExpiry)
+}
 
-	// Step 2: Simulate processing delay
-	delayTime := time.Duration(req.Value) * time.Millisecond
-	time.Sleep(delayTime)
-	logger.LogInfo("Delaying task", &logger.LogContext{
-		"task_id":    req.Id,
-		"task_type":  req.Type,
-		"task_value": req.Value,
-		"delay":      delayTime,
-	})
+// runTask runs the handler of a task that is already "processing" under the lease and records the outcome
+func (s *server) runTask(ctx context.Context, req *pb.TaskRequest, creationTime sql.NullTime, leaseExpiry sql.NullTime) (*pb.TaskResponse, error) {
+	taskType := taskTypeLabel(req.Type)
+	startTime := time.Now()
 
-	// Step 3: Update task state to "done" after processing is complete
-	err = s.updateTaskState(req.Id, "done")
+	// Track the task as "in processing" until this function returns, whatever the outcome
+	tasksInProcessing.Inc()
+	defer tasksInProcessing.Dec()
+
+	// Step 2: Run the handler for the task type
+	result, err := s.handlerFor(req.Type)(ctx, req)
 	if err != nil {
+		observeTaskLatencies(req.Namespace, taskType, outcomeLabel(err), creationTime, startTime, time.Now())
 		taskProcessingFailures.Inc() // Increment the failure metric
+		logger.LogError("Task handler failed", err, &logger.LogContext{
+			"task_id":   req.Id,
+			"task_type": req.Type,
+		})
+
+		// The caller gave up on the task, which says nothing about the task itself, so it is handed
+		// back to be delivered again rather than failed
+		if ctx.Err() != nil {
+			s.releaseTask(req, leaseExpiry)
+			return nil, err
+		}
+
+		// Record the failure and skip every workflow task that can no longer run because of it
+		skipped, failErr := s.failTask(req, leaseExpiry, err)
+		if errors.Is(failErr, sql.ErrNoRows) {
+			logger.LogWarn("Task lease expired before it failed, leaving it to its new consumer", &logger.LogContext{
+				"task_id": req.Id,
+			})
+		} else if failErr != nil {
+			logger.LogError("Failed to mark task failed", failErr, &logger.LogContext{
+				"task_id": req.Id,
+			})
+		} else if len(skipped) > 0 {
+			logger.LogWarn("Skipped dependent tasks of failed task", &logger.LogContext{
+				"task_id":       req.Id,
+				"skipped_tasks": skipped,
+			})
+		}
 		return nil, err
 	}
 
-	// Decrement the "in processing" gauge as task is done
-	tasksInProcessing.Dec()
+	// Step 3: Mark the task "done" with its result and fold its value into the per-type stats in one transaction
+	stats, err := s.completeTask(req, leaseExpiry, result)
+	observeTaskLatencies(req.Namespace, taskType, outcomeLabel(err), creationTime, startTime, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		taskProcessingFailures.Inc() // Increment the failure metric
+		return nil, status.Errorf(codes.FailedPrecondition, "lease of task %d expired before it completed", req.Id)
+	}
+	if err != nil {
+		taskProcessingFailures.Inc() // Increment the failure metric
+		return nil, err
+	}
 
 	// Increment the processed tasks counter
 	tasksProcessed.Inc()
 
 	// Increment the processed tasks by type
-	tasksByType.With(prometheus.Labels{"task_type": string(req.Type)}).Inc()
-
-	// Add task value to the total sum for this task type in Prometheus
-	taskValuesByType.With(prometheus.Labels{"task_type": string(req.Type)}).Add(float64(req.Value))
-
-	// Update the local map with the total sum of task values for this task type
-	taskTypeSumsMu.Lock()
-	taskTypeSums[req.Type] += float64(req.Value)
-	totalValueForType := taskTypeSums[req.Type]
-	taskTypeSumsMu.Unlock()
+	tasksByType.With(prometheus.Labels{"namespace": req.Namespace, "task_type": taskType}).Inc()
 
 	// Log the task details and total sum for the task type
 	logger.LogInfo("Task processed", &logger.LogContext{
 		"task_id":              req.Id,
+		"namespace":            req.Namespace,
 		"task_type":            req.Type,
 		"task_value":           req.Value,
-		"total_value_for_type": totalValueForType,
+		"total_value_for_type": stats.Sum,
 	})
 
-	return &pb.TaskResponse{Status: "Processed"}, nil
+	return &pb.TaskResponse{Status: "Processed", Result: string(result)}, nil
 }
 
-func (s *server) updateTaskState(taskID int32, state string) error {
+// startTask moves the task to "processing" and returns when it was created, for queue wait accounting.
+// A task outside the request's namespace is not found, and neither is one that is no longer "received",
+// so a task the producer delivers again after a lost response is not processed twice. The task is
+// leased to this consumer, so the producer hands it out again if the consumer dies while running it.
+func (s *server) startTask(req *pb.TaskRequest, leaseExpiry sql.NullTime) (sql.NullTime, error) {
 	// Create context for the SQL query
 	ctx := context.Background()
 
-	// Create parameters for the UpdateTaskState query
-	params := persistence.UpdateTaskStateParams{
-		ID:    taskID,
-		State: sql.NullString{String: state, Valid: true},
+	return s.store.StartTask(ctx, persistence.MarkTaskProcessingParams{
+		ID:          req.Id,
+		Namespace:   req.Namespace,
+		LeaseExpiry: leaseExpiry,
+	})
+}
+
+// leaseExpiry returns the expiry of a lease taken now. The task is completed or failed with the same
+// value, so a consumer whose lease expired and was taken over cannot overwrite the new outcome.
+func (s *server) leaseExpiry() sql.NullTime {
+	lease := s.lease
+	if lease <= 0 {
+		lease = defaultTaskLease
+	}
+	return sql.NullTime{Time: time.Now().Add(lease), Valid: true}
+}
+
+// notStartedError tells apart the tasks that could not be started: a task that exists but is no longer
+// "received" was already delivered and fails the precondition, while a missing task is not found
+func (s *server) notStartedError(ctx context.Context, req *pb.TaskRequest) error {
+	task, err := s.store.GetTask(ctx, persistence.GetTaskByIDParams{
+		ID:        req.Id,
+		Namespace: req.Namespace,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return status.Errorf(codes.NotFound, "task %d not found in namespace %q", req.Id, req.Namespace)
+	}
+	if err != nil {
+		return s.dbError(err)
+	}
+	return status.Errorf(codes.FailedPrecondition, "task %d is %s, not received", req.Id, task.State.String)
+}
+
+// observeTaskLatencies records the lifecycle histograms of a task that reached the end of processing
+func observeTaskLatencies(namespace string, taskType string, outcome string, creationTime sql.NullTime, startTime time.Time, endTime time.Time) {
+	labels := prometheus.Labels{"namespace": namespace, "task_type": taskType, "outcome": outcome}
+
+	taskProcessingDuration.With(labels).Observe(endTime.Sub(startTime).Seconds())
+
+	// Tasks created before the creation_time column had a default carry no creation time
+	if creationTime.Valid {
+		taskQueueWait.With(labels).Observe(startTime.Sub(creationTime.Time).Seconds())
+		taskEndToEndLatency.With(labels).Observe(endTime.Sub(creationTime.Time).Seconds())
+	}
+}
+
+// taskTypeLabel renders a task type as a Prometheus label value
+func taskTypeLabel(taskType int32) string {
+	return strconv.Itoa(int(taskType))
+}
+
+// outcomeLabel renders the result of processing a task as a Prometheus label value
+func outcomeLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// completeTask marks the task "done", stores its result and updates the persisted aggregates
+// for its type in one atomic step, so the stats never drift from the tasks table. The stats are
+// built from the stored task rather than the request.
+func (s *server) completeTask(req *pb.TaskRequest, leaseExpiry sql.NullTime, result json.RawMessage) (persistence.TaskTypeStat, error) {
+	return s.store.CompleteTask(context.Background(), persistence.CompleteTaskParams{
+		ID:          req.Id,
+		Result:      result,
+		LeaseExpiry: leaseExpiry,
+	})
+}
+
+// releaseTask moves a task whose caller gave up on it back to "received", so the producer delivers it again
+func (s *server) releaseTask(req *pb.TaskRequest, leaseExpiry sql.NullTime) {
+	err := s.store.ReleaseTask(context.Background(), persistence.ReleaseTaskParams{
+		ID:          req.Id,
+		LeaseExpiry: leaseExpiry,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.LogWarn("Task lease expired before it was released, leaving it to its new consumer", &logger.LogContext{
+			"task_id": req.Id,
+		})
+	} else if err != nil {
+		// The task is handed out again once its lease expires
+		logger.LogError("Failed to release task", err, &logger.LogContext{
+			"task_id": req.Id,
+		})
+	} else {
+		logger.LogWarn("Caller gave up on task, released it for redelivery", &logger.LogContext{
+			"task_id": req.Id,
+		})
+	}
+}
+
+// taskFailure is the result recorded for a task whose handler returned an error
+type taskFailure struct {
+	Error string `json:"error"`
+}
+
+// failTask marks the task "failed" and, in the same atomic step, moves every pending task
+// that transitively depends on it to "skipped". It returns the ids of the skipped tasks
+func (s *server) failTask(req *pb.TaskRequest, leaseExpiry sql.NullTime, handlerErr error) ([]int32, error) {
+	ctx := context.Background()
+
+	result, err := json.Marshal(taskFailure{Error: handlerErr.Error()})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.FailTask(ctx, persistence.FailTaskParams{
+		ID:          req.Id,
+		Result:      result,
+		LeaseExpiry: leaseExpiry,
+	})
+}
+
+// GetTaskTypeStats returns the persisted count, sum, min, max and mean of task values per task type in a namespace
+func (s *server) GetTaskTypeStats(ctx context.Context, req *pb.TaskTypeStatsRequest) (*pb.TaskTypeStatsResponse, error) {
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.store.ListTaskTypeStats(ctx, namespace)
+	if err != nil {
+		logger.LogError("Failed to list task type stats", err, &logger.LogContext{
+			"namespace": namespace,
+		})
+		return nil, s.dbError(err)
+	}
+
+	return toTaskTypeStatsResponse(stats), nil
+}
+
+// RebuildTaskTypeStats recomputes the per-type aggregates of a namespace from the tasks table
+func (s *server) RebuildTaskTypeStats(ctx context.Context, req *pb.RebuildTaskTypeStatsRequest) (*pb.TaskTypeStatsResponse, error) {
+	if err := s.requirePostgres("task type stats rebuilds"); err != nil {
+		return nil, err
+	}
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.rebuildTaskTypeStats(ctx, namespace)
+	if err != nil {
+		logger.LogError("Failed to rebuild task type stats", err, &logger.LogContext{
+			"namespace": namespace,
+		})
+		return nil, s.dbError(err)
+	}
+
+	logger.LogInfo("Task type stats rebuilt", &logger.LogContext{
+		"namespace":  namespace,
+		"task_types": len(stats),
+	})
+
+	return toTaskTypeStatsResponse(stats), nil
+}
+
+// rebuildTaskTypeStats replaces the aggregates with ones derived from "done" tasks in a single transaction
+func (s *server) rebuildTaskTypeStats(ctx context.Context, namespace string) ([]persistence.TaskTypeStat, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	qtx := s.queries.WithTx(tx)
+	if err := qtx.DeleteTaskTypeStats(ctx, namespace); err != nil {
+		return nil, err
+	}
+	if err := qtx.RebuildTaskTypeStats(ctx, namespace); err != nil {
+		return nil, err
+	}
+	stats, err := qtx.ListTaskTypeStats(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
+
+// GetTaskResult returns the state, result and comment of a task so producers can retrieve its outcome
+func (s *server) GetTaskResult(ctx context.Context, req *pb.TaskResultRequest) (*pb.TaskResultResponse, error) {
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
 	}
 
-	// Call the UpdateTaskState query using sqlc-generated function
-	return s.queries.UpdateTaskState(ctx, params)
+	task, err := s.store.GetTask(ctx, persistence.GetTaskByIDParams{
+		ID:        req.Id,
+		Namespace: namespace,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "task %d not found in namespace %q", req.Id, namespace)
+	}
+	if err != nil {
+		logger.LogError("Failed to get task result", err, &logger.LogContext{
+			"task_id":   req.Id,
+			"namespace": namespace,
+		})
+		return nil, s.dbError(err)
+	}
+
+	return &pb.TaskResultResponse{
+		Id:      task.ID,
+		State:   task.State.String,
+		Result:  string(task.Result),
+		Comment: task.Comment.String,
+	}, nil
+}
+
+// toTaskTypeStatsResponse converts the persisted aggregates into their protobuf representation
+func toTaskTypeStatsResponse(stats []persistence.TaskTypeStat) *pb.TaskTypeStatsResponse {
+	res := &pb.TaskTypeStatsResponse{}
+	for _, stat := range stats {
+		var mean float64
+		if stat.Count > 0 {
+			mean = float64(stat.Sum) / float64(stat.Count)
+		}
+		res.Stats = append(res.Stats, &pb.TaskTypeStats{
+			Type:  stat.Type,
+			Count: stat.Count,
+			Sum:   stat.Sum,
+			Min:   stat.Min,
+			Max:   stat.Max,
+			Mean:  mean,
+		})
+	}
+	return res
 }
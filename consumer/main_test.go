@@ -2,11 +2,21 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
 	"net"
 	"testing"
 	"time"
@@ -47,7 +57,7 @@ func TestConsumerRateLimiting(t *testing.T) {
 
 	go func() {
 		if err := s.Serve(lis); err != nil {
-			t.Fatalf("Server failed to start: %v", err)
+			t.Errorf("Server failed to start: %v", err)
 		}
 	}()
 
@@ -71,3 +81,951 @@ func TestConsumerRateLimiting(t *testing.T) {
 	elapsed := time.Since(start)
 	assert.GreaterOrEqual(t, elapsed.Milliseconds(), int64(500)) // Ensure the delay occurred
 }
+
+// TestCompleteTaskUpdatesStats validates that completion and the per-type stats share one transaction
+func TestCompleteTaskUpdatesStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+	leaseExpiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE tasks SET state = 'done', result(.+)AND state = 'processing' AND lease_expiry = \\$3").
+		WithArgs(int32(7), []byte(`{"delay_ms":40}`), leaseExpiry).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "value", "namespace"}).AddRow(3, 40, "default"))
+	mock.ExpectQuery("INSERT INTO task_type_stats").
+		WithArgs("default", int32(3), int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum", "min", "max", "last_update_time", "namespace"}).
+			AddRow(3, 2, 60, 20, 40, nil, "default"))
+	mock.ExpectCommit()
+
+	// The stats are built from the stored task, whatever the request claims
+	stats, err := s.completeTask(&pb.TaskRequest{Id: 7, Type: 9, Value: 1000, Namespace: "default"}, leaseExpiry, json.RawMessage(`{"delay_ms":40}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(60), stats.Sum)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCompleteTaskAfterLeaseExpired validates that a consumer whose lease was taken over neither completes
+// the task nor counts it in the stats
+func TestCompleteTaskAfterLeaseExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db), handlers: map[int32]taskHandler{
+		3: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+			return json.RawMessage(`{"ok":true}`), nil
+		},
+	}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE tasks SET state = 'done', result").
+		WithArgs(int32(7), []byte(`{"ok":true}`), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "value", "namespace"}))
+	mock.ExpectRollback()
+
+	leaseExpiry := sql.NullTime{Time: time.Now().Add(-time.Second), Valid: true}
+	_, err = s.runTask(context.Background(), &pb.TaskRequest{Id: 7, Type: 3, Value: 40, Namespace: "default"}, sql.NullTime{}, leaseExpiry)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetTaskTypeStats validates that the persisted aggregates are exposed with their mean
+func TestGetTaskTypeStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+
+	mock.ExpectQuery("SELECT type, count, sum, min, max, last_update_time, namespace FROM task_type_stats").
+		WithArgs("team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum", "min", "max", "last_update_time", "namespace"}).
+			AddRow(3, 4, 100, 10, 40, nil, "team-a"))
+
+	res, err := s.GetTaskTypeStats(context.Background(), &pb.TaskTypeStatsRequest{Namespace: "team-a"})
+	assert.NoError(t, err)
+	assert.Len(t, res.Stats, 1)
+	assert.Equal(t, int32(3), res.Stats[0].Type)
+	assert.Equal(t, int64(4), res.Stats[0].Count)
+	assert.Equal(t, 25.0, res.Stats[0].Mean)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSendTaskRejectsOverConcurrencyLimit validates that excess work is shed with ResourceExhausted
+func TestSendTaskRejectsOverConcurrencyLimit(t *testing.T) {
+	s := &server{
+		limiters:    unlimitedLimiters(),
+		concurrency: newAdaptiveLimiter(AdaptiveLimiter{InitialLimit: 1, MinLimit: 1, MaxLimit: 1}),
+	}
+
+	// Occupy the only slot so the next task is over the limit
+	assert.True(t, s.concurrency.Acquire())
+
+	_, err := s.SendTask(context.Background(), &pb.TaskRequest{Id: 1, Type: 1, Value: 1})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+// TestProcessTaskFailureReleasesGauge validates that the in-processing gauge is released when completion fails
+func TestProcessTaskFailureReleasesGauge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing'").
+		WithArgs(int32(9), "default", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"creation_time"}).AddRow(time.Now()))
+	mock.ExpectBegin().WillReturnError(errors.New("connection reset"))
+
+	_, err = s.processTask(context.Background(), &pb.TaskRequest{Id: 9, Type: 4, Value: 1, Namespace: "default"})
+	assert.Error(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(tasksInProcessing))
+	assert.Equal(t, 1, testutil.CollectAndCount(taskEndToEndLatency, "task_end_to_end_latency_seconds"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTaskTypeLabel validates that task types are rendered as decimal label values
+func TestTaskTypeLabel(t *testing.T) {
+	assert.Equal(t, "7", taskTypeLabel(7))
+	assert.Equal(t, "0", taskTypeLabel(0))
+}
+
+// TestSendTaskUnavailableWhileBreakerOpen validates that tasks are refused while the database breaker is open
+func TestSendTaskUnavailableWhileBreakerOpen(t *testing.T) {
+	dbBreaker := newDBBreaker(CircuitBreaker{FailureThreshold: 1, CooldownMs: 60000})
+	assert.NoError(t, dbBreaker.Allow())
+	dbBreaker.Record(errors.New("connection refused"))
+
+	s := &server{
+		limiters: unlimitedLimiters(),
+		breaker:  dbBreaker,
+	}
+
+	_, err := s.SendTask(context.Background(), &pb.TaskRequest{Id: 1, Type: 1, Value: 1})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// TestGetTaskResult validates that a task's stored result and comment are returned
+func TestGetTaskResult(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE id").
+		WithArgs(int32(5), "default").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(5, 1, 20, "done", nil, nil, "smoke test", []byte(`{"delay_ms":20}`), time.Now(), nil, "default", nil))
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE id").
+		WithArgs(int32(6), "default").
+		WillReturnError(sql.ErrNoRows)
+
+	res, err := s.GetTaskResult(context.Background(), &pb.TaskResultRequest{Id: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", res.State)
+	assert.Equal(t, "smoke test", res.Comment)
+	assert.JSONEq(t, `{"delay_ms":20}`, res.Result)
+
+	_, err = s.GetTaskResult(context.Background(), &pb.TaskResultRequest{Id: 6})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestHandlerFor validates that registered handlers take precedence over the default
+func TestHandlerFor(t *testing.T) {
+	s := &server{handlers: map[int32]taskHandler{
+		2: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+			return json.RawMessage(`{"custom":true}`), nil
+		},
+	}}
+
+	result, err := s.handlerFor(2)(context.Background(), &pb.TaskRequest{Type: 2})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"custom":true}`, string(result))
+
+	result, err = s.handlerFor(3)(context.Background(), &pb.TaskRequest{Type: 3, Value: 1})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"delay_ms":1}`, string(result))
+}
+
+// TestSendTaskDefersFutureTasks validates that a task sent before its run time is scheduled instead of processed
+func TestSendTaskDefersFutureTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{
+		limiters: unlimitedLimiters(),
+		db:       db,
+		queries:  persistence.New(db),
+		store:    persistence.NewPostgresStore(db),
+	}
+
+	runAt := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+	mock.ExpectExec("UPDATE tasks SET state = 'scheduled'").
+		WithArgs(int32(8), runAt, "default").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res, err := s.SendTask(context.Background(), &pb.TaskRequest{Id: 8, Type: 1, Value: 1, RunAt: timestamppb.New(runAt)})
+	assert.NoError(t, err)
+	assert.Equal(t, "Scheduled", res.Status)
+
+	// A task that is no longer received is not scheduled again, so finished work never runs twice
+	mock.ExpectExec("UPDATE tasks SET state = 'scheduled'(.+)AND state = 'received'").
+		WithArgs(int32(9), runAt, "default").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE id = \\$1 AND namespace = \\$2").
+		WithArgs(int32(9), "default").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(9, 1, 1, "done", time.Now(), time.Now(), nil, []byte("null"), time.Time{}, nil, "default", nil))
+
+	_, err = s.SendTask(context.Background(), &pb.TaskRequest{Id: 9, Type: 1, Value: 1, RunAt: timestamppb.New(runAt)})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestValidateWorkflow validates that workflows are ordered topologically and malformed graphs are rejected
+func TestValidateWorkflow(t *testing.T) {
+	tasks := []*pb.WorkflowTask{{Key: "b"}, {Key: "a"}, {Key: "c"}}
+
+	order, err := validateWorkflow(&pb.WorkflowRequest{
+		Tasks: tasks,
+		Edges: []*pb.WorkflowEdge{{Parent: "a", Child: "b"}, {Parent: "c", Child: "b"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, order, 3)
+	assert.Equal(t, "b", order[2].Key)
+
+	_, err = validateWorkflow(&pb.WorkflowRequest{})
+	assert.Error(t, err)
+
+	_, err = validateWorkflow(&pb.WorkflowRequest{Tasks: []*pb.WorkflowTask{{Key: "a"}, {Key: "a"}}})
+	assert.Error(t, err)
+
+	_, err = validateWorkflow(&pb.WorkflowRequest{Tasks: tasks, Edges: []*pb.WorkflowEdge{{Parent: "a", Child: "d"}}})
+	assert.Error(t, err)
+
+	_, err = validateWorkflow(&pb.WorkflowRequest{
+		Tasks: tasks,
+		Edges: []*pb.WorkflowEdge{{Parent: "a", Child: "b"}, {Parent: "b", Child: "c"}, {Parent: "c", Child: "a"}},
+	})
+	assert.EqualError(t, err, "workflow contains a cycle")
+}
+
+// TestSubmitWorkflow validates that a workflow, its pending tasks and their edges are stored in one transaction
+func TestSubmitWorkflow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO workflows").
+		WithArgs("nightly", "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery("INSERT INTO tasks (.+)'pending'").
+		WithArgs(int32(1), int32(10), nil, int32(4), "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(20))
+	mock.ExpectQuery("INSERT INTO tasks (.+)'pending'").
+		WithArgs(int32(2), int32(30), "report", int32(4), "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+	mock.ExpectExec("INSERT INTO task_dependencies").
+		WithArgs(int32(21), int32(20)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err := s.SubmitWorkflow(context.Background(), &pb.WorkflowRequest{
+		Name:      "nightly",
+		Namespace: "team-a",
+		Tasks: []*pb.WorkflowTask{
+			{Key: "report", Type: 2, Value: 30, Comment: "report"},
+			{Key: "extract", Type: 1, Value: 10},
+		},
+		Edges: []*pb.WorkflowEdge{{Parent: "extract", Child: "report"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), res.WorkflowId)
+	assert.Equal(t, map[string]int32{"extract": 20, "report": 21}, res.TaskIds)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = s.SubmitWorkflow(context.Background(), &pb.WorkflowRequest{Name: "empty"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestGetWorkflowStatus validates that task states and dependencies are reported with the overall state
+func TestGetWorkflowStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+
+	mock.ExpectQuery("SELECT (.+) FROM workflows WHERE id").
+		WithArgs(int32(4), "default").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "creation_time", "namespace"}).AddRow(4, "nightly", nil, "default"))
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE workflow_id").
+		WithArgs(int32(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(20, 1, 10, "failed", nil, nil, nil, []byte(`{"error":"boom"}`), time.Now(), 4, "default", nil).
+			AddRow(21, 2, 30, "skipped", nil, nil, nil, []byte("null"), time.Now(), 4, "default", nil))
+	mock.ExpectQuery("SELECT d.task_id, d.depends_on_id").
+		WithArgs(int32(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"task_id", "depends_on_id"}).AddRow(21, 20))
+	mock.ExpectQuery("SELECT (.+) FROM workflows WHERE id").
+		WithArgs(int32(5), "default").
+		WillReturnError(sql.ErrNoRows)
+
+	res, err := s.GetWorkflowStatus(context.Background(), &pb.WorkflowStatusRequest{WorkflowId: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", res.State)
+	assert.Len(t, res.Tasks, 2)
+	assert.Equal(t, []int32{20}, res.Tasks[1].DependsOn)
+
+	_, err = s.GetWorkflowStatus(context.Background(), &pb.WorkflowStatusRequest{WorkflowId: 5})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestWorkflowState validates how task states roll up into the workflow state
+func TestWorkflowState(t *testing.T) {
+	task := func(state string) persistence.Task {
+		return persistence.Task{State: sql.NullString{String: state, Valid: true}}
+	}
+
+	assert.Equal(t, "done", workflowState([]persistence.Task{task("done"), task("done")}))
+	assert.Equal(t, "running", workflowState([]persistence.Task{task("done"), task("pending")}))
+	assert.Equal(t, "failed", workflowState([]persistence.Task{task("processing"), task("skipped")}))
+}
+
+// TestProcessTaskHandlerFailureSkipsDependents validates that a failed handler marks the task failed
+// and skips the tasks depending on it
+func TestProcessTaskHandlerFailureSkipsDependents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db), handlers: map[int32]taskHandler{
+		5: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+			return nil, errors.New("boom")
+		},
+	}}
+
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing'").
+		WithArgs(int32(20), "default", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"creation_time"}).AddRow(time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE tasks SET state = 'failed'(.+)AND state = 'processing' AND lease_expiry = \\$3").
+		WithArgs(int32(20), json.RawMessage(`{"error":"boom"}`), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("WITH RECURSIVE dependents").
+		WithArgs(int32(20)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+	mock.ExpectCommit()
+
+	_, err = s.processTask(context.Background(), &pb.TaskRequest{Id: 20, Type: 5, Value: 1, Namespace: "default"})
+	assert.EqualError(t, err, "boom")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestProcessTaskWithMemoryStore validates the task lifecycle against the in-memory store, without a database
+func TestProcessTaskWithMemoryStore(t *testing.T) {
+	store := persistence.NewMemoryStore()
+	s := &server{store: store, handlers: map[int32]taskHandler{
+		7: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+			return json.RawMessage(`{"doubled": 84}`), nil
+		},
+	}}
+
+	id, err := store.CreateTask(context.Background(), persistence.CreateTaskParams{
+		Type:      sql.NullInt32{Int32: 7, Valid: true},
+		Value:     sql.NullInt32{Int32: 42, Valid: true},
+		Namespace: "team-a",
+	})
+	assert.NoError(t, err)
+
+	req := &pb.TaskRequest{Id: id, Type: 7, Value: 42, Namespace: "team-a"}
+	res, err := s.processTask(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"doubled": 84}`, res.Result)
+
+	// A second delivery finds the task already started
+	_, err = s.processTask(context.Background(), req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	result, err := s.GetTaskResult(context.Background(), &pb.TaskResultRequest{Id: id, Namespace: "team-a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", result.State)
+
+	stats, err := s.GetTaskTypeStats(context.Background(), &pb.TaskTypeStatsRequest{Namespace: "team-a"})
+	assert.NoError(t, err)
+	if assert.Len(t, stats.Stats, 1) {
+		assert.Equal(t, int64(1), stats.Stats[0].Count)
+		assert.Equal(t, int64(42), stats.Stats[0].Sum)
+	}
+}
+
+// TestSendTaskErrorsShrinkLimitOnlyOnOverload validates that duplicate deliveries and failing handlers leave the
+// concurrency limit alone, while a timeout shrinks it
+func TestSendTaskErrorsShrinkLimitOnlyOnOverload(t *testing.T) {
+	store := persistence.NewMemoryStore()
+	s := &server{
+		limiters:    unlimitedLimiters(),
+		store:       store,
+		concurrency: newAdaptiveLimiter(AdaptiveLimiter{InitialLimit: 10, MinLimit: 1, MaxLimit: 20}),
+		handlers: map[int32]taskHandler{
+			1: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+				return nil, errors.New("boom")
+			},
+			2: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+				return nil, context.DeadlineExceeded
+			},
+		},
+	}
+	create := func(taskType int32) int32 {
+		id, err := store.CreateTask(context.Background(), persistence.CreateTaskParams{
+			Type:      sql.NullInt32{Int32: taskType, Valid: true},
+			Value:     sql.NullInt32{Int32: 1, Valid: true},
+			Namespace: "default",
+		})
+		assert.NoError(t, err)
+		return id
+	}
+
+	// The task is started by the first delivery, so every later one fails the precondition
+	id := create(1)
+	_, err := s.SendTask(context.Background(), &pb.TaskRequest{Id: id, Type: 1, Value: 1})
+	assert.EqualError(t, err, "boom")
+	for i := 0; i < 20; i++ {
+		_, err := s.SendTask(context.Background(), &pb.TaskRequest{Id: id, Type: 1, Value: 1})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	_, err = s.SendTask(context.Background(), &pb.TaskRequest{Id: 999, Type: 1, Value: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 10, s.concurrency.Limit())
+
+	id = create(2)
+	_, err = s.SendTask(context.Background(), &pb.TaskRequest{Id: id, Type: 2, Value: 1})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 9, s.concurrency.Limit())
+}
+
+// TestSendTaskReleasesTaskWhenCallerGivesUp validates that a task whose caller cancels mid-run is handed back
+// to be delivered again instead of being failed
+func TestSendTaskReleasesTaskWhenCallerGivesUp(t *testing.T) {
+	store := persistence.NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &server{
+		limiters: unlimitedLimiters(),
+		store:    store,
+		handlers: map[int32]taskHandler{
+			1: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+				cancel()
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+	}
+	id, err := store.CreateTask(context.Background(), persistence.CreateTaskParams{
+		Type:      sql.NullInt32{Int32: 1, Valid: true},
+		Value:     sql.NullInt32{Int32: 1, Valid: true},
+		Namespace: "default",
+	})
+	assert.NoError(t, err)
+
+	_, err = s.SendTask(ctx, &pb.TaskRequest{Id: id, Type: 1, Value: 1})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	task, err := store.GetTask(context.Background(), persistence.GetTaskByIDParams{ID: id, Namespace: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, "received", task.State.String)
+}
+
+// TestRequirePostgres validates that the features without a SQLite implementation are rejected on the sqlite driver
+func TestRequirePostgres(t *testing.T) {
+	s := &server{store: persistence.NewMemoryStore()}
+
+	_, err := s.SubmitWorkflow(context.Background(), &pb.WorkflowRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = s.GetTaskTimeline(context.Background(), &pb.TaskTimelineRequest{Id: 1})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// unlimitedLimiters returns per-namespace limiters that never make a task wait
+func unlimitedLimiters() *namespaceLimiters {
+	limiters, _ := newNamespaceLimiters(nil, func(string) (taskLimiter, error) {
+		return rate.NewLimiter(rate.Inf, 1), nil
+	})
+	return limiters
+}
+
+// TestRequestNamespace validates that the request field wins over metadata and that the default applies otherwise
+func TestRequestNamespace(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(namespaceMetadataKey, "team-b"))
+
+	namespace, err := requestNamespace(ctx, "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", namespace)
+
+	namespace, err = requestNamespace(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-b", namespace)
+
+	namespace, err = requestNamespace(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultNamespace, namespace)
+
+	_, err = requestNamespace(context.Background(), "Team A")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestNewTaskLimiterNamespaceOverride validates that configured namespaces get their own limiter with overrides and the rest share the default one
+func TestNewTaskLimiterNamespaceOverride(t *testing.T) {
+	config := RateLimiter{
+		TasksPerSecond: 10,
+		Burst:          1,
+		Namespaces: map[string]NamespaceRateLimit{
+			"team-a": {TasksPerSecond: 2, Burst: 5},
+		},
+	}
+	limiters, err := newNamespaceLimiters([]string{"team-a"}, func(namespace string) (taskLimiter, error) {
+		return newTaskLimiter(config, namespace, nil)
+	})
+	assert.NoError(t, err)
+
+	teamA := limiters.forNamespace("team-a").(*rate.Limiter)
+	assert.Equal(t, rate.Limit(2), teamA.Limit())
+	assert.Equal(t, 5, teamA.Burst())
+	assert.Same(t, teamA, limiters.forNamespace("team-a"))
+
+	fallback := limiters.forNamespace(defaultNamespace).(*rate.Limiter)
+	assert.Equal(t, rate.Limit(10), fallback.Limit())
+	assert.NotSame(t, teamA, fallback)
+
+	// Namespaces without an entry share the default limiter rather than growing the set
+	assert.Same(t, fallback, limiters.forNamespace("team-b"))
+	assert.Len(t, limiters.limiters, 2)
+
+	// A namespace that could never be served is refused up front
+	config.Namespaces["team-c"] = NamespaceRateLimit{TasksPerSecond: 0}
+	_, err = newNamespaceLimiters([]string{"team-a", "team-c"}, func(namespace string) (taskLimiter, error) {
+		return newTaskLimiter(config, namespace, nil)
+	})
+	assert.Error(t, err)
+}
+
+// TestSendTaskNotFoundInOtherNamespace validates that a task cannot be processed through another namespace
+func TestSendTaskNotFoundInOtherNamespace(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{
+		limiters: unlimitedLimiters(),
+		db:       db,
+		queries:  persistence.New(db),
+		store:    persistence.NewPostgresStore(db),
+	}
+
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing'").
+		WithArgs(int32(11), "team-b", sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE id").
+		WithArgs(int32(11), "team-b").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = s.SendTask(context.Background(), &pb.TaskRequest{Id: 11, Type: 1, Value: 1, Namespace: "team-b"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestLoadHint validates that load hints report the namespace rate, scaled down by the queue, and flag overload past
+// the queue threshold
+func TestLoadHint(t *testing.T) {
+	load := newLoadTracker(RateLimiter{
+		TasksPerSecond: 5,
+		Namespaces:     map[string]NamespaceRateLimit{"team-a": {TasksPerSecond: 20}},
+	}, LoadHints{MaxQueueDepth: 2})
+
+	load.inFlight.Add(1)
+	load.queued.Add(2)
+	hint := load.hint("team-a", nil)
+	assert.Equal(t, int32(2), hint.QueueDepth)
+	assert.Equal(t, int32(1), hint.InFlight)
+	assert.Equal(t, 10.0, hint.SuggestedRate)
+	assert.False(t, hint.Overloaded)
+
+	load.queued.Add(1)
+	hint = load.hint("default", nil)
+	assert.Equal(t, 2.0, hint.SuggestedRate)
+	assert.True(t, hint.Overloaded)
+
+	// A saturated concurrency limit is overload too
+	load.queued.Add(-3)
+	concurrency := newAdaptiveLimiter(AdaptiveLimiter{InitialLimit: 1, MinLimit: 1, MaxLimit: 1})
+	assert.True(t, concurrency.Acquire())
+	hint = load.hint("default", concurrency)
+	assert.True(t, hint.Overloaded)
+	assert.Equal(t, 5.0, hint.SuggestedRate)
+}
+
+// TestSuggestedRateFollowsDrainRate validates that the suggested rate drops to the measured drain rate, and below it
+// as the backlog grows, and that a replica suggests its share of a shared budget
+func TestSuggestedRateFollowsDrainRate(t *testing.T) {
+	load := newLoadTracker(RateLimiter{TasksPerSecond: 100}, LoadHints{MaxQueueDepth: 10})
+
+	// 30 tasks finished in two seconds
+	start := time.Now()
+	for i := 0; i <= 30; i++ {
+		load.drain.mark(start.Add(time.Duration(i) * 2 * time.Second / 30))
+	}
+	now := start.Add(2 * time.Second)
+	assert.InDelta(t, 15.0, load.drain.rate(now), 0.5)
+
+	assert.Equal(t, 100.0, load.suggestedRate("default", 0, now))
+	assert.InDelta(t, 7.5, load.suggestedRate("default", 10, now), 0.25)
+	assert.InDelta(t, 3.75, load.suggestedRate("default", 30, now), 0.125)
+
+	// The drain rate never raises the suggestion above the configured rate
+	load.rateLimiter.TasksPerSecond = 10
+	assert.Equal(t, 5.0, load.suggestedRate("default", 10, now))
+
+	shared := newLoadTracker(RateLimiter{TasksPerSecond: 100, Mode: "shared", Replicas: 4}, LoadHints{})
+	assert.Equal(t, 25.0, shared.suggestedRate("default", 0, now))
+}
+
+// TestSendTaskReturnsLoadHint validates that a processed task's response carries the consumer's load
+func TestSendTaskReturnsLoadHint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{
+		limiters: unlimitedLimiters(),
+		db:       db,
+		queries:  persistence.New(db),
+		store:    persistence.NewPostgresStore(db),
+		load:     newLoadTracker(RateLimiter{TasksPerSecond: 8}, LoadHints{}),
+		handlers: map[int32]taskHandler{
+			2: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+				return json.RawMessage(`{"ok":true}`), nil
+			},
+		},
+	}
+
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing'").
+		WithArgs(int32(30), "default", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"creation_time"}).AddRow(time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE tasks SET state = 'done', result").
+		WithArgs(int32(30), []byte(`{"ok":true}`), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "value", "namespace"}).AddRow(2, 6, "default"))
+	mock.ExpectQuery("INSERT INTO task_type_stats").
+		WithArgs("default", int32(2), int64(6)).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum", "min", "max", "last_update_time", "namespace"}).
+			AddRow(2, 1, 6, 6, 6, nil, "default"))
+	mock.ExpectCommit()
+
+	res, err := s.SendTask(context.Background(), &pb.TaskRequest{Id: 30, Type: 2, Value: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, 8.0, res.Load.GetSuggestedRate())
+	assert.Equal(t, int32(0), res.Load.GetInFlight())
+	assert.False(t, res.Load.GetOverloaded())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSendTaskDryRun validates that a dry-run task is refused unless allowed, and then answered with a load hint
+// without touching the database
+func TestSendTaskDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{
+		limiters: unlimitedLimiters(),
+		db:       db,
+		queries:  persistence.New(db),
+		store:    persistence.NewPostgresStore(db),
+		load:     newLoadTracker(RateLimiter{TasksPerSecond: 8}, LoadHints{}),
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(dryRunMetadataKey, "true"))
+	_, err = s.SendTask(ctx, &pb.TaskRequest{Id: 1, Type: 2, Value: 6})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	s.dryRuns = true
+	res, err := s.SendTask(ctx, &pb.TaskRequest{Id: 1, Type: 2, Value: 6, RunAt: timestamppb.New(time.Now().Add(time.Hour))})
+	assert.NoError(t, err)
+	assert.Equal(t, "Dry run", res.GetStatus())
+	assert.Equal(t, 8.0, res.Load.GetSuggestedRate())
+	// No query was expected, so any database call would have failed the request
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTaskListenerClaimsReceivedTasks validates that claimed tasks are processed without a push from the producer
+func TestTaskListenerClaimsReceivedTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{
+		limiters: unlimitedLimiters(),
+		db:       db,
+		queries:  persistence.New(db),
+		store:    persistence.NewPostgresStore(db),
+		handlers: map[int32]taskHandler{
+			3: func(ctx context.Context, req *pb.TaskRequest) (json.RawMessage, error) {
+				return json.RawMessage(`{"ok":true}`), nil
+			},
+		},
+	}
+	l := newTaskListener(s, nil, Dispatch{BatchSize: 2, Workers: 1})
+	leaseExpiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+	// One worker is free, so one task is claimed
+	mock.ExpectQuery("SELECT namespace FROM tasks").
+		WithArgs(int32(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"namespace"}).AddRow("team-a"))
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing', lease_expiry(.+)state = 'received' OR \\(state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP\\)(.+)FOR UPDATE SKIP LOCKED").
+		WithArgs(sqlmock.AnyArg(), "team-a", int32(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(7, 3, 40, "processing", time.Now(), time.Now(), nil, []byte("null"), time.Time{}, nil, "team-a", leaseExpiry.Time))
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE tasks SET state = 'done', result").
+		WithArgs(int32(7), []byte(`{"ok":true}`), leaseExpiry).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "value", "namespace"}).AddRow(3, 40, "team-a"))
+	mock.ExpectQuery("INSERT INTO task_type_stats").
+		WithArgs("team-a", int32(3), int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum", "min", "max", "last_update_time", "namespace"}).
+			AddRow(3, 1, 40, 40, 40, nil, "team-a"))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT namespace FROM tasks").
+		WithArgs(int32(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"namespace"}))
+
+	l.claim(context.Background())
+
+	// Wait for the only worker to finish
+	l.workers <- struct{}{}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTaskListenerClaimsAfterRateLimiter validates that only the free workers are claimed for, from one
+// namespace at a time, and only once the namespace's rate limiter has let every task through
+func TestTaskListenerClaimsAfterRateLimiter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	limiters := map[string]*countingLimiter{}
+	namespaceLimiters, err := newNamespaceLimiters([]string{"team-a"}, func(namespace string) (taskLimiter, error) {
+		limiters[namespace] = &countingLimiter{}
+		return limiters[namespace], nil
+	})
+	assert.NoError(t, err)
+	s := &server{
+		limiters: namespaceLimiters,
+		db:       db,
+		queries:  persistence.New(db),
+		store:    persistence.NewPostgresStore(db),
+	}
+	l := newTaskListener(s, nil, Dispatch{BatchSize: 10, Workers: 4})
+	// One worker is busy
+	l.workers <- struct{}{}
+
+	mock.ExpectQuery("SELECT namespace FROM tasks").
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"namespace"}).AddRow("team-a").AddRow("team-a").AddRow("team-b"))
+	// Another consumer got there first
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing', lease_expiry").
+		WithArgs(sqlmock.AnyArg(), "team-a", int32(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}))
+
+	l.claim(context.Background())
+
+	assert.Equal(t, 2, limiters["team-a"].waits)
+	assert.NotContains(t, limiters, "team-b")
+	assert.Len(t, l.workers, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTaskListenerAdmitsLikeSendTask validates that nothing is claimed while the breaker is open, and that
+// only as many tasks are claimed as the concurrency limit has room for, freeing the slots of unclaimed ones
+func TestTaskListenerAdmitsLikeSendTask(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	dbBreaker := newDBBreaker(CircuitBreaker{FailureThreshold: 1, CooldownMs: 60000})
+	assert.NoError(t, dbBreaker.Allow())
+	dbBreaker.Record(errors.New("connection refused"))
+	s := &server{
+		limiters:    unlimitedLimiters(),
+		db:          db,
+		queries:     persistence.New(db),
+		store:       persistence.NewPostgresStore(db),
+		breaker:     dbBreaker,
+		concurrency: newAdaptiveLimiter(AdaptiveLimiter{InitialLimit: 2, MinLimit: 1, MaxLimit: 10}),
+	}
+	l := newTaskListener(s, nil, Dispatch{BatchSize: 10, Workers: 4})
+
+	// No query is expected while the breaker is open
+	l.claim(context.Background())
+	assert.Len(t, l.workers, 0)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// With the breaker closed, one slot is taken by a pushed task, so only one task is claimed for
+	s.breaker = nil
+	assert.True(t, s.concurrency.Acquire())
+	mock.ExpectQuery("SELECT namespace FROM tasks").
+		WithArgs(int32(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"namespace"}))
+
+	l.claim(context.Background())
+	assert.Len(t, l.workers, 0)
+	assert.Equal(t, 1, s.concurrency.InFlight())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// With the limit reached, nothing is claimed
+	assert.True(t, s.concurrency.Acquire())
+	l.claim(context.Background())
+	assert.Len(t, l.workers, 0)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// countingLimiter lets every task through, counting them
+type countingLimiter struct {
+	waits int
+}
+
+func (l *countingLimiter) Wait(context.Context) error {
+	l.waits++
+	return nil
+}
+
+// TestGetTaskTimeline validates that transitions are returned in order with the time spent in each state
+func TestGetTaskTimeline(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	s := &server{db: db, queries: persistence.New(db), store: persistence.NewPostgresStore(db)}
+	created := time.Now().Add(-time.Minute)
+
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE id").
+		WithArgs(int32(5), "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(5, 1, 20, "failed", created, nil, nil, []byte(`{"error":"boom"}`), created, nil, "team-a", nil))
+	mock.ExpectQuery("SELECT (.+) FROM task_events WHERE task_id").
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "old_state", "new_state", "event_time", "actor", "error"}).
+			AddRow(1, 5, nil, "received", created, "producer@host-1", nil).
+			AddRow(2, 5, "received", "processing", created.Add(1500*time.Millisecond), "consumer@host-2", nil).
+			AddRow(3, 5, "processing", "failed", created.Add(2*time.Second), "consumer@host-2", "boom"))
+	mock.ExpectQuery("SELECT (.+) FROM tasks WHERE id").
+		WithArgs(int32(6), "team-a").
+		WillReturnError(sql.ErrNoRows)
+
+	res, err := s.GetTaskTimeline(context.Background(), &pb.TaskTimelineRequest{Id: 5, Namespace: "team-a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", res.State)
+	assert.Len(t, res.Events, 3)
+	assert.Equal(t, "", res.Events[0].OldState)
+	assert.Equal(t, "producer@host-1", res.Events[0].Actor)
+	assert.Equal(t, int64(1500), res.Events[0].DurationMs)
+	assert.Equal(t, int64(500), res.Events[1].DurationMs)
+	// A finished task stays in its final state indefinitely
+	assert.Equal(t, "boom", res.Events[2].Error)
+	assert.Equal(t, int64(0), res.Events[2].DurationMs)
+
+	_, err = s.GetTaskTimeline(context.Background(), &pb.TaskTimelineRequest{Id: 6, Namespace: "team-a"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
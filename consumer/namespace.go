@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"regexp"
+)
+
+// defaultNamespace holds the tasks of requests that name no namespace
+const defaultNamespace = "default"
+
+// namespaceMetadataKey is the gRPC metadata key clients can set instead of the request field
+const namespaceMetadataKey = "x-namespace"
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// requestNamespace resolves the namespace of a request: the request field takes precedence over
+// the x-namespace metadata, and requests with neither belong to the default namespace
+func requestNamespace(ctx context.Context, namespace string) (string, error) {
+	if namespace == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(namespaceMetadataKey); len(values) > 0 {
+				namespace = values[0]
+			}
+		}
+	}
+	if namespace == "" {
+		return defaultNamespace, nil
+	}
+	if !namespacePattern.MatchString(namespace) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid namespace %q", namespace)
+	}
+	return namespace, nil
+}
+
+// namespaceLimiters holds one rate limiter per configured namespace, so a busy namespace cannot use
+// up the budget of the others. Namespaces without a rate_limiter entry share the limiter of the
+// default namespace, so arbitrary namespace names cannot grow the limiters, or the shared token
+// buckets, without bound. The set is fixed, so every limiter is created up front.
+type namespaceLimiters struct {
+	limiters map[string]taskLimiter
+}
+
+// newNamespaceLimiters creates the limiters of the default namespace and the given ones
+func newNamespaceLimiters(namespaces []string, newLimiter func(namespace string) (taskLimiter, error)) (*namespaceLimiters, error) {
+	limiters := make(map[string]taskLimiter, len(namespaces)+1)
+	for _, namespace := range append([]string{defaultNamespace}, namespaces...) {
+		if _, ok := limiters[namespace]; ok {
+			continue
+		}
+		lim, err := newLimiter(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("rate limiter of namespace %q: %w", namespace, err)
+		}
+		limiters[namespace] = lim
+	}
+	return &namespaceLimiters{limiters: limiters}, nil
+}
+
+// forNamespace returns the limiter of a namespace, or the default namespace's if it has none of its own
+func (l *namespaceLimiters) forNamespace(namespace string) taskLimiter {
+	if lim, ok := l.limiters[namespace]; ok {
+		return lim
+	}
+	return l.limiters[defaultNamespace]
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"time"
+)
+
+// GetTaskTimeline returns every state transition of a task, with how long it stayed in each state
+func (s *server) GetTaskTimeline(ctx context.Context, req *pb.TaskTimelineRequest) (*pb.TaskTimelineResponse, error) {
+	if err := s.requirePostgres("task timelines"); err != nil {
+		return nil, err
+	}
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Events carry no namespace, so check the task belongs to the caller's first
+	task, err := s.store.GetTask(ctx, persistence.GetTaskByIDParams{
+		ID:        req.Id,
+		Namespace: namespace,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "task %d not found in namespace %q", req.Id, namespace)
+	}
+	if err != nil {
+		logger.LogError("Failed to get task", err, &logger.LogContext{
+			"task_id":   req.Id,
+			"namespace": namespace,
+		})
+		return nil, s.dbError(err)
+	}
+
+	events, err := s.queries.ListTaskEvents(ctx, task.ID)
+	if err != nil {
+		logger.LogError("Failed to list task events", err, &logger.LogContext{
+			"task_id":   req.Id,
+			"namespace": namespace,
+		})
+		return nil, s.dbError(err)
+	}
+
+	return &pb.TaskTimelineResponse{
+		Id:     task.ID,
+		State:  task.State.String,
+		Events: timelineEvents(events, time.Now()),
+	}, nil
+}
+
+// timelineEvents converts events in order to their response form, timing each state up to the next
+// event, or up to now for the current state unless the task has finished
+func timelineEvents(events []persistence.TaskEvent, now time.Time) []*pb.TaskEvent {
+	timeline := make([]*pb.TaskEvent, 0, len(events))
+	for i, event := range events {
+		until := now
+		switch {
+		case i+1 < len(events):
+			until = events[i+1].EventTime
+		case event.NewState == "done" || event.NewState == "failed" || event.NewState == "skipped":
+			until = event.EventTime
+		}
+		timeline = append(timeline, &pb.TaskEvent{
+			OldState:   event.OldState.String,
+			NewState:   event.NewState,
+			Time:       timestamppb.New(event.EventTime),
+			Actor:      event.Actor,
+			Error:      event.Error.String,
+			DurationMs: until.Sub(event.EventTime).Milliseconds(),
+		})
+	}
+	return timeline
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+)
+
+// Overall workflow states reported by GetWorkflowStatus
+const (
+	workflowRunning = "running"
+	workflowDone    = "done"
+	workflowFailed  = "failed"
+)
+
+// SubmitWorkflow stores a DAG of tasks in the "pending" state. The producer's scheduler dispatches
+// each task once all of its parents are done; a failed task causes its descendants to be skipped
+func (s *server) SubmitWorkflow(ctx context.Context, req *pb.WorkflowRequest) (*pb.WorkflowResponse, error) {
+	if err := s.requirePostgres("workflows"); err != nil {
+		return nil, err
+	}
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := validateWorkflow(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	workflowID, taskIDs, err := s.createWorkflow(ctx, namespace, req, order)
+	if err != nil {
+		logger.LogError("Failed to create workflow", err, &logger.LogContext{
+			"workflow_name": req.Name,
+			"namespace":     namespace,
+		})
+		return nil, s.dbError(err)
+	}
+
+	logger.LogInfo("Workflow submitted", &logger.LogContext{
+		"workflow_id":   workflowID,
+		"namespace":     namespace,
+		"workflow_name": req.Name,
+		"tasks":         len(req.Tasks),
+		"edges":         len(req.Edges),
+	})
+
+	return &pb.WorkflowResponse{WorkflowId: workflowID, TaskIds: taskIDs}, nil
+}
+
+// validateWorkflow checks that task keys are unique, that edges connect known tasks and that the
+// graph has no cycles. It returns the tasks in topological order
+func validateWorkflow(req *pb.WorkflowRequest) ([]*pb.WorkflowTask, error) {
+	if len(req.Tasks) == 0 {
+		return nil, errors.New("workflow has no tasks")
+	}
+
+	tasks := make(map[string]*pb.WorkflowTask, len(req.Tasks))
+	for _, task := range req.Tasks {
+		if task.Key == "" {
+			return nil, errors.New("workflow task has an empty key")
+		}
+		if _, ok := tasks[task.Key]; ok {
+			return nil, fmt.Errorf("duplicate workflow task key %q", task.Key)
+		}
+		tasks[task.Key] = task
+	}
+
+	children := make(map[string][]string, len(req.Tasks))
+	parents := make(map[string]int, len(req.Tasks))
+	seen := make(map[[2]string]bool, len(req.Edges))
+	for _, edge := range req.Edges {
+		if _, ok := tasks[edge.Parent]; !ok {
+			return nil, fmt.Errorf("edge references unknown task %q", edge.Parent)
+		}
+		if _, ok := tasks[edge.Child]; !ok {
+			return nil, fmt.Errorf("edge references unknown task %q", edge.Child)
+		}
+		if edge.Parent == edge.Child {
+			return nil, fmt.Errorf("task %q depends on itself", edge.Parent)
+		}
+		if seen[[2]string{edge.Parent, edge.Child}] {
+			continue
+		}
+		seen[[2]string{edge.Parent, edge.Child}] = true
+		children[edge.Parent] = append(children[edge.Parent], edge.Child)
+		parents[edge.Child]++
+	}
+
+	// Kahn's algorithm: anything left unvisited once no task is free of parents sits on a cycle
+	var ready []string
+	for _, task := range req.Tasks {
+		if parents[task.Key] == 0 {
+			ready = append(ready, task.Key)
+		}
+	}
+	order := make([]*pb.WorkflowTask, 0, len(req.Tasks))
+	for len(ready) > 0 {
+		key := ready[0]
+		ready = ready[1:]
+		order = append(order, tasks[key])
+		for _, child := range children[key] {
+			parents[child]--
+			if parents[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+	if len(order) != len(req.Tasks) {
+		return nil, errors.New("workflow contains a cycle")
+	}
+
+	return order, nil
+}
+
+// createWorkflow inserts the workflow, its tasks and their dependencies in a single transaction,
+// so the scheduler never sees a task before the edges that gate it
+func (s *server) createWorkflow(ctx context.Context, namespace string, req *pb.WorkflowRequest, order []*pb.WorkflowTask) (int32, map[string]int32, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	qtx := s.queries.WithTx(tx)
+
+	workflowID, err := qtx.CreateWorkflow(ctx, persistence.CreateWorkflowParams{
+		Name:      req.Name,
+		Namespace: namespace,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	taskIDs := make(map[string]int32, len(order))
+	for _, task := range order {
+		id, err := qtx.CreatePendingTask(ctx, persistence.CreatePendingTaskParams{
+			Type:       sql.NullInt32{Int32: task.Type, Valid: true},
+			Value:      sql.NullInt32{Int32: task.Value, Valid: true},
+			Comment:    sql.NullString{String: task.Comment, Valid: task.Comment != ""},
+			WorkflowID: sql.NullInt32{Int32: workflowID, Valid: true},
+			Namespace:  namespace,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		taskIDs[task.Key] = id
+	}
+
+	seen := make(map[[2]string]bool, len(req.Edges))
+	for _, edge := range req.Edges {
+		if seen[[2]string{edge.Parent, edge.Child}] {
+			continue
+		}
+		seen[[2]string{edge.Parent, edge.Child}] = true
+
+		err := qtx.CreateTaskDependency(ctx, persistence.CreateTaskDependencyParams{
+			TaskID:      taskIDs[edge.Child],
+			DependsOnID: taskIDs[edge.Parent],
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return workflowID, taskIDs, tx.Commit()
+}
+
+// GetWorkflowStatus returns the state of every task in a workflow along with its dependencies
+func (s *server) GetWorkflowStatus(ctx context.Context, req *pb.WorkflowStatusRequest) (*pb.WorkflowStatusResponse, error) {
+	if err := s.requirePostgres("workflows"); err != nil {
+		return nil, err
+	}
+	namespace, err := requestNamespace(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow, err := s.queries.GetWorkflow(ctx, persistence.GetWorkflowParams{
+		ID:        req.WorkflowId,
+		Namespace: namespace,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "workflow %d not found in namespace %q", req.WorkflowId, namespace)
+	}
+	if err != nil {
+		logger.LogError("Failed to get workflow", err, &logger.LogContext{
+			"workflow_id": req.WorkflowId,
+		})
+		return nil, s.dbError(err)
+	}
+
+	workflowID := sql.NullInt32{Int32: workflow.ID, Valid: true}
+	tasks, err := s.queries.ListWorkflowTasks(ctx, workflowID)
+	if err != nil {
+		logger.LogError("Failed to list workflow tasks", err, &logger.LogContext{
+			"workflow_id": req.WorkflowId,
+		})
+		return nil, s.dbError(err)
+	}
+	dependencies, err := s.queries.ListWorkflowDependencies(ctx, workflowID)
+	if err != nil {
+		logger.LogError("Failed to list workflow dependencies", err, &logger.LogContext{
+			"workflow_id": req.WorkflowId,
+		})
+		return nil, s.dbError(err)
+	}
+
+	dependsOn := make(map[int32][]int32, len(tasks))
+	for _, dependency := range dependencies {
+		dependsOn[dependency.TaskID] = append(dependsOn[dependency.TaskID], dependency.DependsOnID)
+	}
+
+	res := &pb.WorkflowStatusResponse{
+		WorkflowId: workflow.ID,
+		Name:       workflow.Name,
+	}
+	for _, task := range tasks {
+		res.Tasks = append(res.Tasks, &pb.WorkflowTaskStatus{
+			Id:        task.ID,
+			Type:      task.Type.Int32,
+			Value:     task.Value.Int32,
+			State:     task.State.String,
+			DependsOn: dependsOn[task.ID],
+		})
+	}
+	res.State = workflowState(tasks)
+
+	return res, nil
+}
+
+// workflowState summarises the task states: failed as soon as any task failed or was skipped,
+// done once every task is done, running otherwise
+func workflowState(tasks []persistence.Task) string {
+	state := workflowDone
+	for _, task := range tasks {
+		switch task.State.String {
+		case "failed", "skipped":
+			return workflowFailed
+		case "done":
+		default:
+			state = workflowRunning
+		}
+	}
+	return state
+}
@@ -0,0 +1,8 @@
+CREATE TABLE task_type_stats (
+                       type INT PRIMARY KEY CHECK (type >= 0 AND type <= 9),
+                       count BIGINT NOT NULL DEFAULT 0,
+                       sum BIGINT NOT NULL DEFAULT 0,
+                       min INT NOT NULL,
+                       max INT NOT NULL,
+                       last_update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+CREATE TABLE rate_limiters (
+                       name TEXT PRIMARY KEY,
+                       tokens DOUBLE PRECISION NOT NULL,
+                       capacity DOUBLE PRECISION NOT NULL,
+                       refill_rate DOUBLE PRECISION NOT NULL,
+                       last_refill_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
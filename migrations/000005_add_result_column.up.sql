@@ -0,0 +1,2 @@
+-- A JSON null marks a task whose handler has not produced a result yet
+ALTER TABLE tasks ADD COLUMN result JSONB NOT NULL DEFAULT 'null';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS tasks_scheduled_run_at_idx;
+
+UPDATE tasks SET state = 'received' WHERE state = 'scheduled';
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_state_check;
+ALTER TABLE tasks ADD CONSTRAINT tasks_state_check CHECK (state IN ('received', 'processing', 'done'));
+
+ALTER TABLE tasks DROP COLUMN run_at;
@@ -0,0 +1,7 @@
+ALTER TABLE tasks ADD COLUMN run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_state_check;
+ALTER TABLE tasks ADD CONSTRAINT tasks_state_check CHECK (state IN ('scheduled', 'received', 'processing', 'done'));
+
+-- Only scheduled tasks are ever looked up by run_at, so keep the index to those
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
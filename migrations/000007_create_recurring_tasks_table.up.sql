@@ -0,0 +1,12 @@
+CREATE TABLE recurring_tasks (
+                       id SERIAL PRIMARY KEY,
+                       name TEXT NOT NULL UNIQUE,
+                       cron_spec TEXT NOT NULL,
+                       type INT NOT NULL CHECK (type >= 0 AND type <= 9),
+                       value INT NOT NULL CHECK (value >= 0 AND value <= 99),
+                       enabled BOOLEAN NOT NULL DEFAULT TRUE,
+                       catch_up BOOLEAN NOT NULL DEFAULT FALSE,
+                       last_fire_time TIMESTAMPTZ,
+                       next_fire_time TIMESTAMPTZ,
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,24 @@
+CREATE TABLE workflows (
+                       id SERIAL PRIMARY KEY,
+                       name TEXT NOT NULL,
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE tasks ADD COLUMN workflow_id INT REFERENCES workflows (id);
+CREATE INDEX tasks_workflow_id_idx ON tasks (workflow_id) WHERE workflow_id IS NOT NULL;
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_state_check;
+ALTER TABLE tasks ADD CONSTRAINT tasks_state_check CHECK (state IN ('pending', 'scheduled', 'received', 'processing', 'done', 'failed', 'skipped'));
+
+-- Pending tasks are polled for readiness, so keep the index to those
+CREATE INDEX tasks_pending_idx ON tasks (id) WHERE state = 'pending';
+
+-- A task is dispatched once every task it depends on is done
+CREATE TABLE task_dependencies (
+                       task_id INT NOT NULL,
+                       depends_on_id INT NOT NULL,
+                       PRIMARY KEY (task_id, depends_on_id),
+                       CHECK (task_id <> depends_on_id)
+);
+
+CREATE INDEX task_dependencies_depends_on_id_idx ON task_dependencies (depends_on_id);
@@ -0,0 +1,18 @@
+ALTER TABLE recurring_tasks DROP COLUMN namespace;
+
+ALTER TABLE workflows DROP COLUMN namespace;
+
+-- Per-namespace aggregates cannot be merged in place, so recompute one row per type from the tasks
+DELETE FROM task_type_stats;
+ALTER TABLE task_type_stats DROP CONSTRAINT task_type_stats_pkey;
+ALTER TABLE task_type_stats DROP COLUMN namespace;
+ALTER TABLE task_type_stats ADD PRIMARY KEY (type);
+
+INSERT INTO task_type_stats (type, count, sum, min, max)
+SELECT type, COUNT(*), SUM(value), MIN(value), MAX(value)
+FROM tasks
+WHERE state = 'done' AND type IS NOT NULL AND value IS NOT NULL
+GROUP BY type;
+
+DROP INDEX IF EXISTS tasks_namespace_state_idx;
+ALTER TABLE tasks DROP COLUMN namespace;
@@ -0,0 +1,13 @@
+-- Every task belongs to a namespace so several teams can share one deployment
+ALTER TABLE tasks ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX tasks_namespace_state_idx ON tasks (namespace, state);
+
+-- Aggregates are kept per namespace and type
+ALTER TABLE task_type_stats ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE task_type_stats DROP CONSTRAINT task_type_stats_pkey;
+ALTER TABLE task_type_stats ADD PRIMARY KEY (namespace, type);
+
+ALTER TABLE workflows ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+
+-- Recurring definitions create their tasks in their own namespace
+ALTER TABLE recurring_tasks ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
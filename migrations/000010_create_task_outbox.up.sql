@@ -0,0 +1,16 @@
+-- Every dispatch is recorded in the same transaction that makes the task "received", and the
+-- producer's relay retries entries until the consumer has seen them
+CREATE TABLE task_outbox (
+                       id SERIAL PRIMARY KEY,
+                       task_id INT NOT NULL,
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'sent', 'dead')),
+                       attempts INT NOT NULL DEFAULT 0,
+                       next_attempt_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       last_error TEXT,
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       sent_time TIMESTAMPTZ
+);
+
+-- The relay only polls undelivered entries, so keep the index to those
+CREATE INDEX task_outbox_pending_idx ON task_outbox (next_attempt_time) WHERE state = 'pending';
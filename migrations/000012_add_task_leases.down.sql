@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_processing_lease_expiry_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS lease_expiry;
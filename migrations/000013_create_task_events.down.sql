@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS tasks_record_event ON tasks;
+DROP FUNCTION IF EXISTS record_task_event();
+DROP INDEX IF EXISTS task_events_task_id_idx;
+DROP TABLE IF EXISTS task_events;
@@ -0,0 +1,33 @@
+-- Every state a task enters is recorded by a trigger, so no query can forget to; the actor is the
+-- application_name of the connection, which the producer and consumer set to their instance name
+CREATE TABLE task_events (
+                       id BIGSERIAL PRIMARY KEY,
+                       task_id INT NOT NULL,
+                       old_state TEXT,
+                       new_state TEXT NOT NULL,
+                       event_time TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+                       actor TEXT NOT NULL DEFAULT '',
+                       error TEXT
+);
+
+CREATE INDEX task_events_task_id_idx ON task_events (task_id, id);
+
+CREATE OR REPLACE FUNCTION record_task_event() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.state IS DISTINCT FROM OLD.state THEN
+        INSERT INTO task_events (task_id, old_state, new_state, actor, error)
+        VALUES (
+            NEW.id,
+            CASE WHEN TG_OP = 'UPDATE' THEN OLD.state END,
+            NEW.state,
+            current_setting('application_name'),
+            CASE WHEN NEW.state = 'failed' THEN NEW.result->>'error' END
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_record_event
+    AFTER INSERT OR UPDATE OF state ON tasks
+    FOR EACH ROW EXECUTE FUNCTION record_task_event();
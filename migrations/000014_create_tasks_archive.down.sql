@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_state_last_update_time_idx;
+DROP TABLE IF EXISTS tasks_archive;
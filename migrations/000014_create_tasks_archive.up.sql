@@ -0,0 +1,18 @@
+-- The retention janitor moves expired tasks here when configured to archive rather than delete them
+CREATE TABLE tasks_archive (
+                       id INT PRIMARY KEY,
+                       type INT,
+                       value INT,
+                       state TEXT,
+                       creation_time TIMESTAMPTZ,
+                       last_update_time TIMESTAMPTZ,
+                       comment TEXT,
+                       result JSONB NOT NULL DEFAULT 'null',
+                       run_at TIMESTAMPTZ NOT NULL,
+                       workflow_id INT,
+                       namespace TEXT NOT NULL,
+                       archive_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The janitor looks for finished tasks by how long ago they last changed
+CREATE INDEX tasks_state_last_update_time_idx ON tasks (state, last_update_time);
@@ -0,0 +1,45 @@
+-- Turns the partitioned tasks table back into a plain one, copying the tasks of every partition
+
+ALTER TABLE tasks RENAME TO tasks_partitioned;
+DROP TRIGGER tasks_record_event ON tasks_partitioned;
+DROP TRIGGER tasks_check_id_unique ON tasks_partitioned;
+DROP FUNCTION check_task_id_unique();
+DROP INDEX tasks_scheduled_run_at_idx, tasks_workflow_id_idx, tasks_pending_idx, tasks_received_idx,
+    tasks_namespace_state_idx, tasks_state_last_update_time_idx, tasks_processing_lease_expiry_idx;
+ALTER TABLE tasks_partitioned DROP CONSTRAINT tasks_pkey;
+
+CREATE TABLE tasks (
+                       id INT PRIMARY KEY DEFAULT nextval('tasks_id_seq'),
+                       type INT CHECK (type >= 0 AND type <= 9),
+                       value INT CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('pending', 'scheduled', 'received', 'processing', 'done', 'failed', 'skipped')),
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       last_update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       comment TEXT,
+                       result JSONB NOT NULL DEFAULT 'null',
+                       run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       workflow_id INT REFERENCES workflows (id),
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       lease_expiry TIMESTAMPTZ
+);
+
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+INSERT INTO tasks (id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry
+FROM tasks_partitioned;
+
+-- Drops every partition along with it
+DROP TABLE tasks_partitioned;
+
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
+CREATE INDEX tasks_workflow_id_idx ON tasks (workflow_id) WHERE workflow_id IS NOT NULL;
+CREATE INDEX tasks_pending_idx ON tasks (id) WHERE state = 'pending';
+CREATE INDEX tasks_received_idx ON tasks (id) WHERE state = 'received';
+CREATE INDEX tasks_namespace_state_idx ON tasks (namespace, state);
+CREATE INDEX tasks_state_last_update_time_idx ON tasks (state, last_update_time);
+CREATE INDEX tasks_processing_lease_expiry_idx ON tasks (lease_expiry) WHERE state = 'processing';
+
+CREATE TRIGGER tasks_record_event
+    AFTER INSERT OR UPDATE OF state ON tasks
+    FOR EACH ROW EXECUTE FUNCTION record_task_event();
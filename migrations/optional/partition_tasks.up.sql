@@ -0,0 +1,89 @@
+-- Optional, outside the numbered sequence: turns tasks into a table range-partitioned by day on creation_time,
+-- so that expired days can be dropped whole rather than deleted row by row. Apply it after 000014 with
+--   go run scripts/migrate/migrate.go optional/partition_tasks.up.sql
+-- then run `go run scripts/migrate/migrate.go partitions` to create upcoming partitions and drop expired ones, either
+-- daily or as a long-running process with partitions.interval_ms set in configs/migrate.<env>.config.yaml.
+-- The existing tasks are copied, so apply it while the services are stopped.
+
+ALTER TABLE tasks RENAME TO tasks_unpartitioned;
+DROP TRIGGER tasks_record_event ON tasks_unpartitioned;
+ALTER TABLE tasks_unpartitioned DROP CONSTRAINT tasks_pkey;
+DROP INDEX tasks_scheduled_run_at_idx, tasks_workflow_id_idx, tasks_pending_idx, tasks_received_idx,
+    tasks_namespace_state_idx, tasks_state_last_update_time_idx, tasks_processing_lease_expiry_idx;
+
+-- The partition key has to be part of the primary key, and so can no longer be NULL. The key then no longer
+-- keeps id unique on its own, which tasks_check_id_unique below takes over.
+CREATE TABLE tasks (
+                       id INT NOT NULL DEFAULT nextval('tasks_id_seq'),
+                       type INT CHECK (type >= 0 AND type <= 9),
+                       value INT CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('pending', 'scheduled', 'received', 'processing', 'done', 'failed', 'skipped')),
+                       creation_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       last_update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       comment TEXT,
+                       result JSONB NOT NULL DEFAULT 'null',
+                       run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       workflow_id INT REFERENCES workflows (id),
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       lease_expiry TIMESTAMPTZ,
+                       PRIMARY KEY (id, creation_time)
+) PARTITION BY RANGE (creation_time);
+
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+-- Tasks created before today share tasks_history, which the janitor drains; every day from today on
+-- gets its own tasks_pYYYYMMDD partition. tasks_default catches rows no partition was created for.
+DO $$
+DECLARE
+    today TIMESTAMPTZ := date_trunc('day', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+BEGIN
+    EXECUTE format('CREATE TABLE tasks_history PARTITION OF tasks FOR VALUES FROM (MINVALUE) TO (%L)', today);
+    EXECUTE format('CREATE TABLE %I PARTITION OF tasks FOR VALUES FROM (%L) TO (%L)',
+        'tasks_p' || to_char(today AT TIME ZONE 'UTC', 'YYYYMMDD'), today, today + INTERVAL '1 day');
+END $$;
+
+CREATE TABLE tasks_default PARTITION OF tasks DEFAULT;
+
+-- Tasks created before the creation_time column had a default carry no creation time
+INSERT INTO tasks (id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry)
+SELECT id, type, value, state, COALESCE(creation_time, last_update_time, CURRENT_TIMESTAMP), last_update_time,
+       comment, result, run_at, workflow_id, namespace, lease_expiry
+FROM tasks_unpartitioned;
+
+DROP TABLE tasks_unpartitioned;
+
+-- Indexes created on tasks are created on every partition, present and future
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
+CREATE INDEX tasks_workflow_id_idx ON tasks (workflow_id) WHERE workflow_id IS NOT NULL;
+CREATE INDEX tasks_pending_idx ON tasks (id) WHERE state = 'pending';
+CREATE INDEX tasks_received_idx ON tasks (id) WHERE state = 'received';
+CREATE INDEX tasks_namespace_state_idx ON tasks (namespace, state);
+CREATE INDEX tasks_state_last_update_time_idx ON tasks (state, last_update_time);
+CREATE INDEX tasks_processing_lease_expiry_idx ON tasks (lease_expiry) WHERE state = 'processing';
+
+-- Tasks are looked up by id alone, so id has to stay unique across partitions. Ids come from the global
+-- tasks_id_seq; this refuses any other id that a task of any partition already has. The advisory lock
+-- serialises inserts of the same id, so concurrent ones see each other. Nothing updates creation_time, so
+-- tasks never move between partitions, which would be seen as inserting an id that already exists.
+CREATE FUNCTION check_task_id_unique() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.id = OLD.id THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_advisory_xact_lock(hashtext('tasks.id'), NEW.id);
+    IF EXISTS (SELECT 1 FROM tasks WHERE id = NEW.id) THEN
+        RAISE EXCEPTION 'duplicate task id %', NEW.id USING ERRCODE = 'unique_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Created after the copy, whose ids were unique in the unpartitioned table
+CREATE TRIGGER tasks_check_id_unique
+    BEFORE INSERT OR UPDATE OF id ON tasks
+    FOR EACH ROW EXECUTE FUNCTION check_task_id_unique();
+
+-- Created after the copy, which would otherwise record every existing task as newly inserted
+CREATE TRIGGER tasks_record_event
+    AFTER INSERT OR UPDATE OF state ON tasks
+    FOR EACH ROW EXECUTE FUNCTION record_task_event();
@@ -0,0 +1,10 @@
+-- SQLite equivalent of migrations/000001_create_tasks_table.up.sql. Timestamps are UTC text with millisecond
+-- precision, which the driver reads back as time.Time
+CREATE TABLE tasks (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       type INTEGER CHECK (type >= 0 AND type <= 9),
+                       value INTEGER CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('received', 'processing', 'done')),
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
@@ -0,0 +1,8 @@
+CREATE TABLE task_type_stats (
+                       type INTEGER PRIMARY KEY CHECK (type >= 0 AND type <= 9),
+                       count INTEGER NOT NULL DEFAULT 0,
+                       sum INTEGER NOT NULL DEFAULT 0,
+                       min INTEGER NOT NULL,
+                       max INTEGER NOT NULL,
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
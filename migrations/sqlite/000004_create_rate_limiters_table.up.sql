@@ -0,0 +1,7 @@
+CREATE TABLE rate_limiters (
+                       name TEXT PRIMARY KEY,
+                       tokens REAL NOT NULL,
+                       capacity REAL NOT NULL,
+                       refill_rate REAL NOT NULL,
+                       last_refill_time TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
@@ -0,0 +1,2 @@
+-- A JSON null marks a task whose handler has not produced a result yet; SQLite keeps JSON as checked text
+ALTER TABLE tasks ADD COLUMN result TEXT NOT NULL DEFAULT 'null' CHECK (json_valid(result));
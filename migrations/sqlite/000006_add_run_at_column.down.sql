@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS tasks_scheduled_run_at_idx;
+
+UPDATE tasks SET state = 'received' WHERE state = 'scheduled';
+
+CREATE TABLE tasks_new (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       type INTEGER CHECK (type >= 0 AND type <= 9),
+                       value INTEGER CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('received', 'processing', 'done')),
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       comment TEXT,
+                       result TEXT NOT NULL DEFAULT 'null' CHECK (json_valid(result))
+);
+INSERT INTO tasks_new (id, type, value, state, creation_time, last_update_time, comment, result)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
@@ -0,0 +1,19 @@
+-- SQLite can neither add a column with a non-constant default nor change a CHECK constraint, so tasks is rebuilt
+CREATE TABLE tasks_new (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       type INTEGER CHECK (type >= 0 AND type <= 9),
+                       value INTEGER CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('scheduled', 'received', 'processing', 'done')),
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       comment TEXT,
+                       result TEXT NOT NULL DEFAULT 'null' CHECK (json_valid(result)),
+                       run_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+INSERT INTO tasks_new (id, type, value, state, creation_time, last_update_time, comment, result)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+
+-- Only scheduled tasks are ever looked up by run_at, so keep the index to those
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
@@ -0,0 +1,12 @@
+CREATE TABLE recurring_tasks (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       name TEXT NOT NULL UNIQUE,
+                       cron_spec TEXT NOT NULL,
+                       type INTEGER NOT NULL CHECK (type >= 0 AND type <= 9),
+                       value INTEGER NOT NULL CHECK (value >= 0 AND value <= 99),
+                       enabled BOOLEAN NOT NULL DEFAULT TRUE,
+                       catch_up BOOLEAN NOT NULL DEFAULT FALSE,
+                       last_fire_time TIMESTAMP,
+                       next_fire_time TIMESTAMP,
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
@@ -0,0 +1,34 @@
+-- Before workflows a task could not end unsuccessfully, so there is no state left to keep failed and skipped
+-- tasks in. Refuse to run rather than rewrite their history: archive or delete them first.
+-- SQLite has no procedural blocks, so the check fails a constraint instead.
+CREATE TEMP TABLE IF NOT EXISTS revert_workflows_guard (
+                       failed_or_skipped_tasks INTEGER CONSTRAINT no_failed_or_skipped_tasks CHECK (failed_or_skipped_tasks = 0)
+);
+INSERT INTO revert_workflows_guard SELECT COUNT(*) FROM tasks WHERE state IN ('failed', 'skipped');
+DROP TABLE revert_workflows_guard;
+
+DROP TABLE IF EXISTS task_dependencies;
+
+DROP INDEX IF EXISTS tasks_pending_idx;
+DROP INDEX IF EXISTS tasks_workflow_id_idx;
+UPDATE tasks SET state = 'received' WHERE state = 'pending';
+
+CREATE TABLE tasks_new (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       type INTEGER CHECK (type >= 0 AND type <= 9),
+                       value INTEGER CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('scheduled', 'received', 'processing', 'done')),
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       comment TEXT,
+                       result TEXT NOT NULL DEFAULT 'null' CHECK (json_valid(result)),
+                       run_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+INSERT INTO tasks_new (id, type, value, state, creation_time, last_update_time, comment, result, run_at)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
+
+DROP TABLE IF EXISTS workflows;
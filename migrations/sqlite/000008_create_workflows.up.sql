@@ -0,0 +1,39 @@
+CREATE TABLE workflows (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       name TEXT NOT NULL,
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+-- The state CHECK constraint changes, so tasks is rebuilt
+CREATE TABLE tasks_new (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       type INTEGER CHECK (type >= 0 AND type <= 9),
+                       value INTEGER CHECK (value >= 0 AND value <= 99),
+                       state TEXT CHECK (state IN ('pending', 'scheduled', 'received', 'processing', 'done', 'failed', 'skipped')),
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       comment TEXT,
+                       result TEXT NOT NULL DEFAULT 'null' CHECK (json_valid(result)),
+                       run_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       workflow_id INTEGER REFERENCES workflows (id)
+);
+INSERT INTO tasks_new (id, type, value, state, creation_time, last_update_time, comment, result, run_at)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
+CREATE INDEX tasks_workflow_id_idx ON tasks (workflow_id) WHERE workflow_id IS NOT NULL;
+
+-- Pending tasks are polled for readiness, so keep the index to those
+CREATE INDEX tasks_pending_idx ON tasks (id) WHERE state = 'pending';
+
+-- A task is dispatched once every task it depends on is done
+CREATE TABLE task_dependencies (
+                       task_id INTEGER NOT NULL,
+                       depends_on_id INTEGER NOT NULL,
+                       PRIMARY KEY (task_id, depends_on_id),
+                       CHECK (task_id <> depends_on_id)
+);
+
+CREATE INDEX task_dependencies_depends_on_id_idx ON task_dependencies (depends_on_id);
@@ -0,0 +1,23 @@
+ALTER TABLE recurring_tasks DROP COLUMN namespace;
+
+ALTER TABLE workflows DROP COLUMN namespace;
+
+-- Per-namespace aggregates cannot be merged in place, so recompute one row per type from the tasks
+DROP TABLE task_type_stats;
+CREATE TABLE task_type_stats (
+                       type INTEGER PRIMARY KEY CHECK (type >= 0 AND type <= 9),
+                       count INTEGER NOT NULL DEFAULT 0,
+                       sum INTEGER NOT NULL DEFAULT 0,
+                       min INTEGER NOT NULL,
+                       max INTEGER NOT NULL,
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+INSERT INTO task_type_stats (type, count, sum, min, max)
+SELECT type, COUNT(*), SUM(value), MIN(value), MAX(value)
+FROM tasks
+WHERE state = 'done' AND type IS NOT NULL AND value IS NOT NULL
+GROUP BY type;
+
+DROP INDEX IF EXISTS tasks_namespace_state_idx;
+ALTER TABLE tasks DROP COLUMN namespace;
@@ -0,0 +1,24 @@
+-- Every task belongs to a namespace so several teams can share one deployment
+ALTER TABLE tasks ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX tasks_namespace_state_idx ON tasks (namespace, state);
+
+-- Aggregates are kept per namespace and type; SQLite cannot change a primary key, so the table is rebuilt
+CREATE TABLE task_type_stats_new (
+                       type INTEGER CHECK (type >= 0 AND type <= 9),
+                       count INTEGER NOT NULL DEFAULT 0,
+                       sum INTEGER NOT NULL DEFAULT 0,
+                       min INTEGER NOT NULL,
+                       max INTEGER NOT NULL,
+                       last_update_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       PRIMARY KEY (namespace, type)
+);
+INSERT INTO task_type_stats_new (type, count, sum, min, max, last_update_time)
+SELECT type, count, sum, min, max, last_update_time FROM task_type_stats;
+DROP TABLE task_type_stats;
+ALTER TABLE task_type_stats_new RENAME TO task_type_stats;
+
+ALTER TABLE workflows ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+
+-- Recurring definitions create their tasks in their own namespace
+ALTER TABLE recurring_tasks ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS task_outbox_pending_idx;
+DROP TABLE IF EXISTS task_outbox;
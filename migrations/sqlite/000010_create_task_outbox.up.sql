@@ -0,0 +1,14 @@
+-- The outbox is only used by the gRPC transport of the postgres driver; it is created so the schemas match
+CREATE TABLE task_outbox (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       task_id INTEGER NOT NULL,
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'sent', 'dead')),
+                       attempts INTEGER NOT NULL DEFAULT 0,
+                       next_attempt_time TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       last_error TEXT,
+                       creation_time TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       sent_time TIMESTAMP
+);
+
+CREATE INDEX task_outbox_pending_idx ON task_outbox (next_attempt_time) WHERE state = 'pending';
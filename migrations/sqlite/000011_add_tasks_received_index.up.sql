@@ -0,0 +1,2 @@
+-- Consumers on the notify transport claim received tasks straight from the table, so keep the index to those
+CREATE INDEX tasks_received_idx ON tasks (id) WHERE state = 'received';
@@ -0,0 +1,5 @@
+-- A task is leased to the consumer processing it until lease_expiry. A task still processing once its
+-- lease expired, e.g. because its consumer crashed, is claimed or delivered again.
+ALTER TABLE tasks ADD COLUMN lease_expiry TIMESTAMP;
+
+CREATE INDEX tasks_processing_lease_expiry_idx ON tasks (lease_expiry) WHERE state = 'processing';
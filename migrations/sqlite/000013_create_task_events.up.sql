@@ -0,0 +1,26 @@
+-- Every state a task enters is recorded by triggers, as on Postgres. SQLite connections have no
+-- application_name, so the actor is left empty
+CREATE TABLE task_events (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       task_id INTEGER NOT NULL,
+                       old_state TEXT,
+                       new_state TEXT NOT NULL,
+                       event_time TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                       actor TEXT NOT NULL DEFAULT '',
+                       error TEXT
+);
+
+CREATE INDEX task_events_task_id_idx ON task_events (task_id, id);
+
+CREATE TRIGGER tasks_record_insert_event AFTER INSERT ON tasks
+BEGIN
+    INSERT INTO task_events (task_id, old_state, new_state, error)
+    VALUES (NEW.id, NULL, NEW.state, CASE WHEN NEW.state = 'failed' THEN NEW.result ->> 'error' END);
+END;
+
+CREATE TRIGGER tasks_record_update_event AFTER UPDATE OF state ON tasks
+    WHEN NEW.state IS NOT OLD.state
+BEGIN
+    INSERT INTO task_events (task_id, old_state, new_state, error)
+    VALUES (NEW.id, OLD.state, NEW.state, CASE WHEN NEW.state = 'failed' THEN NEW.result ->> 'error' END);
+END;
@@ -0,0 +1,18 @@
+-- The retention janitor moves expired tasks here when configured to archive rather than delete them
+CREATE TABLE tasks_archive (
+                       id INTEGER PRIMARY KEY,
+                       type INTEGER,
+                       value INTEGER,
+                       state TEXT,
+                       creation_time TIMESTAMP,
+                       last_update_time TIMESTAMP,
+                       comment TEXT,
+                       result TEXT NOT NULL DEFAULT 'null' CHECK (json_valid(result)),
+                       run_at TIMESTAMP NOT NULL,
+                       workflow_id INTEGER,
+                       namespace TEXT NOT NULL,
+                       archive_time TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+-- The janitor looks for finished tasks by how long ago they last changed
+CREATE INDEX tasks_state_last_update_time_idx ON tasks (state, last_update_time);
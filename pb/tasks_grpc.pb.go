@@ -19,7 +19,13 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TaskService_SendTask_FullMethodName = "/pb.TaskService/SendTask"
+	TaskService_SendTask_FullMethodName             = "/pb.TaskService/SendTask"
+	TaskService_GetTaskTypeStats_FullMethodName     = "/pb.TaskService/GetTaskTypeStats"
+	TaskService_RebuildTaskTypeStats_FullMethodName = "/pb.TaskService/RebuildTaskTypeStats"
+	TaskService_GetTaskResult_FullMethodName        = "/pb.TaskService/GetTaskResult"
+	TaskService_SubmitWorkflow_FullMethodName       = "/pb.TaskService/SubmitWorkflow"
+	TaskService_GetWorkflowStatus_FullMethodName    = "/pb.TaskService/GetWorkflowStatus"
+	TaskService_GetTaskTimeline_FullMethodName      = "/pb.TaskService/GetTaskTimeline"
 )
 
 // TaskServiceClient is the client API for TaskService service.
@@ -27,6 +33,12 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TaskServiceClient interface {
 	SendTask(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskResponse, error)
+	GetTaskTypeStats(ctx context.Context, in *TaskTypeStatsRequest, opts ...grpc.CallOption) (*TaskTypeStatsResponse, error)
+	RebuildTaskTypeStats(ctx context.Context, in *RebuildTaskTypeStatsRequest, opts ...grpc.CallOption) (*TaskTypeStatsResponse, error)
+	GetTaskResult(ctx context.Context, in *TaskResultRequest, opts ...grpc.CallOption) (*TaskResultResponse, error)
+	SubmitWorkflow(ctx context.Context, in *WorkflowRequest, opts ...grpc.CallOption) (*WorkflowResponse, error)
+	GetWorkflowStatus(ctx context.Context, in *WorkflowStatusRequest, opts ...grpc.CallOption) (*WorkflowStatusResponse, error)
+	GetTaskTimeline(ctx context.Context, in *TaskTimelineRequest, opts ...grpc.CallOption) (*TaskTimelineResponse, error)
 }
 
 type taskServiceClient struct {
@@ -47,11 +59,77 @@ func (c *taskServiceClient) SendTask(ctx context.Context, in *TaskRequest, opts
 	return out, nil
 }
 
+func (c *taskServiceClient) GetTaskTypeStats(ctx context.Context, in *TaskTypeStatsRequest, opts ...grpc.CallOption) (*TaskTypeStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TaskTypeStatsResponse)
+	err := c.cc.Invoke(ctx, TaskService_GetTaskTypeStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) RebuildTaskTypeStats(ctx context.Context, in *RebuildTaskTypeStatsRequest, opts ...grpc.CallOption) (*TaskTypeStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TaskTypeStatsResponse)
+	err := c.cc.Invoke(ctx, TaskService_RebuildTaskTypeStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) GetTaskResult(ctx context.Context, in *TaskResultRequest, opts ...grpc.CallOption) (*TaskResultResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TaskResultResponse)
+	err := c.cc.Invoke(ctx, TaskService_GetTaskResult_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) SubmitWorkflow(ctx context.Context, in *WorkflowRequest, opts ...grpc.CallOption) (*WorkflowResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkflowResponse)
+	err := c.cc.Invoke(ctx, TaskService_SubmitWorkflow_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) GetWorkflowStatus(ctx context.Context, in *WorkflowStatusRequest, opts ...grpc.CallOption) (*WorkflowStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkflowStatusResponse)
+	err := c.cc.Invoke(ctx, TaskService_GetWorkflowStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskServiceClient) GetTaskTimeline(ctx context.Context, in *TaskTimelineRequest, opts ...grpc.CallOption) (*TaskTimelineResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TaskTimelineResponse)
+	err := c.cc.Invoke(ctx, TaskService_GetTaskTimeline_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TaskServiceServer is the server API for TaskService service.
 // All implementations must embed UnimplementedTaskServiceServer
 // for forward compatibility.
 type TaskServiceServer interface {
 	SendTask(context.Context, *TaskRequest) (*TaskResponse, error)
+	GetTaskTypeStats(context.Context, *TaskTypeStatsRequest) (*TaskTypeStatsResponse, error)
+	RebuildTaskTypeStats(context.Context, *RebuildTaskTypeStatsRequest) (*TaskTypeStatsResponse, error)
+	GetTaskResult(context.Context, *TaskResultRequest) (*TaskResultResponse, error)
+	SubmitWorkflow(context.Context, *WorkflowRequest) (*WorkflowResponse, error)
+	GetWorkflowStatus(context.Context, *WorkflowStatusRequest) (*WorkflowStatusResponse, error)
+	GetTaskTimeline(context.Context, *TaskTimelineRequest) (*TaskTimelineResponse, error)
 	mustEmbedUnimplementedTaskServiceServer()
 }
 
@@ -65,6 +143,24 @@ type UnimplementedTaskServiceServer struct{}
 func (UnimplementedTaskServiceServer) SendTask(context.Context, *TaskRequest) (*TaskResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendTask not implemented")
 }
+func (UnimplementedTaskServiceServer) GetTaskTypeStats(context.Context, *TaskTypeStatsRequest) (*TaskTypeStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTaskTypeStats not implemented")
+}
+func (UnimplementedTaskServiceServer) RebuildTaskTypeStats(context.Context, *RebuildTaskTypeStatsRequest) (*TaskTypeStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RebuildTaskTypeStats not implemented")
+}
+func (UnimplementedTaskServiceServer) GetTaskResult(context.Context, *TaskResultRequest) (*TaskResultResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTaskResult not implemented")
+}
+func (UnimplementedTaskServiceServer) SubmitWorkflow(context.Context, *WorkflowRequest) (*WorkflowResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitWorkflow not implemented")
+}
+func (UnimplementedTaskServiceServer) GetWorkflowStatus(context.Context, *WorkflowStatusRequest) (*WorkflowStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWorkflowStatus not implemented")
+}
+func (UnimplementedTaskServiceServer) GetTaskTimeline(context.Context, *TaskTimelineRequest) (*TaskTimelineResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTaskTimeline not implemented")
+}
 func (UnimplementedTaskServiceServer) mustEmbedUnimplementedTaskServiceServer() {}
 func (UnimplementedTaskServiceServer) testEmbeddedByValue()                     {}
 
@@ -104,6 +200,114 @@ func _TaskService_SendTask_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TaskService_GetTaskTypeStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskTypeStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).GetTaskTypeStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_GetTaskTypeStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).GetTaskTypeStats(ctx, req.(*TaskTypeStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_RebuildTaskTypeStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RebuildTaskTypeStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).RebuildTaskTypeStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_RebuildTaskTypeStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).RebuildTaskTypeStats(ctx, req.(*RebuildTaskTypeStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_GetTaskResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).GetTaskResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_GetTaskResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).GetTaskResult(ctx, req.(*TaskResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_SubmitWorkflow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkflowRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).SubmitWorkflow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_SubmitWorkflow_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).SubmitWorkflow(ctx, req.(*WorkflowRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_GetWorkflowStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkflowStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).GetWorkflowStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_GetWorkflowStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).GetWorkflowStatus(ctx, req.(*WorkflowStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskService_GetTaskTimeline_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskTimelineRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskServiceServer).GetTaskTimeline(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskService_GetTaskTimeline_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskServiceServer).GetTaskTimeline(ctx, req.(*TaskTimelineRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TaskService_ServiceDesc is the grpc.ServiceDesc for TaskService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +319,30 @@ var TaskService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendTask",
 			Handler:    _TaskService_SendTask_Handler,
 		},
+		{
+			MethodName: "GetTaskTypeStats",
+			Handler:    _TaskService_GetTaskTypeStats_Handler,
+		},
+		{
+			MethodName: "RebuildTaskTypeStats",
+			Handler:    _TaskService_RebuildTaskTypeStats_Handler,
+		},
+		{
+			MethodName: "GetTaskResult",
+			Handler:    _TaskService_GetTaskResult_Handler,
+		},
+		{
+			MethodName: "SubmitWorkflow",
+			Handler:    _TaskService_SubmitWorkflow_Handler,
+		},
+		{
+			MethodName: "GetWorkflowStatus",
+			Handler:    _TaskService_GetWorkflowStatus_Handler,
+		},
+		{
+			MethodName: "GetTaskTimeline",
+			Handler:    _TaskService_GetTaskTimeline_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/tasks.proto",
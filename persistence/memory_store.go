@@ -0,0 +1,224 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errCheckViolation is returned for a task the CHECK constraints of the tasks table would reject
+var errCheckViolation = errors.New("violates check constraint of tasks")
+
+// taskTypeKey identifies the stats of a task type
+type taskTypeKey struct {
+	namespace string
+	taskType  int32
+}
+
+// MemoryStore is a TaskStore held in memory, for tests and runs without a database. It applies the
+// constraints of the tasks table, and is safe for concurrent use. It has no workflows, so failing a
+// task skips nothing, and no transactions, so its writes apply at once.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int32
+	tasks  map[int32]Task
+	stats  map[taskTypeKey]TaskTypeStat
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks: make(map[int32]Task),
+		stats: make(map[taskTypeKey]TaskTypeStat),
+	}
+}
+
+// WithTx returns the store itself: a MemoryStore cannot join a transaction, so it is not rolled back with tx
+func (s *MemoryStore) WithTx(_ *sql.Tx) TaskStore {
+	return s
+}
+
+func (s *MemoryStore) CreateTask(_ context.Context, arg CreateTaskParams) (int32, error) {
+	return s.insert(arg.Type, arg.Value, "received", arg.Comment, time.Time{}, arg.Namespace)
+}
+
+func (s *MemoryStore) ScheduleTask(_ context.Context, arg ScheduleTaskParams) (int32, error) {
+	return s.insert(arg.Type, arg.Value, "scheduled", arg.Comment, arg.RunAt, arg.Namespace)
+}
+
+// insert stores a new task in a state, due at runAt or else right away
+func (s *MemoryStore) insert(taskType sql.NullInt32, value sql.NullInt32, state string, comment sql.NullString, runAt time.Time, namespace string) (int32, error) {
+	if taskType.Valid && (taskType.Int32 < 0 || taskType.Int32 > 9) {
+		return 0, fmt.Errorf("type %d %w", taskType.Int32, errCheckViolation)
+	}
+	if value.Valid && (value.Int32 < 0 || value.Int32 > 99) {
+		return 0, fmt.Errorf("value %d %w", value.Int32, errCheckViolation)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	now := time.Now()
+	if runAt.IsZero() {
+		runAt = now
+	}
+	s.tasks[s.nextID] = Task{
+		ID:             s.nextID,
+		Type:           taskType,
+		Value:          value,
+		State:          sql.NullString{String: state, Valid: true},
+		CreationTime:   sql.NullTime{Time: now, Valid: true},
+		LastUpdateTime: sql.NullTime{Time: now, Valid: true},
+		Comment:        comment,
+		Result:         json.RawMessage("null"),
+		RunAt:          runAt,
+		Namespace:      namespace,
+	}
+	return s.nextID, nil
+}
+
+func (s *MemoryStore) GetTask(_ context.Context, arg GetTaskByIDParams) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[arg.ID]
+	if !ok || task.Namespace != arg.Namespace {
+		return Task{}, sql.ErrNoRows
+	}
+	return cloneTask(task), nil
+}
+
+func (s *MemoryStore) ListTasks(_ context.Context, arg GetTasksByStateParams) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tasks []Task
+	for _, task := range s.tasks {
+		// Like the query, a NULL state matches no task
+		if arg.State.Valid && task.State == arg.State && task.Namespace == arg.Namespace {
+			tasks = append(tasks, cloneTask(task))
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks, nil
+}
+
+func (s *MemoryStore) StartTask(_ context.Context, arg MarkTaskProcessingParams) (sql.NullTime, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[arg.ID]
+	if !ok || task.Namespace != arg.Namespace || task.State.String != "received" {
+		return sql.NullTime{}, sql.ErrNoRows
+	}
+	task.LeaseExpiry = arg.LeaseExpiry
+	s.setState(task, "processing", task.Result)
+	return task.CreationTime, nil
+}
+
+func (s *MemoryStore) CompleteTask(_ context.Context, arg CompleteTaskParams) (TaskTypeStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[arg.ID]
+	if !ok || !holdsLease(task, arg.LeaseExpiry) {
+		return TaskTypeStat{}, sql.ErrNoRows
+	}
+	s.setState(task, "done", arg.Result)
+	if !task.Type.Valid || !task.Value.Valid {
+		return TaskTypeStat{}, nil
+	}
+
+	taskType, value := task.Type.Int32, task.Value.Int32
+	key := taskTypeKey{namespace: task.Namespace, taskType: taskType}
+	stats, ok := s.stats[key]
+	if !ok {
+		stats = TaskTypeStat{Type: taskType, Min: value, Max: value, Namespace: task.Namespace}
+	}
+	stats.Count++
+	stats.Sum += int64(value)
+	stats.Min = min(stats.Min, value)
+	stats.Max = max(stats.Max, value)
+	stats.LastUpdateTime = sql.NullTime{Time: time.Now(), Valid: true}
+	s.stats[key] = stats
+	return stats, nil
+}
+
+func (s *MemoryStore) FailTask(_ context.Context, arg FailTaskParams) ([]int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[arg.ID]
+	if !ok || !holdsLease(task, arg.LeaseExpiry) {
+		return nil, sql.ErrNoRows
+	}
+	s.setState(task, "failed", arg.Result)
+	return nil, nil
+}
+
+func (s *MemoryStore) AbandonTask(_ context.Context, arg AbandonTaskParams) ([]int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[arg.ID]
+	if !ok || task.State.String != "received" {
+		return nil, sql.ErrNoRows
+	}
+	s.setState(task, "failed", arg.Result)
+	return nil, nil
+}
+
+func (s *MemoryStore) ReleaseTask(_ context.Context, arg ReleaseTaskParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[arg.ID]
+	if !ok || !holdsLease(task, arg.LeaseExpiry) {
+		return sql.ErrNoRows
+	}
+	task.LeaseExpiry = sql.NullTime{}
+	s.setState(task, "received", task.Result)
+	return nil
+}
+
+func (s *MemoryStore) ListTaskTypeStats(_ context.Context, namespace string) ([]TaskTypeStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats []TaskTypeStat
+	for key, stat := range s.stats {
+		if key.namespace == namespace {
+			stats = append(stats, stat)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Type < stats[j].Type
+	})
+	return stats, nil
+}
+
+// holdsLease reports whether a task is "processing" under the given lease, as the completion queries check
+func holdsLease(task Task, leaseExpiry sql.NullTime) bool {
+	return task.State.String == "processing" && task.LeaseExpiry.Valid && leaseExpiry.Valid && task.LeaseExpiry.Time.Equal(leaseExpiry.Time)
+}
+
+// setState stores the task in its new state; the caller holds s.mu
+func (s *MemoryStore) setState(task Task, state string, result json.RawMessage) {
+	task.State = sql.NullString{String: state, Valid: true}
+	task.LastUpdateTime = sql.NullTime{Time: time.Now(), Valid: true}
+	task.Result = append(json.RawMessage(nil), result...)
+	s.tasks[task.ID] = task
+}
+
+// cloneTask copies a task, so that callers cannot change the stored result
+func cloneTask(task Task) Task {
+	task.Result = append(json.RawMessage(nil), task.Result...)
+	return task
+}
@@ -6,13 +6,102 @@ package persistence
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 )
 
+type RateLimiter struct {
+	Name           string    `json:"name"`
+	Tokens         float64   `json:"tokens"`
+	Capacity       float64   `json:"capacity"`
+	RefillRate     float64   `json:"refill_rate"`
+	LastRefillTime time.Time `json:"last_refill_time"`
+}
+
+type RecurringTask struct {
+	ID           int32        `json:"id"`
+	Name         string       `json:"name"`
+	CronSpec     string       `json:"cron_spec"`
+	Type         int32        `json:"type"`
+	Value        int32        `json:"value"`
+	Enabled      bool         `json:"enabled"`
+	CatchUp      bool         `json:"catch_up"`
+	LastFireTime sql.NullTime `json:"last_fire_time"`
+	NextFireTime sql.NullTime `json:"next_fire_time"`
+	CreationTime sql.NullTime `json:"creation_time"`
+	Namespace    string       `json:"namespace"`
+}
+
 type Task struct {
-	ID             int32          `json:"id"`
-	Type           sql.NullInt32  `json:"type"`
-	Value          sql.NullInt32  `json:"value"`
-	State          sql.NullString `json:"state"`
-	CreationTime   sql.NullTime   `json:"creation_time"`
-	LastUpdateTime sql.NullTime   `json:"last_update_time"`
+	ID             int32           `json:"id"`
+	Type           sql.NullInt32   `json:"type"`
+	Value          sql.NullInt32   `json:"value"`
+	State          sql.NullString  `json:"state"`
+	CreationTime   sql.NullTime    `json:"creation_time"`
+	LastUpdateTime sql.NullTime    `json:"last_update_time"`
+	Comment        sql.NullString  `json:"comment"`
+	Result         json.RawMessage `json:"result"`
+	RunAt          time.Time       `json:"run_at"`
+	WorkflowID     sql.NullInt32   `json:"workflow_id"`
+	Namespace      string          `json:"namespace"`
+	LeaseExpiry    sql.NullTime    `json:"lease_expiry"`
+}
+
+type TaskDependency struct {
+	TaskID      int32 `json:"task_id"`
+	DependsOnID int32 `json:"depends_on_id"`
+}
+
+type TaskEvent struct {
+	ID        int64          `json:"id"`
+	TaskID    int32          `json:"task_id"`
+	OldState  sql.NullString `json:"old_state"`
+	NewState  string         `json:"new_state"`
+	EventTime time.Time      `json:"event_time"`
+	Actor     string         `json:"actor"`
+	Error     sql.NullString `json:"error"`
+}
+
+type TaskOutbox struct {
+	ID              int32          `json:"id"`
+	TaskID          int32          `json:"task_id"`
+	Namespace       string         `json:"namespace"`
+	State           string         `json:"state"`
+	Attempts        int32          `json:"attempts"`
+	NextAttemptTime time.Time      `json:"next_attempt_time"`
+	LastError       sql.NullString `json:"last_error"`
+	CreationTime    sql.NullTime   `json:"creation_time"`
+	SentTime        sql.NullTime   `json:"sent_time"`
+}
+
+type TaskTypeStat struct {
+	Type           int32        `json:"type"`
+	Count          int64        `json:"count"`
+	Sum            int64        `json:"sum"`
+	Min            int32        `json:"min"`
+	Max            int32        `json:"max"`
+	LastUpdateTime sql.NullTime `json:"last_update_time"`
+	Namespace      string       `json:"namespace"`
+}
+
+type TasksArchive struct {
+	ID             int32           `json:"id"`
+	Type           sql.NullInt32   `json:"type"`
+	Value          sql.NullInt32   `json:"value"`
+	State          sql.NullString  `json:"state"`
+	CreationTime   sql.NullTime    `json:"creation_time"`
+	LastUpdateTime sql.NullTime    `json:"last_update_time"`
+	Comment        sql.NullString  `json:"comment"`
+	Result         json.RawMessage `json:"result"`
+	RunAt          time.Time       `json:"run_at"`
+	WorkflowID     sql.NullInt32   `json:"workflow_id"`
+	Namespace      string          `json:"namespace"`
+	ArchiveTime    time.Time       `json:"archive_time"`
+}
+
+type Workflow struct {
+	ID           int32        `json:"id"`
+	Name         string       `json:"name"`
+	CreationTime sql.NullTime `json:"creation_time"`
+	Namespace    string       `json:"namespace"`
 }
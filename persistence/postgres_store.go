@@ -0,0 +1,131 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TxDB is a connection that also begins transactions; satisfied by *sql.DB and *breaker.DB
+type TxDB interface {
+	DBTX
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// PostgresStore is the TaskStore of the tasks table, built on the generated queries
+type PostgresStore struct {
+	db      TxDB
+	queries *Queries
+	// tx is the caller's transaction the store runs in; nil when it runs transactions of its own
+	tx *sql.Tx
+}
+
+func NewPostgresStore(db TxDB) *PostgresStore {
+	return &PostgresStore{db: db, queries: New(db)}
+}
+
+func (s *PostgresStore) WithTx(tx *sql.Tx) TaskStore {
+	return &PostgresStore{db: s.db, queries: s.queries.WithTx(tx), tx: tx}
+}
+
+func (s *PostgresStore) CreateTask(ctx context.Context, arg CreateTaskParams) (int32, error) {
+	return s.queries.CreateTask(ctx, arg)
+}
+
+func (s *PostgresStore) ScheduleTask(ctx context.Context, arg ScheduleTaskParams) (int32, error) {
+	return s.queries.ScheduleTask(ctx, arg)
+}
+
+func (s *PostgresStore) GetTask(ctx context.Context, arg GetTaskByIDParams) (Task, error) {
+	return s.queries.GetTaskByID(ctx, arg)
+}
+
+func (s *PostgresStore) ListTasks(ctx context.Context, arg GetTasksByStateParams) ([]Task, error) {
+	return s.queries.GetTasksByState(ctx, arg)
+}
+
+func (s *PostgresStore) StartTask(ctx context.Context, arg MarkTaskProcessingParams) (sql.NullTime, error) {
+	return s.queries.MarkTaskProcessing(ctx, arg)
+}
+
+// CompleteTask updates the task and the stats in one transaction, so the stats never drift from the tasks table
+func (s *PostgresStore) CompleteTask(ctx context.Context, arg CompleteTaskParams) (TaskTypeStat, error) {
+	var stats TaskTypeStat
+	err := inTx(ctx, s.db, s.tx, func(tx DBTX) error {
+		qtx := New(tx)
+		// No row means the lease expired and the task went to another consumer, which counts it
+		task, err := qtx.CompleteTask(ctx, arg)
+		if err != nil || !task.Type.Valid || !task.Value.Valid {
+			return err
+		}
+
+		stats, err = qtx.IncrementTaskTypeStats(ctx, IncrementTaskTypeStatsParams{
+			Namespace: task.Namespace,
+			Type:      task.Type.Int32,
+			Sum:       int64(task.Value.Int32),
+		})
+		return err
+	})
+	if err != nil {
+		return TaskTypeStat{}, err
+	}
+	return stats, nil
+}
+
+// FailTask skips the dependents of the task, transitively, in the transaction that fails it
+func (s *PostgresStore) FailTask(ctx context.Context, arg FailTaskParams) ([]int32, error) {
+	var skipped []int32
+	err := inTx(ctx, s.db, s.tx, func(tx DBTX) error {
+		qtx := New(tx)
+		failed, err := qtx.FailTask(ctx, arg)
+		if err != nil {
+			return err
+		}
+		if failed == 0 {
+			return sql.ErrNoRows
+		}
+
+		skipped, err = qtx.SkipDependentTasks(ctx, arg.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// AbandonTask skips the dependents of the task in the transaction that fails it, unless the task was started meanwhile
+func (s *PostgresStore) AbandonTask(ctx context.Context, arg AbandonTaskParams) ([]int32, error) {
+	var skipped []int32
+	err := inTx(ctx, s.db, s.tx, func(tx DBTX) error {
+		qtx := New(tx)
+		abandoned, err := qtx.AbandonTask(ctx, arg)
+		if err != nil {
+			return err
+		}
+		if abandoned == 0 {
+			return sql.ErrNoRows
+		}
+
+		skipped, err = qtx.SkipDependentTasks(ctx, arg.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+func (s *PostgresStore) ReleaseTask(ctx context.Context, arg ReleaseTaskParams) error {
+	released, err := s.queries.ReleaseTask(ctx, arg)
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListTaskTypeStats(ctx context.Context, namespace string) ([]TaskTypeStat, error) {
+	return s.queries.ListTaskTypeStats(ctx, namespace)
+}
@@ -8,50 +8,1145 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const abandonTask = `-- name: AbandonTask :execrows
+UPDATE tasks SET state = 'failed', result = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'received'
+`
+
+type AbandonTaskParams struct {
+	ID     int32           `json:"id"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (q *Queries) AbandonTask(ctx context.Context, arg AbandonTaskParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, abandonTask, arg.ID, arg.Result)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const archiveExpiredTasks = `-- name: ArchiveExpiredTasks :execrows
+WITH expired AS (
+    SELECT id FROM tasks
+    WHERE state = ANY($1::TEXT[]) AND last_update_time < $2::TIMESTAMPTZ
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+), deleted_events AS (
+    DELETE FROM task_events WHERE task_id IN (SELECT id FROM expired)
+), deleted_outbox AS (
+    DELETE FROM task_outbox WHERE task_id IN (SELECT id FROM expired)
+), deleted_dependencies AS (
+    DELETE FROM task_dependencies
+    WHERE task_id IN (SELECT id FROM expired) OR depends_on_id IN (SELECT id FROM expired)
+), archived AS (
+    DELETE FROM tasks WHERE id IN (SELECT id FROM expired)
+    RETURNING id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace
+)
+INSERT INTO tasks_archive (id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace
+FROM archived
+`
+
+type ArchiveExpiredTasksParams struct {
+	States    []string  `json:"states"`
+	Cutoff    time.Time `json:"cutoff"`
+	BatchSize int32     `json:"batch_size"`
+}
+
+func (q *Queries) ArchiveExpiredTasks(ctx context.Context, arg ArchiveExpiredTasksParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, archiveExpiredTasks, pq.Array(arg.States), arg.Cutoff, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimDueTasks = `-- name: ClaimDueTasks :many
+UPDATE tasks SET state = 'received', last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM tasks
+    WHERE state = 'scheduled' AND run_at <= CURRENT_TIMESTAMP
+    ORDER BY run_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry
+`
+
+func (q *Queries) ClaimDueTasks(ctx context.Context, limit int32) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueTasks, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.Comment,
+			&i.Result,
+			&i.RunAt,
+			&i.WorkflowID,
+			&i.Namespace,
+			&i.LeaseExpiry,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimOutboxEntries = `-- name: ClaimOutboxEntries :many
+UPDATE task_outbox o SET next_attempt_time = $1
+FROM tasks t
+WHERE o.id IN (
+    SELECT id FROM task_outbox
+    WHERE state = 'pending' AND next_attempt_time <= CURRENT_TIMESTAMP
+    ORDER BY next_attempt_time
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+  AND t.id = o.task_id
+RETURNING o.id, o.task_id, o.namespace, o.attempts, t.type, t.value
+`
+
+type ClaimOutboxEntriesParams struct {
+	NextAttemptTime time.Time `json:"next_attempt_time"`
+	Limit           int32     `json:"limit"`
+}
+
+type ClaimOutboxEntriesRow struct {
+	ID        int32         `json:"id"`
+	TaskID    int32         `json:"task_id"`
+	Namespace string        `json:"namespace"`
+	Attempts  int32         `json:"attempts"`
+	Type      sql.NullInt32 `json:"type"`
+	Value     sql.NullInt32 `json:"value"`
+}
+
+func (q *Queries) ClaimOutboxEntries(ctx context.Context, arg ClaimOutboxEntriesParams) ([]ClaimOutboxEntriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimOutboxEntries, arg.NextAttemptTime, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimOutboxEntriesRow
+	for rows.Next() {
+		var i ClaimOutboxEntriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.Namespace,
+			&i.Attempts,
+			&i.Type,
+			&i.Value,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimReadyTasks = `-- name: ClaimReadyTasks :many
+UPDATE tasks SET state = 'received', last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT t.id FROM tasks t
+    WHERE t.state = 'pending'
+      AND NOT EXISTS (
+          SELECT 1 FROM task_dependencies d
+          JOIN tasks p ON p.id = d.depends_on_id
+          WHERE d.task_id = t.id AND p.state <> 'done'
+      )
+    ORDER BY t.id
+    LIMIT $1
+    FOR UPDATE OF t SKIP LOCKED
+)
+RETURNING id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry
+`
+
+func (q *Queries) ClaimReadyTasks(ctx context.Context, limit int32) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, claimReadyTasks, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.Comment,
+			&i.Result,
+			&i.RunAt,
+			&i.WorkflowID,
+			&i.Namespace,
+			&i.LeaseExpiry,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimTasks = `-- name: ClaimTasks :many
+UPDATE tasks SET state = 'processing', lease_expiry = $1, last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM tasks
+    WHERE namespace = $2 AND (state = 'received' OR (state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP))
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry
+`
+
+type ClaimTasksParams struct {
+	LeaseExpiry sql.NullTime `json:"lease_expiry"`
+	Namespace   string       `json:"namespace"`
+	Limit       int32        `json:"limit"`
+}
+
+func (q *Queries) ClaimTasks(ctx context.Context, arg ClaimTasksParams) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, claimTasks, arg.LeaseExpiry, arg.Namespace, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.Comment,
+			&i.Result,
+			&i.RunAt,
+			&i.WorkflowID,
+			&i.Namespace,
+			&i.LeaseExpiry,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const completeTask = `-- name: CompleteTask :one
+UPDATE tasks SET state = 'done', result = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'processing' AND lease_expiry = $3
+RETURNING type, value, namespace
+`
+
+type CompleteTaskParams struct {
+	ID          int32           `json:"id"`
+	Result      json.RawMessage `json:"result"`
+	LeaseExpiry sql.NullTime    `json:"lease_expiry"`
+}
+
+type CompleteTaskRow struct {
+	Type      sql.NullInt32 `json:"type"`
+	Value     sql.NullInt32 `json:"value"`
+	Namespace string        `json:"namespace"`
+}
+
+func (q *Queries) CompleteTask(ctx context.Context, arg CompleteTaskParams) (CompleteTaskRow, error) {
+	row := q.db.QueryRowContext(ctx, completeTask, arg.ID, arg.Result, arg.LeaseExpiry)
+	var i CompleteTaskRow
+	err := row.Scan(&i.Type, &i.Value, &i.Namespace)
+	return i, err
+}
+
+const countBacklogTasks = `-- name: CountBacklogTasks :many
+SELECT namespace, COUNT(*) AS count
+FROM tasks
+WHERE state IN ('received', 'processing')
+GROUP BY namespace
+`
+
+type CountBacklogTasksRow struct {
+	Namespace string `json:"namespace"`
+	Count     int64  `json:"count"`
+}
+
+func (q *Queries) CountBacklogTasks(ctx context.Context) ([]CountBacklogTasksRow, error) {
+	rows, err := q.db.QueryContext(ctx, countBacklogTasks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountBacklogTasksRow
+	for rows.Next() {
+		var i CountBacklogTasksRow
+		if err := rows.Scan(&i.Namespace, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countNamespaceBacklog = `-- name: CountNamespaceBacklog :one
+SELECT COUNT(*) FROM tasks WHERE namespace = $1 AND state IN ('received', 'processing')
+`
+
+func (q *Queries) CountNamespaceBacklog(ctx context.Context, namespace string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countNamespaceBacklog, namespace)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createOutboxEntries = `-- name: CreateOutboxEntries :many
+INSERT INTO task_outbox (task_id, namespace, next_attempt_time)
+SELECT t.task_id, t.namespace, $1::TIMESTAMPTZ
+FROM unnest($2::INT[], $3::TEXT[]) AS t(task_id, namespace)
+RETURNING id, task_id
+`
+
+type CreateOutboxEntriesParams struct {
+	NextAttemptTime time.Time `json:"next_attempt_time"`
+	TaskIds         []int32   `json:"task_ids"`
+	Namespaces      []string  `json:"namespaces"`
+}
+
+type CreateOutboxEntriesRow struct {
+	ID     int32 `json:"id"`
+	TaskID int32 `json:"task_id"`
+}
+
+func (q *Queries) CreateOutboxEntries(ctx context.Context, arg CreateOutboxEntriesParams) ([]CreateOutboxEntriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, createOutboxEntries, arg.NextAttemptTime, pq.Array(arg.TaskIds), pq.Array(arg.Namespaces))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CreateOutboxEntriesRow
+	for rows.Next() {
+		var i CreateOutboxEntriesRow
+		if err := rows.Scan(&i.ID, &i.TaskID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createOutboxEntry = `-- name: CreateOutboxEntry :one
+INSERT INTO task_outbox (task_id, namespace, next_attempt_time)
+VALUES ($1, $2, $3)
+RETURNING id
+`
+
+type CreateOutboxEntryParams struct {
+	TaskID          int32     `json:"task_id"`
+	Namespace       string    `json:"namespace"`
+	NextAttemptTime time.Time `json:"next_attempt_time"`
+}
+
+func (q *Queries) CreateOutboxEntry(ctx context.Context, arg CreateOutboxEntryParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, createOutboxEntry, arg.TaskID, arg.Namespace, arg.NextAttemptTime)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createPendingTask = `-- name: CreatePendingTask :one
+INSERT INTO tasks (type, value, state, comment, workflow_id, namespace)
+VALUES ($1, $2, 'pending', $3, $4, $5)
+RETURNING id
+`
+
+type CreatePendingTaskParams struct {
+	Type       sql.NullInt32  `json:"type"`
+	Value      sql.NullInt32  `json:"value"`
+	Comment    sql.NullString `json:"comment"`
+	WorkflowID sql.NullInt32  `json:"workflow_id"`
+	Namespace  string         `json:"namespace"`
+}
+
+func (q *Queries) CreatePendingTask(ctx context.Context, arg CreatePendingTaskParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, createPendingTask,
+		arg.Type,
+		arg.Value,
+		arg.Comment,
+		arg.WorkflowID,
+		arg.Namespace,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createRecurringTask = `-- name: CreateRecurringTask :one
+INSERT INTO recurring_tasks (name, cron_spec, type, value, enabled, catch_up, namespace)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, name, cron_spec, type, value, enabled, catch_up, last_fire_time, next_fire_time, creation_time, namespace
+`
+
+type CreateRecurringTaskParams struct {
+	Name      string `json:"name"`
+	CronSpec  string `json:"cron_spec"`
+	Type      int32  `json:"type"`
+	Value     int32  `json:"value"`
+	Enabled   bool   `json:"enabled"`
+	CatchUp   bool   `json:"catch_up"`
+	Namespace string `json:"namespace"`
+}
+
+func (q *Queries) CreateRecurringTask(ctx context.Context, arg CreateRecurringTaskParams) (RecurringTask, error) {
+	row := q.db.QueryRowContext(ctx, createRecurringTask,
+		arg.Name,
+		arg.CronSpec,
+		arg.Type,
+		arg.Value,
+		arg.Enabled,
+		arg.CatchUp,
+		arg.Namespace,
+	)
+	var i RecurringTask
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CronSpec,
+		&i.Type,
+		&i.Value,
+		&i.Enabled,
+		&i.CatchUp,
+		&i.LastFireTime,
+		&i.NextFireTime,
+		&i.CreationTime,
+		&i.Namespace,
+	)
+	return i, err
+}
+
+const createTask = `-- name: CreateTask :one
+INSERT INTO tasks (type, value, state, comment, namespace)
+VALUES ($1, $2, 'received', $3, $4)
+RETURNING id
+`
+
+type CreateTaskParams struct {
+	Type      sql.NullInt32  `json:"type"`
+	Value     sql.NullInt32  `json:"value"`
+	Comment   sql.NullString `json:"comment"`
+	Namespace string         `json:"namespace"`
+}
+
+func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, createTask,
+		arg.Type,
+		arg.Value,
+		arg.Comment,
+		arg.Namespace,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createTaskDependency = `-- name: CreateTaskDependency :exec
+INSERT INTO task_dependencies (task_id, depends_on_id)
+VALUES ($1, $2)
+`
+
+type CreateTaskDependencyParams struct {
+	TaskID      int32 `json:"task_id"`
+	DependsOnID int32 `json:"depends_on_id"`
+}
+
+func (q *Queries) CreateTaskDependency(ctx context.Context, arg CreateTaskDependencyParams) error {
+	_, err := q.db.ExecContext(ctx, createTaskDependency, arg.TaskID, arg.DependsOnID)
+	return err
+}
+
+const createTasks = `-- name: CreateTasks :many
+WITH batch AS (
+    SELECT nextval('tasks_id_seq')::INT AS id, t.type, t.value, t.comment, t.namespace, t.ord
+    FROM unnest($1::INT[], $2::INT[], $3::TEXT[], $4::TEXT[])
+        WITH ORDINALITY AS t(type, value, comment, namespace, ord)
+), inserted AS (
+    INSERT INTO tasks (id, type, value, state, comment, namespace)
+    SELECT id, type, value, 'received', NULLIF(comment, ''), namespace FROM batch
+    RETURNING id
 )
+SELECT inserted.id, batch.ord FROM inserted JOIN batch ON batch.id = inserted.id
+`
+
+type CreateTasksParams struct {
+	TaskTypes  []int32  `json:"task_types"`
+	TaskValues []int32  `json:"task_values"`
+	Comments   []string `json:"comments"`
+	Namespaces []string `json:"namespaces"`
+}
+
+type CreateTasksRow struct {
+	ID  int32 `json:"id"`
+	Ord int64 `json:"ord"`
+}
+
+func (q *Queries) CreateTasks(ctx context.Context, arg CreateTasksParams) ([]CreateTasksRow, error) {
+	rows, err := q.db.QueryContext(ctx, createTasks,
+		pq.Array(arg.TaskTypes),
+		pq.Array(arg.TaskValues),
+		pq.Array(arg.Comments),
+		pq.Array(arg.Namespaces),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CreateTasksRow
+	for rows.Next() {
+		var i CreateTasksRow
+		if err := rows.Scan(&i.ID, &i.Ord); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWorkflow = `-- name: CreateWorkflow :one
+INSERT INTO workflows (name, namespace)
+VALUES ($1, $2)
+RETURNING id
+`
+
+type CreateWorkflowParams struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+func (q *Queries) CreateWorkflow(ctx context.Context, arg CreateWorkflowParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, createWorkflow, arg.Name, arg.Namespace)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const deleteExpiredTasks = `-- name: DeleteExpiredTasks :execrows
+WITH expired AS (
+    SELECT id FROM tasks
+    WHERE state = ANY($1::TEXT[]) AND last_update_time < $2::TIMESTAMPTZ
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+), deleted_events AS (
+    DELETE FROM task_events WHERE task_id IN (SELECT id FROM expired)
+), deleted_outbox AS (
+    DELETE FROM task_outbox WHERE task_id IN (SELECT id FROM expired)
+), deleted_dependencies AS (
+    DELETE FROM task_dependencies
+    WHERE task_id IN (SELECT id FROM expired) OR depends_on_id IN (SELECT id FROM expired)
+)
+DELETE FROM tasks WHERE id IN (SELECT id FROM expired)
+`
+
+type DeleteExpiredTasksParams struct {
+	States    []string  `json:"states"`
+	Cutoff    time.Time `json:"cutoff"`
+	BatchSize int32     `json:"batch_size"`
+}
+
+func (q *Queries) DeleteExpiredTasks(ctx context.Context, arg DeleteExpiredTasksParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredTasks, pq.Array(arg.States), arg.Cutoff, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRecurringTask = `-- name: DeleteRecurringTask :execrows
+DELETE FROM recurring_tasks WHERE name = $1
+`
+
+func (q *Queries) DeleteRecurringTask(ctx context.Context, name string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRecurringTask, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteTaskTypeStats = `-- name: DeleteTaskTypeStats :exec
+DELETE FROM task_type_stats WHERE namespace = $1
+`
+
+func (q *Queries) DeleteTaskTypeStats(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskTypeStats, namespace)
+	return err
+}
+
+const failTask = `-- name: FailTask :execrows
+UPDATE tasks SET state = 'failed', result = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'processing' AND lease_expiry = $3
+`
+
+type FailTaskParams struct {
+	ID          int32           `json:"id"`
+	Result      json.RawMessage `json:"result"`
+	LeaseExpiry sql.NullTime    `json:"lease_expiry"`
+}
+
+func (q *Queries) FailTask(ctx context.Context, arg FailTaskParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, failTask, arg.ID, arg.Result, arg.LeaseExpiry)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getRecurringTask = `-- name: GetRecurringTask :one
+SELECT id, name, cron_spec, type, value, enabled, catch_up, last_fire_time, next_fire_time, creation_time, namespace FROM recurring_tasks WHERE id = $1
+`
+
+func (q *Queries) GetRecurringTask(ctx context.Context, id int32) (RecurringTask, error) {
+	row := q.db.QueryRowContext(ctx, getRecurringTask, id)
+	var i RecurringTask
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CronSpec,
+		&i.Type,
+		&i.Value,
+		&i.Enabled,
+		&i.CatchUp,
+		&i.LastFireTime,
+		&i.NextFireTime,
+		&i.CreationTime,
+		&i.Namespace,
+	)
+	return i, err
+}
+
+const getTaskByID = `-- name: GetTaskByID :one
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE id = $1 AND namespace = $2
+`
+
+type GetTaskByIDParams struct {
+	ID        int32  `json:"id"`
+	Namespace string `json:"namespace"`
+}
+
+func (q *Queries) GetTaskByID(ctx context.Context, arg GetTaskByIDParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, getTaskByID, arg.ID, arg.Namespace)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.Value,
+		&i.State,
+		&i.CreationTime,
+		&i.LastUpdateTime,
+		&i.Comment,
+		&i.Result,
+		&i.RunAt,
+		&i.WorkflowID,
+		&i.Namespace,
+		&i.LeaseExpiry,
+	)
+	return i, err
+}
+
+const getTasksByState = `-- name: GetTasksByState :many
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE state = $1 AND namespace = $2 ORDER BY id
+`
+
+type GetTasksByStateParams struct {
+	State     sql.NullString `json:"state"`
+	Namespace string         `json:"namespace"`
+}
+
+func (q *Queries) GetTasksByState(ctx context.Context, arg GetTasksByStateParams) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, getTasksByState, arg.State, arg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.Comment,
+			&i.Result,
+			&i.RunAt,
+			&i.WorkflowID,
+			&i.Namespace,
+			&i.LeaseExpiry,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWorkflow = `-- name: GetWorkflow :one
+SELECT id, name, creation_time, namespace FROM workflows WHERE id = $1 AND namespace = $2
+`
+
+type GetWorkflowParams struct {
+	ID        int32  `json:"id"`
+	Namespace string `json:"namespace"`
+}
+
+func (q *Queries) GetWorkflow(ctx context.Context, arg GetWorkflowParams) (Workflow, error) {
+	row := q.db.QueryRowContext(ctx, getWorkflow, arg.ID, arg.Namespace)
+	var i Workflow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreationTime,
+		&i.Namespace,
+	)
+	return i, err
+}
+
+const incrementTaskTypeStats = `-- name: IncrementTaskTypeStats :one
+INSERT INTO task_type_stats (namespace, type, count, sum, min, max)
+VALUES ($1, $2, 1, $3, $3, $3)
+ON CONFLICT (namespace, type) DO UPDATE SET count = task_type_stats.count + 1,
+                                 sum = task_type_stats.sum + EXCLUDED.sum,
+                                 min = LEAST(task_type_stats.min, EXCLUDED.min),
+                                 max = GREATEST(task_type_stats.max, EXCLUDED.max),
+                                 last_update_time = CURRENT_TIMESTAMP
+RETURNING type, count, sum, min, max, last_update_time, namespace
+`
+
+type IncrementTaskTypeStatsParams struct {
+	Namespace string `json:"namespace"`
+	Type      int32  `json:"type"`
+	Sum       int64  `json:"sum"`
+}
+
+func (q *Queries) IncrementTaskTypeStats(ctx context.Context, arg IncrementTaskTypeStatsParams) (TaskTypeStat, error) {
+	row := q.db.QueryRowContext(ctx, incrementTaskTypeStats, arg.Namespace, arg.Type, arg.Sum)
+	var i TaskTypeStat
+	err := row.Scan(
+		&i.Type,
+		&i.Count,
+		&i.Sum,
+		&i.Min,
+		&i.Max,
+		&i.LastUpdateTime,
+		&i.Namespace,
+	)
+	return i, err
+}
+
+const listDueRecurringTasks = `-- name: ListDueRecurringTasks :many
+SELECT id, name, cron_spec, type, value, enabled, catch_up, last_fire_time, next_fire_time, creation_time, namespace FROM recurring_tasks
+WHERE enabled AND (next_fire_time IS NULL OR next_fire_time <= $1)
+ORDER BY id
+`
+
+func (q *Queries) ListDueRecurringTasks(ctx context.Context, nextFireTime sql.NullTime) ([]RecurringTask, error) {
+	rows, err := q.db.QueryContext(ctx, listDueRecurringTasks, nextFireTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RecurringTask
+	for rows.Next() {
+		var i RecurringTask
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CronSpec,
+			&i.Type,
+			&i.Value,
+			&i.Enabled,
+			&i.CatchUp,
+			&i.LastFireTime,
+			&i.NextFireTime,
+			&i.CreationTime,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecurringTasks = `-- name: ListRecurringTasks :many
+SELECT id, name, cron_spec, type, value, enabled, catch_up, last_fire_time, next_fire_time, creation_time, namespace FROM recurring_tasks ORDER BY name
+`
+
+func (q *Queries) ListRecurringTasks(ctx context.Context) ([]RecurringTask, error) {
+	rows, err := q.db.QueryContext(ctx, listRecurringTasks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RecurringTask
+	for rows.Next() {
+		var i RecurringTask
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CronSpec,
+			&i.Type,
+			&i.Value,
+			&i.Enabled,
+			&i.CatchUp,
+			&i.LastFireTime,
+			&i.NextFireTime,
+			&i.CreationTime,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
 
-const createTask = `-- name: CreateTask :one
-INSERT INTO tasks (type, value, state)
-VALUES ($1, $2, 'received')
-RETURNING id
+const listTaskEvents = `-- name: ListTaskEvents :many
+SELECT id, task_id, old_state, new_state, event_time, actor, error FROM task_events WHERE task_id = $1 ORDER BY id
 `
 
-type CreateTaskParams struct {
-	Type  sql.NullInt32 `json:"type"`
-	Value sql.NullInt32 `json:"value"`
+func (q *Queries) ListTaskEvents(ctx context.Context, taskID int32) ([]TaskEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listTaskEvents, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskEvent
+	for rows.Next() {
+		var i TaskEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.OldState,
+			&i.NewState,
+			&i.EventTime,
+			&i.Actor,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (int32, error) {
-	row := q.db.QueryRowContext(ctx, createTask, arg.Type, arg.Value)
-	var id int32
-	err := row.Scan(&id)
-	return id, err
+const listTaskTypeStats = `-- name: ListTaskTypeStats :many
+SELECT type, count, sum, min, max, last_update_time, namespace FROM task_type_stats WHERE namespace = $1 ORDER BY type
+`
+
+func (q *Queries) ListTaskTypeStats(ctx context.Context, namespace string) ([]TaskTypeStat, error) {
+	rows, err := q.db.QueryContext(ctx, listTaskTypeStats, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskTypeStat
+	for rows.Next() {
+		var i TaskTypeStat
+		if err := rows.Scan(
+			&i.Type,
+			&i.Count,
+			&i.Sum,
+			&i.Min,
+			&i.Max,
+			&i.LastUpdateTime,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getTaskByID = `-- name: GetTaskByID :one
-SELECT id, type, value, state, creation_time, last_update_time FROM tasks WHERE id = $1
+const listWorkflowDependencies = `-- name: ListWorkflowDependencies :many
+SELECT d.task_id, d.depends_on_id
+FROM task_dependencies d
+JOIN tasks t ON t.id = d.task_id
+WHERE t.workflow_id = $1
+ORDER BY d.task_id, d.depends_on_id
 `
 
-func (q *Queries) GetTaskByID(ctx context.Context, id int32) (Task, error) {
-	row := q.db.QueryRowContext(ctx, getTaskByID, id)
-	var i Task
-	err := row.Scan(
-		&i.ID,
-		&i.Type,
-		&i.Value,
-		&i.State,
-		&i.CreationTime,
-		&i.LastUpdateTime,
-	)
-	return i, err
+func (q *Queries) ListWorkflowDependencies(ctx context.Context, workflowID sql.NullInt32) ([]TaskDependency, error) {
+	rows, err := q.db.QueryContext(ctx, listWorkflowDependencies, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskDependency
+	for rows.Next() {
+		var i TaskDependency
+		if err := rows.Scan(&i.TaskID, &i.DependsOnID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getTasksByState = `-- name: GetTasksByState :many
-SELECT id, type, value, state, creation_time, last_update_time FROM tasks WHERE state = $1
+const listWorkflowTasks = `-- name: ListWorkflowTasks :many
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE workflow_id = $1 ORDER BY id
+`
+
+func (q *Queries) ListWorkflowTasks(ctx context.Context, workflowID sql.NullInt32) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, listWorkflowTasks, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.Comment,
+			&i.Result,
+			&i.RunAt,
+			&i.WorkflowID,
+			&i.Namespace,
+			&i.LeaseExpiry,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOutboxDead = `-- name: MarkOutboxDead :execrows
+UPDATE task_outbox SET state = 'dead', attempts = attempts + 1, last_error = $2 WHERE id = $1 AND state = 'pending'
+`
+
+type MarkOutboxDeadParams struct {
+	ID        int32          `json:"id"`
+	LastError sql.NullString `json:"last_error"`
+}
+
+func (q *Queries) MarkOutboxDead(ctx context.Context, arg MarkOutboxDeadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markOutboxDead, arg.ID, arg.LastError)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markOutboxSent = `-- name: MarkOutboxSent :execrows
+UPDATE task_outbox SET state = 'sent', sent_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'pending'
+`
+
+func (q *Queries) MarkOutboxSent(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markOutboxSent, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markTaskProcessing = `-- name: MarkTaskProcessing :one
+UPDATE tasks SET state = 'processing', lease_expiry = $3, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND namespace = $2 AND state = 'received'
+RETURNING creation_time
+`
+
+type MarkTaskProcessingParams struct {
+	ID          int32        `json:"id"`
+	Namespace   string       `json:"namespace"`
+	LeaseExpiry sql.NullTime `json:"lease_expiry"`
+}
+
+func (q *Queries) MarkTaskProcessing(ctx context.Context, arg MarkTaskProcessingParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, markTaskProcessing, arg.ID, arg.Namespace, arg.LeaseExpiry)
+	var creation_time sql.NullTime
+	err := row.Scan(&creation_time)
+	return creation_time, err
+}
+
+const notifyTasks = `-- name: NotifyTasks :exec
+SELECT pg_notify('tasks', id::TEXT) FROM unnest($1::INT[]) AS id
+`
+
+func (q *Queries) NotifyTasks(ctx context.Context, ids []int32) error {
+	_, err := q.db.ExecContext(ctx, notifyTasks, pq.Array(ids))
+	return err
+}
+
+const peekClaimableTasks = `-- name: PeekClaimableTasks :many
+SELECT namespace FROM tasks
+WHERE state = 'received' OR (state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP)
+ORDER BY id
+LIMIT $1
+`
+
+func (q *Queries) PeekClaimableTasks(ctx context.Context, limit int32) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, peekClaimableTasks, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var namespace string
+		if err := rows.Scan(&namespace); err != nil {
+			return nil, err
+		}
+		items = append(items, namespace)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rebuildTaskTypeStats = `-- name: RebuildTaskTypeStats :exec
+INSERT INTO task_type_stats (namespace, type, count, sum, min, max)
+SELECT namespace, type, COUNT(*), SUM(value), MIN(value), MAX(value)
+FROM tasks
+WHERE namespace = $1 AND state = 'done' AND type IS NOT NULL AND value IS NOT NULL
+GROUP BY namespace, type
+`
+
+func (q *Queries) RebuildTaskTypeStats(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, rebuildTaskTypeStats, namespace)
+	return err
+}
+
+const requeueExpiredTasks = `-- name: RequeueExpiredTasks :many
+UPDATE tasks SET state = 'received', lease_expiry = NULL, last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM tasks
+    WHERE state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP
+    ORDER BY lease_expiry
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry
 `
 
-func (q *Queries) GetTasksByState(ctx context.Context, state sql.NullString) ([]Task, error) {
-	rows, err := q.db.QueryContext(ctx, getTasksByState, state)
+func (q *Queries) RequeueExpiredTasks(ctx context.Context, limit int32) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, requeueExpiredTasks, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +1161,12 @@ func (q *Queries) GetTasksByState(ctx context.Context, state sql.NullString) ([]
 			&i.State,
 			&i.CreationTime,
 			&i.LastUpdateTime,
+			&i.Comment,
+			&i.Result,
+			&i.RunAt,
+			&i.WorkflowID,
+			&i.Namespace,
+			&i.LeaseExpiry,
 		); err != nil {
 			return nil, err
 		}
@@ -80,6 +1181,176 @@ func (q *Queries) GetTasksByState(ctx context.Context, state sql.NullString) ([]
 	return items, nil
 }
 
+const releaseTask = `-- name: ReleaseTask :execrows
+UPDATE tasks SET state = 'received', lease_expiry = NULL, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'processing' AND lease_expiry = $2
+`
+
+type ReleaseTaskParams struct {
+	ID          int32        `json:"id"`
+	LeaseExpiry sql.NullTime `json:"lease_expiry"`
+}
+
+func (q *Queries) ReleaseTask(ctx context.Context, arg ReleaseTaskParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, releaseTask, arg.ID, arg.LeaseExpiry)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rescheduleTask = `-- name: RescheduleTask :execrows
+UPDATE tasks SET state = 'scheduled', run_at = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND namespace = $3 AND state = 'received'
+`
+
+type RescheduleTaskParams struct {
+	ID        int32     `json:"id"`
+	RunAt     time.Time `json:"run_at"`
+	Namespace string    `json:"namespace"`
+}
+
+func (q *Queries) RescheduleTask(ctx context.Context, arg RescheduleTaskParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rescheduleTask, arg.ID, arg.RunAt, arg.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const retryOutboxEntry = `-- name: RetryOutboxEntry :exec
+UPDATE task_outbox SET attempts = attempts + 1, last_error = $2, next_attempt_time = $3 WHERE id = $1 AND state = 'pending'
+`
+
+type RetryOutboxEntryParams struct {
+	ID              int32          `json:"id"`
+	LastError       sql.NullString `json:"last_error"`
+	NextAttemptTime time.Time      `json:"next_attempt_time"`
+}
+
+func (q *Queries) RetryOutboxEntry(ctx context.Context, arg RetryOutboxEntryParams) error {
+	_, err := q.db.ExecContext(ctx, retryOutboxEntry, arg.ID, arg.LastError, arg.NextAttemptTime)
+	return err
+}
+
+const scheduleTask = `-- name: ScheduleTask :one
+INSERT INTO tasks (type, value, state, comment, run_at, namespace)
+VALUES ($1, $2, 'scheduled', $3, $4, $5)
+RETURNING id
+`
+
+type ScheduleTaskParams struct {
+	Type      sql.NullInt32  `json:"type"`
+	Value     sql.NullInt32  `json:"value"`
+	Comment   sql.NullString `json:"comment"`
+	RunAt     time.Time      `json:"run_at"`
+	Namespace string         `json:"namespace"`
+}
+
+func (q *Queries) ScheduleTask(ctx context.Context, arg ScheduleTaskParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, scheduleTask,
+		arg.Type,
+		arg.Value,
+		arg.Comment,
+		arg.RunAt,
+		arg.Namespace,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const setRecurringTaskEnabled = `-- name: SetRecurringTaskEnabled :execrows
+UPDATE recurring_tasks SET enabled = $2, next_fire_time = NULL WHERE name = $1
+`
+
+type SetRecurringTaskEnabledParams struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (q *Queries) SetRecurringTaskEnabled(ctx context.Context, arg SetRecurringTaskEnabledParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setRecurringTaskEnabled, arg.Name, arg.Enabled)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const skipDependentTasks = `-- name: SkipDependentTasks :many
+WITH RECURSIVE dependents AS (
+    SELECT d.task_id FROM task_dependencies d WHERE d.depends_on_id = $1
+    UNION
+    SELECT d.task_id FROM task_dependencies d JOIN dependents ON d.depends_on_id = dependents.task_id
+)
+UPDATE tasks SET state = 'skipped', last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (SELECT task_id FROM dependents) AND state = 'pending'
+RETURNING id
+`
+
+func (q *Queries) SkipDependentTasks(ctx context.Context, dependsOnID int32) ([]int32, error) {
+	rows, err := q.db.QueryContext(ctx, skipDependentTasks, dependsOnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const takeRateLimiterToken = `-- name: TakeRateLimiterToken :one
+UPDATE rate_limiters
+SET tokens = LEAST(capacity, tokens + EXTRACT(EPOCH FROM (now() - last_refill_time)) * refill_rate) - 1,
+    last_refill_time = now()
+WHERE name = $1
+  AND LEAST(capacity, tokens + EXTRACT(EPOCH FROM (now() - last_refill_time)) * refill_rate) >= 1
+RETURNING tokens
+`
+
+func (q *Queries) TakeRateLimiterToken(ctx context.Context, name string) (float64, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimiterToken, name)
+	var tokens float64
+	err := row.Scan(&tokens)
+	return tokens, err
+}
+
+const tryLockRecurringTask = `-- name: TryLockRecurringTask :one
+SELECT pg_try_advisory_xact_lock(hashtext('recurring_tasks'), $1::INT)
+`
+
+func (q *Queries) TryLockRecurringTask(ctx context.Context, id int32) (bool, error) {
+	row := q.db.QueryRowContext(ctx, tryLockRecurringTask, id)
+	var pg_try_advisory_xact_lock bool
+	err := row.Scan(&pg_try_advisory_xact_lock)
+	return pg_try_advisory_xact_lock, err
+}
+
+const updateRecurringTaskFireTimes = `-- name: UpdateRecurringTaskFireTimes :exec
+UPDATE recurring_tasks SET last_fire_time = $2, next_fire_time = $3 WHERE id = $1
+`
+
+type UpdateRecurringTaskFireTimesParams struct {
+	ID           int32        `json:"id"`
+	LastFireTime sql.NullTime `json:"last_fire_time"`
+	NextFireTime sql.NullTime `json:"next_fire_time"`
+}
+
+func (q *Queries) UpdateRecurringTaskFireTimes(ctx context.Context, arg UpdateRecurringTaskFireTimesParams) error {
+	_, err := q.db.ExecContext(ctx, updateRecurringTaskFireTimes, arg.ID, arg.LastFireTime, arg.NextFireTime)
+	return err
+}
+
 const updateTaskState = `-- name: UpdateTaskState :exec
 UPDATE tasks SET state = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1
 `
@@ -93,3 +1364,21 @@ func (q *Queries) UpdateTaskState(ctx context.Context, arg UpdateTaskStateParams
 	_, err := q.db.ExecContext(ctx, updateTaskState, arg.ID, arg.State)
 	return err
 }
+
+const upsertRateLimiter = `-- name: UpsertRateLimiter :exec
+INSERT INTO rate_limiters (name, tokens, capacity, refill_rate)
+VALUES ($1, $2, $2, $3)
+ON CONFLICT (name) DO UPDATE SET capacity = EXCLUDED.capacity,
+                                 refill_rate = EXCLUDED.refill_rate
+`
+
+type UpsertRateLimiterParams struct {
+	Name       string  `json:"name"`
+	Tokens     float64 `json:"tokens"`
+	RefillRate float64 `json:"refill_rate"`
+}
+
+func (q *Queries) UpsertRateLimiter(ctx context.Context, arg UpsertRateLimiterParams) error {
+	_, err := q.db.ExecContext(ctx, upsertRateLimiter, arg.Name, arg.Tokens, arg.RefillRate)
+	return err
+}
@@ -3,9 +3,11 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 // TestCreateTask ensures that tasks are properly created in the database using sqlmock
@@ -26,15 +28,16 @@ func TestCreateTask(t *testing.T) {
 	// Define input parameters for CreateTask
 	taskType := sql.NullInt32{Int32: 2, Valid: true}
 	taskValue := sql.NullInt32{Int32: 50, Valid: true}
+	taskComment := sql.NullString{String: "nightly batch", Valid: true}
 	ctx := context.Background()
 
 	// Set up the expected SQL execution and return the generated ID (e.g., 1)
 	mock.ExpectQuery("INSERT INTO tasks").
-		WithArgs(taskType, taskValue).
+		WithArgs(taskType, taskValue, taskComment, "default").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1)) // Returning the generated ID
 
 	// Call the CreateTask method
-	taskID, err := queries.CreateTask(ctx, CreateTaskParams{Type: taskType, Value: taskValue})
+	taskID, err := queries.CreateTask(ctx, CreateTaskParams{Type: taskType, Value: taskValue, Comment: taskComment, Namespace: "default"})
 	assert.NoError(t, err)
 	assert.Equal(t, int32(1), taskID) // Ensure the returned ID is correct
 
@@ -97,14 +100,14 @@ func TestGetTaskByID(t *testing.T) {
 	taskState := sql.NullString{String: "received", Valid: true}
 
 	// Define the expected SQL query and result
-	mock.ExpectQuery("SELECT id, type, value, state, creation_time, last_update_time FROM tasks WHERE id").
-		WithArgs(taskID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time"}).
-			AddRow(taskID, taskType.Int32, taskValue.Int32, taskState.String, nil, nil))
+	mock.ExpectQuery("SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE id").
+		WithArgs(taskID, "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(taskID, taskType.Int32, taskValue.Int32, taskState.String, nil, nil, "nightly batch", []byte(`{"delay_ms":50}`), time.Now(), nil, "team-a", nil))
 
 	// Call the GetTaskByID method
 	ctx := context.Background()
-	task, err := queries.GetTaskByID(ctx, taskID)
+	task, err := queries.GetTaskByID(ctx, GetTaskByIDParams{ID: taskID, Namespace: "team-a"})
 	assert.NoError(t, err)
 
 	// Validate the returned task
@@ -116,6 +119,10 @@ func TestGetTaskByID(t *testing.T) {
 	assert.True(t, task.State.Valid)                     // Ensure the state is valid
 	assert.Equal(t, taskState.String, task.State.String) // Compare the string values
 
+	// Validate the comment and the JSON result
+	assert.Equal(t, "nightly batch", task.Comment.String)
+	assert.JSONEq(t, `{"delay_ms":50}`, string(task.Result))
+
 	// Ensure all mock expectations were met
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -142,14 +149,14 @@ func TestGetTasksByState(t *testing.T) {
 	taskValue := sql.NullInt32{Int32: 50, Valid: true}
 
 	// Set up the expected SQL query and result
-	mock.ExpectQuery("SELECT id, type, value, state, creation_time, last_update_time FROM tasks WHERE state").
-		WithArgs(taskState.String). // Pass the actual string value, not sql.NullString
-		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time"}).
-			AddRow(taskID, taskType.Int32, taskValue.Int32, taskState.String, nil, nil))
+	mock.ExpectQuery("SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE state").
+		WithArgs(taskState.String, "default"). // Pass the actual string value, not sql.NullString
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(taskID, taskType.Int32, taskValue.Int32, taskState.String, nil, nil, nil, []byte("null"), time.Now(), nil, "default", nil))
 
 	// Call the GetTasksByState method
 	ctx := context.Background()
-	tasks, err := queries.GetTasksByState(ctx, taskState)
+	tasks, err := queries.GetTasksByState(ctx, GetTasksByStateParams{State: taskState, Namespace: "default"})
 	assert.NoError(t, err)
 
 	// Validate the returned tasks
@@ -165,3 +172,550 @@ func TestGetTasksByState(t *testing.T) {
 	// Ensure all mock expectations were met
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// TestIncrementTaskTypeStats ensures that a task value is folded into the per-type aggregates using sqlmock
+func TestIncrementTaskTypeStats(t *testing.T) {
+	// Create a mock DB connection
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	// Initialize Queries object with the mock DB
+	queries := New(db)
+
+	// Set up the expected upsert and return the updated aggregates
+	mock.ExpectQuery("INSERT INTO task_type_stats").
+		WithArgs("team-a", int32(2), int64(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum", "min", "max", "last_update_time", "namespace"}).
+			AddRow(2, 3, 120, 20, 50, nil, "team-a"))
+
+	// Call the IncrementTaskTypeStats method
+	ctx := context.Background()
+	stats, err := queries.IncrementTaskTypeStats(ctx, IncrementTaskTypeStatsParams{Namespace: "team-a", Type: 2, Sum: 50})
+	assert.NoError(t, err)
+
+	// Validate the returned aggregates
+	assert.Equal(t, int32(2), stats.Type)
+	assert.Equal(t, int64(3), stats.Count)
+	assert.Equal(t, int64(120), stats.Sum)
+	assert.Equal(t, int32(20), stats.Min)
+	assert.Equal(t, int32(50), stats.Max)
+
+	// Ensure all mock expectations were met
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestListTaskTypeStats ensures that the per-type aggregates can be retrieved using sqlmock
+func TestListTaskTypeStats(t *testing.T) {
+	// Create a mock DB connection
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	// Initialize Queries object with the mock DB
+	queries := New(db)
+
+	// Set up the expected SQL query and result
+	mock.ExpectQuery("SELECT type, count, sum, min, max, last_update_time, namespace FROM task_type_stats WHERE namespace").
+		WithArgs("default").
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum", "min", "max", "last_update_time", "namespace"}).
+			AddRow(1, 2, 30, 10, 20, nil, "default").
+			AddRow(4, 1, 99, 99, 99, nil, "default"))
+
+	// Call the ListTaskTypeStats method
+	ctx := context.Background()
+	stats, err := queries.ListTaskTypeStats(ctx, "default")
+	assert.NoError(t, err)
+
+	// Validate the returned aggregates
+	assert.Len(t, stats, 2)
+	assert.Equal(t, int32(1), stats[0].Type)
+	assert.Equal(t, int64(30), stats[0].Sum)
+	assert.Equal(t, int32(4), stats[1].Type)
+	assert.Equal(t, int32(99), stats[1].Max)
+
+	// Ensure all mock expectations were met
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMarkTaskProcessing ensures that a task is moved to "processing" and its creation time is returned using sqlmock
+func TestMarkTaskProcessing(t *testing.T) {
+	// Create a mock DB connection
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	// Initialize Queries object with the mock DB
+	queries := New(db)
+
+	taskID := int32(1)
+	creationTime := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	leaseExpiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+	// Set up the expected SQL execution and return the creation time
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing', lease_expiry").
+		WithArgs(taskID, "default", leaseExpiry).
+		WillReturnRows(sqlmock.NewRows([]string{"creation_time"}).AddRow(creationTime))
+
+	// Call the MarkTaskProcessing method
+	ctx := context.Background()
+	created, err := queries.MarkTaskProcessing(ctx, MarkTaskProcessingParams{ID: taskID, Namespace: "default", LeaseExpiry: leaseExpiry})
+	assert.NoError(t, err)
+	assert.True(t, created.Valid)
+	assert.Equal(t, creationTime, created.Time)
+
+	// Ensure all mock expectations were met
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCompleteTask ensures that a task is marked done with its result using sqlmock
+func TestCompleteTask(t *testing.T) {
+	// Create a mock DB connection
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	// Initialize Queries object with the mock DB
+	queries := New(db)
+
+	taskID := int32(1)
+	result := json.RawMessage(`{"delay_ms":50}`)
+	leaseExpiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+	// Set up the expected SQL execution
+	mock.ExpectQuery("UPDATE tasks SET state = 'done', result(.+)AND state = 'processing' AND lease_expiry = \\$3(.+)RETURNING type, value, namespace").
+		WithArgs(taskID, result, leaseExpiry).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "value", "namespace"}).AddRow(2, 50, "default"))
+
+	// Call the CompleteTask method
+	ctx := context.Background()
+	completed, err := queries.CompleteTask(ctx, CompleteTaskParams{ID: taskID, Result: result, LeaseExpiry: leaseExpiry})
+	assert.NoError(t, err)
+	assert.Equal(t, CompleteTaskRow{
+		Type:      sql.NullInt32{Int32: 2, Valid: true},
+		Value:     sql.NullInt32{Int32: 50, Valid: true},
+		Namespace: "default",
+	}, completed)
+
+	// Ensure all mock expectations were met
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestClaimDueTasks ensures that due scheduled tasks are claimed and returned using sqlmock
+func TestClaimDueTasks(t *testing.T) {
+	// Create a mock DB connection
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	// Initialize Queries object with the mock DB
+	queries := New(db)
+
+	runAt := time.Now().Add(-time.Minute)
+
+	// Set up the expected SQL query and result
+	mock.ExpectQuery("UPDATE tasks SET state = 'received'(.+)FOR UPDATE SKIP LOCKED").
+		WithArgs(int32(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(3, 1, 20, "received", nil, nil, nil, []byte("null"), runAt, nil, "default", nil))
+
+	// Call the ClaimDueTasks method
+	ctx := context.Background()
+	tasks, err := queries.ClaimDueTasks(ctx, 10)
+	assert.NoError(t, err)
+
+	// Validate the claimed tasks
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, int32(3), tasks[0].ID)
+	assert.Equal(t, "received", tasks[0].State.String)
+	assert.Equal(t, runAt, tasks[0].RunAt)
+
+	// Ensure all mock expectations were met
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestClaimReadyTasks ensures that pending tasks whose parents are done are claimed using sqlmock
+func TestClaimReadyTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectQuery("UPDATE tasks SET state = 'received'(.+)state = 'pending'(.+)FOR UPDATE OF t SKIP LOCKED").
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(12, 2, 40, "received", nil, nil, nil, []byte("null"), time.Now(), 3, "default", nil))
+
+	tasks, err := queries.ClaimReadyTasks(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, int32(12), tasks[0].ID)
+	assert.Equal(t, sql.NullInt32{Int32: 3, Valid: true}, tasks[0].WorkflowID)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSkipDependentTasks ensures that the ids of transitively skipped tasks are returned using sqlmock
+func TestSkipDependentTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectQuery("WITH RECURSIVE dependents(.+)UPDATE tasks SET state = 'skipped'").
+		WithArgs(int32(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8).AddRow(9))
+
+	skipped, err := queries.SkipDependentTasks(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{8, 9}, skipped)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateTasks ensures that a batch of tasks is inserted in one statement and its IDs returned with their position using sqlmock
+func TestCreateTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectQuery("WITH batch AS \\(\\s*SELECT nextval\\('tasks_id_seq'\\)(.+)FROM unnest(.+)WITH ORDINALITY(.+)INSERT INTO tasks(.+)SELECT inserted.id, batch.ord").
+		WithArgs("{3,4}", "{30,40}", `{"","nightly"}`, `{"default","team-a"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ord"}).AddRow(12, 2).AddRow(11, 1))
+
+	rows, err := queries.CreateTasks(context.Background(), CreateTasksParams{
+		TaskTypes:  []int32{3, 4},
+		TaskValues: []int32{30, 40},
+		Comments:   []string{"", "nightly"},
+		Namespaces: []string{"default", "team-a"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []CreateTasksRow{{ID: 12, Ord: 2}, {ID: 11, Ord: 1}}, rows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestClaimTasks ensures that received tasks, and processing ones whose lease expired, are claimed
+// for processing with a lease and SKIP LOCKED using sqlmock
+func TestClaimTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	leaseExpiry := sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+	mock.ExpectQuery("UPDATE tasks SET state = 'processing', lease_expiry = (.+)WHERE namespace = (.+)state = 'received' OR \\(state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP\\)(.+)FOR UPDATE SKIP LOCKED").
+		WithArgs(leaseExpiry, "default", int32(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(5, 2, 20, "processing", time.Now(), time.Now(), nil, []byte("null"), time.Time{}, nil, "default", leaseExpiry.Time))
+
+	tasks, err := queries.ClaimTasks(context.Background(), ClaimTasksParams{
+		LeaseExpiry: leaseExpiry,
+		Namespace:   "default",
+		Limit:       10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, int32(5), tasks[0].ID)
+	assert.True(t, tasks[0].LeaseExpiry.Valid)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestPeekClaimableTasks ensures that the namespaces of the next claimable tasks are returned in claim order using sqlmock
+func TestPeekClaimableTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectQuery("SELECT namespace FROM tasks(.+)ORDER BY id").
+		WithArgs(int32(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"namespace"}).AddRow("team-a").AddRow("default"))
+
+	namespaces, err := queries.PeekClaimableTasks(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "default"}, namespaces)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRequeueExpiredTasks ensures that processing tasks whose lease expired are moved back to "received" using sqlmock
+func TestRequeueExpiredTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectQuery("UPDATE tasks SET state = 'received', lease_expiry = NULL(.+)state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP(.+)FOR UPDATE SKIP LOCKED").
+		WithArgs(int32(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "state", "creation_time", "last_update_time", "comment", "result", "run_at", "workflow_id", "namespace", "lease_expiry"}).
+			AddRow(8, 1, 10, "received", time.Now(), time.Now(), nil, []byte("null"), time.Time{}, nil, "team-a", nil))
+
+	tasks, err := queries.RequeueExpiredTasks(context.Background(), 50)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "received", tasks[0].State.String)
+	assert.False(t, tasks[0].LeaseExpiry.Valid)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestNotifyTasks ensures that one notification is fired per task ID using sqlmock
+func TestNotifyTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectExec("SELECT pg_notify\\('tasks', id::TEXT\\) FROM unnest").
+		WithArgs("{7,8}").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	assert.NoError(t, queries.NotifyTasks(context.Background(), []int32{7, 8}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestListTaskEvents ensures that the transitions of a task are listed in order using sqlmock
+func TestListTaskEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM task_events WHERE task_id = \\$1 ORDER BY id").
+		WithArgs(int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "old_state", "new_state", "event_time", "actor", "error"}).
+			AddRow(1, 5, nil, "received", now, "producer@host-1", nil).
+			AddRow(2, 5, "received", "processing", now, "consumer@host-2", nil))
+
+	events, err := queries.ListTaskEvents(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.False(t, events[0].OldState.Valid)
+	assert.Equal(t, "processing", events[1].NewState)
+	assert.Equal(t, "consumer@host-2", events[1].Actor)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCountBacklogTasks ensures that dispatched but unfinished tasks are counted per namespace using sqlmock
+func TestCountBacklogTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectQuery("SELECT namespace, COUNT(.+) FROM tasks(.+)state IN \\('received', 'processing'\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"namespace", "count"}).AddRow("default", 12).AddRow("team-a", 3))
+
+	counts, err := queries.CountBacklogTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []CountBacklogTasksRow{{Namespace: "default", Count: 12}, {Namespace: "team-a", Count: 3}}, counts)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestClaimOutboxEntries ensures that undelivered outbox entries are leased and returned with their task using sqlmock
+func TestClaimOutboxEntries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+	leaseUntil := time.Now().Add(30 * time.Second)
+
+	mock.ExpectQuery("UPDATE task_outbox o SET next_attempt_time(.+)state = 'pending'(.+)FOR UPDATE SKIP LOCKED").
+		WithArgs(leaseUntil, int32(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "namespace", "attempts", "type", "value"}).
+			AddRow(4, 17, "team-a", 2, 3, 30))
+
+	entries, err := queries.ClaimOutboxEntries(context.Background(), ClaimOutboxEntriesParams{NextAttemptTime: leaseUntil, Limit: 50})
+	assert.NoError(t, err)
+	assert.Equal(t, []ClaimOutboxEntriesRow{{
+		ID:        4,
+		TaskID:    17,
+		Namespace: "team-a",
+		Attempts:  2,
+		Type:      sql.NullInt32{Int32: 3, Valid: true},
+		Value:     sql.NullInt32{Int32: 30, Valid: true},
+	}}, entries)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMarkOutboxSent ensures that only a pending entry is marked sent, reporting whether it was using sqlmock
+func TestMarkOutboxSent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+
+	mock.ExpectExec("UPDATE task_outbox SET state = 'sent'(.+)state = 'pending'").
+		WithArgs(int32(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE task_outbox SET state = 'sent'(.+)state = 'pending'").
+		WithArgs(int32(4)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	sent, err := queries.MarkOutboxSent(context.Background(), 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), sent)
+
+	sent, err = queries.MarkOutboxSent(context.Background(), 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), sent)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteExpiredTasks ensures that a bounded batch of expired tasks is deleted along with the rows referencing them using sqlmock
+func TestDeleteExpiredTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+
+	mock.ExpectExec("WITH expired AS \\(\\s*SELECT id FROM tasks(.+)LIMIT \\$3(.+)FOR UPDATE SKIP LOCKED(.+)DELETE FROM task_events(.+)DELETE FROM task_outbox(.+)DELETE FROM task_dependencies(.+)DELETE FROM tasks WHERE id IN").
+		WithArgs(`{"done"}`, cutoff, int32(500)).
+		WillReturnResult(sqlmock.NewResult(0, 500))
+
+	deleted, err := queries.DeleteExpiredTasks(context.Background(), DeleteExpiredTasksParams{
+		States:    []string{"done"},
+		Cutoff:    cutoff,
+		BatchSize: 500,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), deleted)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestArchiveExpiredTasks ensures that expired tasks are moved into tasks_archive using sqlmock
+func TestArchiveExpiredTasks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := New(db)
+	cutoff := time.Now().Add(-24 * time.Hour)
+
+	mock.ExpectExec("WITH expired AS(.+)archived AS \\(\\s*DELETE FROM tasks(.+)RETURNING(.+)INSERT INTO tasks_archive(.+)FROM archived").
+		WithArgs(`{"done","skipped"}`, cutoff, int32(100)).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+
+	archived, err := queries.ArchiveExpiredTasks(context.Background(), ArchiveExpiredTasksParams{
+		States:    []string{"done", "skipped"},
+		Cutoff:    cutoff,
+		BatchSize: 100,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), archived)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,352 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "modernc.org/sqlite" // Registers the pure-Go "sqlite" driver
+)
+
+// Database drivers, selected with database.driver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// OpenSQLite opens the SQLite database file at path, migrated with migrations/sqlite. Writers wait
+// for each other instead of failing, transactions take the write lock up front, and foreign keys
+// are enforced as they are on Postgres.
+func OpenSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("database.path must be set for the %s driver", DriverSQLite)
+	}
+	return sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate")
+}
+
+// The SQLite dialect of the task lifecycle queries in sql/queries.sql, which are all the SQLiteStore runs
+const sqliteCreateTask = `-- name: CreateTask :one
+INSERT INTO tasks (type, value, state, comment, namespace)
+VALUES (?1, ?2, 'received', ?3, ?4)
+RETURNING id
+`
+
+const sqliteScheduleTask = `-- name: ScheduleTask :one
+INSERT INTO tasks (type, value, state, comment, run_at, namespace)
+VALUES (?1, ?2, 'scheduled', ?3, ?4, ?5)
+RETURNING id
+`
+
+const sqliteGetTaskByID = `-- name: GetTaskByID :one
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE id = ?1 AND namespace = ?2
+`
+
+const sqliteGetTasksByState = `-- name: GetTasksByState :many
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace, lease_expiry FROM tasks WHERE state = ?1 AND namespace = ?2 ORDER BY id
+`
+
+const sqliteMarkTaskProcessing = `-- name: MarkTaskProcessing :one
+UPDATE tasks SET state = 'processing', lease_expiry = ?3, last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = ?1 AND namespace = ?2 AND state = 'received'
+RETURNING creation_time
+`
+
+const sqliteCompleteTask = `-- name: CompleteTask :one
+UPDATE tasks SET state = 'done', result = ?2, last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = ?1 AND state = 'processing' AND lease_expiry = ?3
+RETURNING type, value, namespace
+`
+
+const sqliteIncrementTaskTypeStats = `-- name: IncrementTaskTypeStats :one
+INSERT INTO task_type_stats (namespace, type, count, sum, min, max)
+VALUES (?1, ?2, 1, ?3, ?3, ?3)
+ON CONFLICT (namespace, type) DO UPDATE SET count = task_type_stats.count + 1,
+                                 sum = task_type_stats.sum + excluded.sum,
+                                 min = min(task_type_stats.min, excluded.min),
+                                 max = max(task_type_stats.max, excluded.max),
+                                 last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now')
+RETURNING type, count, sum, min, max, last_update_time, namespace
+`
+
+const sqliteFailTask = `-- name: FailTask :execrows
+UPDATE tasks SET state = 'failed', result = ?2, last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = ?1 AND state = 'processing' AND lease_expiry = ?3
+`
+
+const sqliteAbandonTask = `-- name: AbandonTask :execrows
+UPDATE tasks SET state = 'failed', result = ?2, last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = ?1 AND state = 'received'
+`
+
+const sqliteReleaseTask = `-- name: ReleaseTask :execrows
+UPDATE tasks SET state = 'received', lease_expiry = NULL, last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = ?1 AND state = 'processing' AND lease_expiry = ?2
+`
+
+const sqliteSkipDependentTasks = `-- name: SkipDependentTasks :many
+WITH RECURSIVE dependents AS (
+    SELECT d.task_id FROM task_dependencies d WHERE d.depends_on_id = ?1
+    UNION
+    SELECT d.task_id FROM task_dependencies d JOIN dependents ON d.depends_on_id = dependents.task_id
+)
+UPDATE tasks SET state = 'skipped', last_update_time = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id IN (SELECT task_id FROM dependents) AND state = 'pending'
+RETURNING id
+`
+
+const sqliteListTaskTypeStats = `-- name: ListTaskTypeStats :many
+SELECT type, count, sum, min, max, last_update_time, namespace FROM task_type_stats WHERE namespace = ?1 ORDER BY type
+`
+
+// sqliteTimeFormat is how timestamps are written, matching the column defaults so they compare as text
+const sqliteTimeFormat = "2006-01-02 15:04:05.000"
+
+// SQLiteStore is the TaskStore of a SQLite database, for single-node deployments. Its schema mirrors
+// the Postgres one, except that JSON is stored as text. Of the queries in sql/queries.sql it only
+// mirrors those of the task lifecycle; the other features need Postgres.
+type SQLiteStore struct {
+	db TxDB
+	// tx is the caller's transaction the store runs in; nil when it runs transactions of its own
+	tx *sql.Tx
+}
+
+func NewSQLiteStore(db TxDB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) WithTx(tx *sql.Tx) TaskStore {
+	return &SQLiteStore{db: s.db, tx: tx}
+}
+
+func (s *SQLiteStore) CreateTask(ctx context.Context, arg CreateTaskParams) (int32, error) {
+	row := s.conn().QueryRowContext(ctx, sqliteCreateTask, arg.Type, arg.Value, arg.Comment, arg.Namespace)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+func (s *SQLiteStore) ScheduleTask(ctx context.Context, arg ScheduleTaskParams) (int32, error) {
+	row := s.conn().QueryRowContext(ctx, sqliteScheduleTask,
+		arg.Type,
+		arg.Value,
+		arg.Comment,
+		arg.RunAt.UTC().Format(sqliteTimeFormat),
+		arg.Namespace,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+func (s *SQLiteStore) GetTask(ctx context.Context, arg GetTaskByIDParams) (Task, error) {
+	return scanSQLiteTask(s.conn().QueryRowContext(ctx, sqliteGetTaskByID, arg.ID, arg.Namespace))
+}
+
+func (s *SQLiteStore) ListTasks(ctx context.Context, arg GetTasksByStateParams) ([]Task, error) {
+	rows, err := s.conn().QueryContext(ctx, sqliteGetTasksByState, arg.State, arg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		i, err := scanSQLiteTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *SQLiteStore) StartTask(ctx context.Context, arg MarkTaskProcessingParams) (sql.NullTime, error) {
+	row := s.conn().QueryRowContext(ctx, sqliteMarkTaskProcessing, arg.ID, arg.Namespace, sqliteTime(arg.LeaseExpiry))
+	var creationTime sql.NullTime
+	err := row.Scan(&creationTime)
+	return creationTime, err
+}
+
+// CompleteTask updates the task and the stats in one transaction, so the stats never drift from the tasks table
+func (s *SQLiteStore) CompleteTask(ctx context.Context, arg CompleteTaskParams) (TaskTypeStat, error) {
+	var i TaskTypeStat
+	err := inTx(ctx, s.db, s.tx, func(tx DBTX) error {
+		// No row means the lease expired and the task went to another consumer, which counts it
+		var task CompleteTaskRow
+		err := tx.QueryRowContext(ctx, sqliteCompleteTask, arg.ID, string(arg.Result), sqliteTime(arg.LeaseExpiry)).
+			Scan(&task.Type, &task.Value, &task.Namespace)
+		if err != nil || !task.Type.Valid || !task.Value.Valid {
+			return err
+		}
+
+		row := tx.QueryRowContext(ctx, sqliteIncrementTaskTypeStats, task.Namespace, task.Type.Int32, int64(task.Value.Int32))
+		return row.Scan(
+			&i.Type,
+			&i.Count,
+			&i.Sum,
+			&i.Min,
+			&i.Max,
+			&i.LastUpdateTime,
+			&i.Namespace,
+		)
+	})
+	if err != nil {
+		return TaskTypeStat{}, err
+	}
+	return i, nil
+}
+
+// FailTask skips the dependents of the task, transitively, in the transaction that fails it
+func (s *SQLiteStore) FailTask(ctx context.Context, arg FailTaskParams) ([]int32, error) {
+	var skipped []int32
+	err := inTx(ctx, s.db, s.tx, func(tx DBTX) error {
+		failed, err := execRows(tx.ExecContext(ctx, sqliteFailTask, arg.ID, string(arg.Result), sqliteTime(arg.LeaseExpiry)))
+		if err != nil {
+			return err
+		}
+		if failed == 0 {
+			return sql.ErrNoRows
+		}
+
+		skipped, err = skipSQLiteDependentTasks(ctx, tx, arg.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// AbandonTask skips the dependents of the task in the transaction that fails it, unless the task was started meanwhile
+func (s *SQLiteStore) AbandonTask(ctx context.Context, arg AbandonTaskParams) ([]int32, error) {
+	var skipped []int32
+	err := inTx(ctx, s.db, s.tx, func(tx DBTX) error {
+		abandoned, err := execRows(tx.ExecContext(ctx, sqliteAbandonTask, arg.ID, string(arg.Result)))
+		if err != nil {
+			return err
+		}
+		if abandoned == 0 {
+			return sql.ErrNoRows
+		}
+
+		skipped, err = skipSQLiteDependentTasks(ctx, tx, arg.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+func (s *SQLiteStore) ReleaseTask(ctx context.Context, arg ReleaseTaskParams) error {
+	released, err := execRows(s.conn().ExecContext(ctx, sqliteReleaseTask, arg.ID, sqliteTime(arg.LeaseExpiry)))
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// skipSQLiteDependentTasks skips the pending tasks depending on a task, transitively, and returns their IDs
+func skipSQLiteDependentTasks(ctx context.Context, tx DBTX, id int32) ([]int32, error) {
+	rows, err := tx.QueryContext(ctx, sqliteSkipDependentTasks, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var skipped []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		skipped = append(skipped, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+func (s *SQLiteStore) ListTaskTypeStats(ctx context.Context, namespace string) ([]TaskTypeStat, error) {
+	rows, err := s.conn().QueryContext(ctx, sqliteListTaskTypeStats, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskTypeStat
+	for rows.Next() {
+		var i TaskTypeStat
+		if err := rows.Scan(
+			&i.Type,
+			&i.Count,
+			&i.Sum,
+			&i.Min,
+			&i.Max,
+			&i.LastUpdateTime,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// conn returns the caller's transaction the store runs in, or else the database
+func (s *SQLiteStore) conn() DBTX {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// sqliteTime formats a nullable timestamp as it is stored, so it compares equal to the stored value
+func sqliteTime(t sql.NullTime) sql.NullString {
+	if !t.Valid {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Time.UTC().Format(sqliteTimeFormat), Valid: true}
+}
+
+// execRows returns the number of rows changed by a statement
+func execRows(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanSQLiteTask scans a tasks row, whose result the driver returns as text
+func scanSQLiteTask(row interface{ Scan(dest ...any) error }) (Task, error) {
+	var i Task
+	var result []byte
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.Value,
+		&i.State,
+		&i.CreationTime,
+		&i.LastUpdateTime,
+		&i.Comment,
+		&result,
+		&i.RunAt,
+		&i.WorkflowID,
+		&i.Namespace,
+		&i.LeaseExpiry,
+	)
+	i.Result = json.RawMessage(result)
+	return i, err
+}
@@ -0,0 +1,67 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TaskStore is the lifecycle of a task, from creation to its final state, independent of where
+// tasks are stored. A task or transition that does not apply is reported as sql.ErrNoRows, as
+// it is by the generated queries.
+type TaskStore interface {
+	// CreateTask stores a "received" task and returns its ID
+	CreateTask(ctx context.Context, arg CreateTaskParams) (int32, error)
+	// ScheduleTask stores a "scheduled" task, due at RunAt, and returns its ID
+	ScheduleTask(ctx context.Context, arg ScheduleTaskParams) (int32, error)
+	// GetTask returns a task of a namespace
+	GetTask(ctx context.Context, arg GetTaskByIDParams) (Task, error)
+	// ListTasks returns the tasks of a namespace in a state, by ID
+	ListTasks(ctx context.Context, arg GetTasksByStateParams) ([]Task, error)
+	// StartTask moves a "received" task to "processing", leased until LeaseExpiry, and returns its
+	// creation time. A task that is no longer "received" is not found, so a task is started once
+	// however often it is delivered.
+	StartTask(ctx context.Context, arg MarkTaskProcessingParams) (sql.NullTime, error)
+	// CompleteTask marks a task "done" with its result and folds its stored value into the stats of
+	// its type, atomically, returning the updated stats. Only the consumer still holding the lease of a
+	// "processing" task completes it; once its lease was lost the task is not found. A task without a
+	// type or value is left out of the stats, as RebuildTaskTypeStats leaves it out, and zero stats are
+	// returned for it.
+	CompleteTask(ctx context.Context, arg CompleteTaskParams) (TaskTypeStat, error)
+	// FailTask marks a task "failed" with its result and skips the pending tasks depending on it,
+	// atomically, returning the IDs of the skipped tasks. Like CompleteTask, it needs the lease.
+	FailTask(ctx context.Context, arg FailTaskParams) ([]int32, error)
+	// AbandonTask fails a task that could not be delivered and skips the pending tasks depending on
+	// it, like FailTask, but only while the task is still "received". A task a consumer already
+	// started is left to its outcome and not found.
+	AbandonTask(ctx context.Context, arg AbandonTaskParams) ([]int32, error)
+	// ReleaseTask moves a "processing" task back to "received", giving up its lease, so it is delivered
+	// again, e.g. after its caller gave up on it mid-run. Like CompleteTask, it needs the lease.
+	ReleaseTask(ctx context.Context, arg ReleaseTaskParams) error
+	// ListTaskTypeStats returns the stats of every task type of a namespace, by type
+	ListTaskTypeStats(ctx context.Context, namespace string) ([]TaskTypeStat, error)
+	// WithTx returns the store running in tx, so tasks are written atomically with rows of the
+	// caller's, such as their outbox entries. Committing or rolling back tx is left to the caller.
+	WithTx(tx *sql.Tx) TaskStore
+}
+
+// inTx runs fn in tx, the caller's transaction a store runs in, or else when tx is nil in a transaction
+// of its own on db that is committed once fn succeeds
+func inTx(ctx context.Context, db TxDB, tx *sql.Tx, fn func(tx DBTX) error) error {
+	if tx != nil {
+		return fn(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,495 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMemoryStore runs the TaskStore conformance suite against the in-memory store
+func TestMemoryStore(t *testing.T) {
+	testTaskStore(t, NewMemoryStore())
+}
+
+// TestPostgresStore runs the TaskStore conformance suite against the database at TASKS_TEST_DATABASE_URL,
+// with the migrations applied. Every run works in a namespace of its own, whose rows are left behind.
+func TestPostgresStore(t *testing.T) {
+	dbSource := os.Getenv("TASKS_TEST_DATABASE_URL")
+	if dbSource == "" {
+		t.Skip("TASKS_TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbSource)
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	testTaskStore(t, NewPostgresStore(db))
+	testTaskStoreTx(t, db, NewPostgresStore(db))
+}
+
+// TestSQLiteStore runs the TaskStore conformance suite against a SQLite database migrated with migrations/sqlite
+func TestSQLiteStore(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "tasks.db"))
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	migrateSQLite(t, db, "up")
+
+	testTaskStore(t, NewSQLiteStore(db))
+	testTaskStoreTx(t, db, NewSQLiteStore(db))
+}
+
+// TestSQLiteMigrations ensures that the SQLite migrations apply, record task events and revert cleanly
+func TestSQLiteMigrations(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "tasks.db"))
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	migrateSQLite(t, db, "up")
+
+	store := NewSQLiteStore(db)
+	id, err := store.CreateTask(context.Background(), CreateTaskParams{
+		Type:      sql.NullInt32{Int32: 1, Valid: true},
+		Value:     sql.NullInt32{Int32: 1, Valid: true},
+		Namespace: "default",
+	})
+	assert.NoError(t, err)
+	lease := testLease()
+	_, err = store.StartTask(context.Background(), MarkTaskProcessingParams{ID: id, Namespace: "default", LeaseExpiry: lease})
+	assert.NoError(t, err)
+	_, err = store.FailTask(context.Background(), FailTaskParams{ID: id, Result: json.RawMessage(`{"error": "boom"}`), LeaseExpiry: lease})
+	assert.NoError(t, err)
+
+	var events int
+	var lastError string
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*), MAX(error) FROM task_events WHERE task_id = ?", id).Scan(&events, &lastError))
+	assert.Equal(t, 3, events)
+	assert.Equal(t, "boom", lastError)
+
+	// Reverting workflows refuses to rewrite the failed task's history, and leaves it as it was
+	migration, err := os.ReadFile(filepath.Join("..", "migrations", "sqlite", "000008_create_workflows.down.sql"))
+	assert.NoError(t, err)
+	_, err = db.Exec(string(migration))
+	assert.ErrorContains(t, err, "no_failed_or_skipped_tasks")
+	task, err := store.GetTask(context.Background(), GetTaskByIDParams{ID: id, Namespace: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", task.State.String)
+
+	// Down to an empty database and back up again, once the failed task is gone
+	_, err = db.Exec("DELETE FROM task_events; DELETE FROM tasks")
+	assert.NoError(t, err)
+	migrateSQLite(t, db, "down")
+	var tables int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name <> 'sqlite_sequence'").Scan(&tables))
+	assert.Equal(t, 0, tables)
+	migrateSQLite(t, db, "up")
+}
+
+// migrateSQLite applies every migration of migrations/sqlite in the direction given, "up" or "down"
+func migrateSQLite(t *testing.T, db *sql.DB, direction string) {
+	files, err := filepath.Glob(filepath.Join("..", "migrations", "sqlite", "*."+direction+".sql"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 14)
+	sort.Strings(files)
+	if direction == "down" {
+		sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	}
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		_, err = db.Exec(string(migration))
+		if !assert.NoError(t, err, file) {
+			t.FailNow()
+		}
+	}
+}
+
+// testTaskStoreTx ensures that a store running in a transaction of its caller is rolled back with it,
+// including the methods that otherwise run a transaction of their own
+func testTaskStoreTx(t *testing.T, db *sql.DB, store TaskStore) {
+	ctx := context.Background()
+	namespace := fmt.Sprintf("conformance-tx-%d", time.Now().UnixNano())
+
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	txStore := store.WithTx(tx)
+	id, err := txStore.CreateTask(ctx, CreateTaskParams{
+		Type:      sql.NullInt32{Int32: 1, Valid: true},
+		Value:     sql.NullInt32{Int32: 1, Valid: true},
+		Namespace: namespace,
+	})
+	assert.NoError(t, err)
+	lease := testLease()
+	_, err = txStore.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace, LeaseExpiry: lease})
+	assert.NoError(t, err)
+	_, err = txStore.CompleteTask(ctx, CompleteTaskParams{ID: id, Result: json.RawMessage("null"), LeaseExpiry: lease})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	_, err = store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	stats, err := store.ListTaskTypeStats(ctx, namespace)
+	assert.NoError(t, err)
+	assert.Empty(t, stats)
+}
+
+// testLease returns a lease a minute out, to the millisecond that every store keeps
+func testLease() sql.NullTime {
+	return sql.NullTime{Time: time.Now().Add(time.Minute).Truncate(time.Millisecond), Valid: true}
+}
+
+// testTaskStore is the behaviour every TaskStore shares. It only touches tasks of its own namespaces,
+// so it can run against a database in use.
+func testTaskStore(t *testing.T, store TaskStore) {
+	ctx := context.Background()
+	namespace := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+	create := func(taskType int32, value int32) int32 {
+		id, err := store.CreateTask(ctx, CreateTaskParams{
+			Type:      sql.NullInt32{Int32: taskType, Valid: true},
+			Value:     sql.NullInt32{Int32: value, Valid: true},
+			Comment:   sql.NullString{String: "conformance", Valid: true},
+			Namespace: namespace,
+		})
+		assert.NoError(t, err)
+		return id
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		id := create(3, 42)
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, id, task.ID)
+		assert.Equal(t, int32(3), task.Type.Int32)
+		assert.Equal(t, int32(42), task.Value.Int32)
+		assert.Equal(t, "received", task.State.String)
+		assert.Equal(t, "conformance", task.Comment.String)
+		assert.True(t, task.CreationTime.Valid)
+		assert.JSONEq(t, "null", string(task.Result))
+
+		_, err = store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace + "-other"})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		_, err := store.CreateTask(ctx, CreateTaskParams{
+			Type:      sql.NullInt32{Int32: 10, Valid: true},
+			Value:     sql.NullInt32{Int32: 1, Valid: true},
+			Namespace: namespace,
+		})
+		assert.Error(t, err)
+		_, err = store.CreateTask(ctx, CreateTaskParams{
+			Type:      sql.NullInt32{Int32: 1, Valid: true},
+			Value:     sql.NullInt32{Int32: 100, Valid: true},
+			Namespace: namespace,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		runAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+		id, err := store.ScheduleTask(ctx, ScheduleTaskParams{
+			Type:      sql.NullInt32{Int32: 6, Valid: true},
+			Value:     sql.NullInt32{Int32: 6, Valid: true},
+			RunAt:     runAt,
+			Namespace: namespace,
+		})
+		assert.NoError(t, err)
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "scheduled", task.State.String)
+		assert.WithinDuration(t, runAt, task.RunAt, time.Millisecond)
+
+		// Only received tasks are started
+		_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("start once", func(t *testing.T) {
+		id := create(1, 1)
+
+		_, err := store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace + "-other"})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		leaseExpiry := time.Now().Add(time.Minute)
+		creationTime, err := store.StartTask(ctx, MarkTaskProcessingParams{
+			ID:          id,
+			Namespace:   namespace,
+			LeaseExpiry: sql.NullTime{Time: leaseExpiry, Valid: true},
+		})
+		assert.NoError(t, err)
+		assert.True(t, creationTime.Valid)
+
+		_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "processing", task.State.String)
+		assert.True(t, task.LeaseExpiry.Valid)
+		assert.WithinDuration(t, leaseExpiry, task.LeaseExpiry.Time, time.Millisecond)
+	})
+
+	t.Run("concurrent starts", func(t *testing.T) {
+		id := create(2, 2)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		started := 0
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace}); err == nil {
+					mu.Lock()
+					started++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, started)
+	})
+
+	t.Run("complete and stats", func(t *testing.T) {
+		statsNamespace := namespace + "-stats"
+		for _, value := range []int32{10, 30, 20} {
+			id, err := store.CreateTask(ctx, CreateTaskParams{
+				Type:      sql.NullInt32{Int32: 5, Valid: true},
+				Value:     sql.NullInt32{Int32: value, Valid: true},
+				Namespace: statsNamespace,
+			})
+			assert.NoError(t, err)
+			lease := testLease()
+			_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: statsNamespace, LeaseExpiry: lease})
+			assert.NoError(t, err)
+			_, err = store.CompleteTask(ctx, CompleteTaskParams{
+				ID:          id,
+				Result:      json.RawMessage(`{"value": 1}`),
+				LeaseExpiry: lease,
+			})
+			assert.NoError(t, err)
+
+			task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: statsNamespace})
+			assert.NoError(t, err)
+			assert.Equal(t, "done", task.State.String)
+			assert.JSONEq(t, `{"value": 1}`, string(task.Result))
+		}
+		typeStats, err := store.ListTaskTypeStats(ctx, statsNamespace)
+		assert.NoError(t, err)
+		if assert.Len(t, typeStats, 1) {
+			assert.Equal(t, int32(5), typeStats[0].Type)
+			assert.Equal(t, int64(3), typeStats[0].Count)
+			assert.Equal(t, int64(60), typeStats[0].Sum)
+			assert.Equal(t, int32(10), typeStats[0].Min)
+			assert.Equal(t, int32(30), typeStats[0].Max)
+		}
+
+		typeStats, err = store.ListTaskTypeStats(ctx, namespace+"-empty")
+		assert.NoError(t, err)
+		assert.Empty(t, typeStats)
+	})
+
+	t.Run("complete missing task", func(t *testing.T) {
+		statsNamespace := namespace + "-missing"
+		_, err := store.CompleteTask(ctx, CompleteTaskParams{Result: json.RawMessage("null"), LeaseExpiry: testLease()})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		typeStats, err := store.ListTaskTypeStats(ctx, statsNamespace)
+		assert.NoError(t, err)
+		assert.Empty(t, typeStats)
+	})
+
+	t.Run("complete without value", func(t *testing.T) {
+		statsNamespace := namespace + "-novalue"
+		id, err := store.CreateTask(ctx, CreateTaskParams{
+			Type:      sql.NullInt32{Int32: 6, Valid: true},
+			Namespace: statsNamespace,
+		})
+		assert.NoError(t, err)
+		lease := testLease()
+		_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: statsNamespace, LeaseExpiry: lease})
+		assert.NoError(t, err)
+
+		// Like a stats rebuild, the stats leave out a task without a value
+		stats, err := store.CompleteTask(ctx, CompleteTaskParams{ID: id, Result: json.RawMessage("null"), LeaseExpiry: lease})
+		assert.NoError(t, err)
+		assert.Equal(t, TaskTypeStat{}, stats)
+
+		typeStats, err := store.ListTaskTypeStats(ctx, statsNamespace)
+		assert.NoError(t, err)
+		assert.Empty(t, typeStats)
+	})
+
+	t.Run("complete twice", func(t *testing.T) {
+		statsNamespace := namespace + "-twice"
+		id, err := store.CreateTask(ctx, CreateTaskParams{
+			Type:      sql.NullInt32{Int32: 3, Valid: true},
+			Value:     sql.NullInt32{Int32: 9, Valid: true},
+			Namespace: statsNamespace,
+		})
+		assert.NoError(t, err)
+		lease := testLease()
+		_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: statsNamespace, LeaseExpiry: lease})
+		assert.NoError(t, err)
+
+		completion := CompleteTaskParams{ID: id, Result: json.RawMessage("null"), LeaseExpiry: lease}
+		stats, err := store.CompleteTask(ctx, completion)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Count)
+
+		// The task is already done, so it is not counted again
+		_, err = store.CompleteTask(ctx, completion)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		typeStats, err := store.ListTaskTypeStats(ctx, statsNamespace)
+		assert.NoError(t, err)
+		if assert.Len(t, typeStats, 1) {
+			assert.Equal(t, int64(1), typeStats[0].Count)
+			assert.Equal(t, int64(9), typeStats[0].Sum)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		id := create(4, 4)
+		lease := testLease()
+		_, err := store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace, LeaseExpiry: lease})
+		assert.NoError(t, err)
+
+		skipped, err := store.FailTask(ctx, FailTaskParams{ID: id, Result: json.RawMessage(`{"error": "boom"}`), LeaseExpiry: lease})
+		assert.NoError(t, err)
+		assert.Empty(t, skipped)
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "failed", task.State.String)
+		assert.JSONEq(t, `{"error": "boom"}`, string(task.Result))
+	})
+
+	t.Run("lease", func(t *testing.T) {
+		id := create(4, 7)
+		lease := testLease()
+		_, err := store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace, LeaseExpiry: lease})
+		assert.NoError(t, err)
+
+		// A consumer holding another lease, e.g. one taken over since, changes nothing
+		other := sql.NullTime{Time: lease.Time.Add(time.Second), Valid: true}
+		_, err = store.CompleteTask(ctx, CompleteTaskParams{ID: id, Result: json.RawMessage("null"), LeaseExpiry: other})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.FailTask(ctx, FailTaskParams{ID: id, Result: json.RawMessage(`{"error": "late"}`), LeaseExpiry: other})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = store.CompleteTask(ctx, CompleteTaskParams{ID: id, Result: json.RawMessage(`{"value": 7}`), LeaseExpiry: lease})
+		assert.NoError(t, err)
+
+		// A late failure does not turn a done task into a failed one
+		_, err = store.FailTask(ctx, FailTaskParams{ID: id, Result: json.RawMessage(`{"error": "late"}`), LeaseExpiry: lease})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "done", task.State.String)
+		assert.JSONEq(t, `{"value": 7}`, string(task.Result))
+	})
+
+	t.Run("abandon", func(t *testing.T) {
+		id := create(4, 5)
+		skipped, err := store.AbandonTask(ctx, AbandonTaskParams{ID: id, Result: json.RawMessage(`{"error": "unreachable"}`)})
+		assert.NoError(t, err)
+		assert.Empty(t, skipped)
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "failed", task.State.String)
+
+		// A task a consumer started keeps its outcome
+		id = create(4, 6)
+		_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		_, err = store.AbandonTask(ctx, AbandonTaskParams{ID: id, Result: json.RawMessage(`{"error": "unreachable"}`)})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		task, err = store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "processing", task.State.String)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		id := create(4, 7)
+		lease := testLease()
+		_, err := store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace, LeaseExpiry: lease})
+		assert.NoError(t, err)
+
+		// Only the holder of the lease releases the task
+		err = store.ReleaseTask(ctx, ReleaseTaskParams{ID: id, LeaseExpiry: sql.NullTime{Time: lease.Time.Add(time.Second), Valid: true}})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.NoError(t, store.ReleaseTask(ctx, ReleaseTaskParams{ID: id, LeaseExpiry: lease}))
+
+		task, err := store.GetTask(ctx, GetTaskByIDParams{ID: id, Namespace: namespace})
+		assert.NoError(t, err)
+		assert.Equal(t, "received", task.State.String)
+		assert.False(t, task.LeaseExpiry.Valid)
+
+		// The released task is started again by its next delivery
+		_, err = store.StartTask(ctx, MarkTaskProcessingParams{ID: id, Namespace: namespace, LeaseExpiry: testLease()})
+		assert.NoError(t, err)
+	})
+
+	t.Run("list by state", func(t *testing.T) {
+		listNamespace := namespace + "-list"
+		var ids []int32
+		for i := int32(0); i < 3; i++ {
+			id, err := store.CreateTask(ctx, CreateTaskParams{
+				Type:      sql.NullInt32{Int32: i, Valid: true},
+				Value:     sql.NullInt32{Int32: i, Valid: true},
+				Namespace: listNamespace,
+			})
+			assert.NoError(t, err)
+			ids = append(ids, id)
+		}
+		_, err := store.StartTask(ctx, MarkTaskProcessingParams{ID: ids[1], Namespace: listNamespace})
+		assert.NoError(t, err)
+
+		received, err := store.ListTasks(ctx, GetTasksByStateParams{
+			State:     sql.NullString{String: "received", Valid: true},
+			Namespace: listNamespace,
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, received, 2) {
+			assert.Equal(t, ids[0], received[0].ID)
+			assert.Equal(t, ids[2], received[1].ID)
+		}
+
+		processing, err := store.ListTasks(ctx, GetTasksByStateParams{
+			State:     sql.NullString{String: "processing", Valid: true},
+			Namespace: listNamespace,
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, processing, 1) {
+			assert.Equal(t, ids[1], processing[0].ID)
+		}
+	})
+}
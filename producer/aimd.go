@@ -0,0 +1,139 @@
+package main
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"grpc-in-go/pb"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateController adapts the production rate to the consumer's load hints with AIMD: the rate grows
+// by a fixed step per interval while deliveries succeed, and is cut by a factor when the consumer reports
+// overload or sheds work. It never exceeds the sum of the rates the consumer suggests for its namespaces.
+type rateController struct {
+	minRate  float64
+	maxRate  float64
+	increase float64
+	decrease float64
+	interval time.Duration
+
+	mu           sync.Mutex
+	rate         float64
+	lastIncrease time.Time
+	lastDecrease time.Time
+	suggested    map[string]float64
+	delivered    int
+	lastObserved time.Time
+}
+
+func newRateController(config AdaptiveRate) *rateController {
+	c := &rateController{
+		minRate:      config.MinRate,
+		maxRate:      config.MaxRate,
+		increase:     config.IncreaseRate,
+		decrease:     config.DecreaseFactor,
+		interval:     time.Duration(config.AdjustIntervalMs) * time.Millisecond,
+		rate:         config.InitialRate,
+		suggested:    make(map[string]float64),
+		lastObserved: time.Now(),
+	}
+	if c.minRate <= 0 {
+		c.minRate = 1
+	}
+	if c.maxRate < c.minRate {
+		c.maxRate = math.Inf(1)
+	}
+	if c.increase <= 0 {
+		c.increase = 10
+	}
+	if c.decrease <= 0 || c.decrease >= 1 {
+		c.decrease = 0.5
+	}
+	if c.interval <= 0 {
+		c.interval = time.Second
+	}
+	c.rate = math.Min(math.Max(c.rate, c.minRate), c.maxRate)
+	adaptiveRate.Set(c.rate)
+	return c
+}
+
+// limit returns the tasks per second the producer may currently send
+func (c *rateController) limit() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rate
+}
+
+// observe adjusts the rate with the outcome of one delivery to a namespace
+func (c *rateController) observe(namespace string, hint *pb.LoadHint, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if hint.GetSuggestedRate() > 0 {
+		c.suggested[namespace] = hint.GetSuggestedRate()
+	}
+
+	if err == nil {
+		c.delivered++
+	}
+
+	// A shed or refused task is as clear a signal of overload as the hint itself
+	code := status.Code(err)
+	switch {
+	case hint.GetOverloaded() || code == codes.ResourceExhausted || code == codes.Unavailable:
+		// Cut at most once per interval, so a burst of responses to the same overload does not collapse the rate
+		if now.Sub(c.lastDecrease) >= c.interval {
+			c.rate = math.Max(c.rate*c.decrease, c.minRate)
+			c.lastDecrease = now
+			c.lastIncrease = now
+		}
+	case err == nil:
+		if now.Sub(c.lastIncrease) >= c.interval {
+			c.rate = math.Min(c.rate+c.increase, c.maxRate)
+			c.lastIncrease = now
+		}
+	}
+
+	if ceiling := c.ceiling(); c.rate > ceiling {
+		c.rate = math.Max(ceiling, c.minRate)
+	}
+	adaptiveRate.Set(c.rate)
+}
+
+// ceiling returns the sum of the rates suggested per namespace, or +Inf before any was suggested
+func (c *rateController) ceiling() float64 {
+	if len(c.suggested) == 0 {
+		return math.Inf(1)
+	}
+	total := 0.0
+	for _, rate := range c.suggested {
+		total += rate
+	}
+	return total
+}
+
+// observedRate returns the tasks per second delivered since it was last called
+func (c *rateController) observedRate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(c.delivered) / now.Sub(c.lastObserved).Seconds()
+	c.delivered = 0
+	c.lastObserved = now
+	return rate
+}
+
+// runObservedRate exports the delivered rate every interval, to plot against the adaptive target
+func (c *rateController) runObservedRate() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		observedRate.Set(c.observedRate())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"sync"
+	"time"
+)
+
+// backlog counts, per namespace, the tasks sent to the consumer that it has not processed yet.
+// It is safe for concurrent use by the production loop, the scheduler and every outbox delivery.
+type backlog struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newBacklog() *backlog {
+	return &backlog{counts: make(map[string]int)}
+}
+
+// add changes the backlog of a namespace by delta and returns its new size
+func (b *backlog) add(namespace string, delta int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.counts[namespace] += delta
+	size := b.counts[namespace]
+	backlogSize.With(prometheus.Labels{"namespace": namespace}).Set(float64(size))
+	return size
+}
+
+// size returns the backlog of a namespace
+func (b *backlog) size(namespace string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.counts[namespace]
+}
+
+// reset replaces every count with the given ones, zeroing namespaces that are not listed,
+// and returns by how much each namespace's count changed
+func (b *backlog) reset(counts map[string]int) map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	drift := make(map[string]int, len(counts))
+	for namespace, size := range b.counts {
+		drift[namespace] = -size
+	}
+	for namespace, size := range counts {
+		drift[namespace] += size
+	}
+	for namespace := range drift {
+		b.counts[namespace] = counts[namespace]
+		backlogSize.With(prometheus.Labels{"namespace": namespace}).Set(float64(counts[namespace]))
+	}
+	return drift
+}
+
+// syncBacklog sets the backlog to the number of dispatched tasks the database has not seen
+// finish, i.e. those "received" or "processing", and logs any namespace whose count drifted
+func syncBacklog(ctx context.Context, queries *persistence.Queries, b *backlog) error {
+	rows, err := queries.CountBacklogTasks(ctx)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Namespace] = int(row.Count)
+	}
+
+	for namespace, drift := range b.reset(counts) {
+		if drift != 0 {
+			logger.LogInfo("Backlog reconciled with database", &logger.LogContext{
+				"namespace":    namespace,
+				"backlog_size": counts[namespace],
+				"drift":        drift,
+			})
+		}
+	}
+	return nil
+}
+
+// runBacklogReconciler periodically resets the in-memory backlog to the database counts, correcting
+// drift from tasks that were lost in flight or processed while the producer was not tracking them
+func runBacklogReconciler(queries *persistence.Queries, b *backlog, config Backlog) {
+	ticker := time.NewTicker(time.Duration(config.ReconcileIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := syncBacklog(context.Background(), queries, b); err != nil {
+			logger.LogError("Failed to reconcile backlog", err, &logger.LogContext{})
+		}
+	}
+}
+
+// namespaceBacklog returns the backlog the max_backlog decision is based on: the authoritative
+// database count when configured, or the in-memory count if that is not configured or fails
+func namespaceBacklog(queries *persistence.Queries, b *backlog, config Backlog, namespace string) int {
+	if !config.UseDBCount {
+		return b.size(namespace)
+	}
+
+	count, err := queries.CountNamespaceBacklog(context.Background(), namespace)
+	if err != nil {
+		logger.LogError("Failed to count backlog, using in-memory count", err, &logger.LogContext{
+			"namespace": namespace,
+		})
+		return b.size(namespace)
+	}
+	return int(count)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"time"
+)
+
+// batchWriter stores immediate tasks in batches: a batch is flushed once it holds size tasks, or
+// flushInterval after its first task arrived, with one multi-row INSERT for the tasks and one dispatch
+// of the whole batch in a single transaction. The stored tasks are then delivered like any other.
+type batchWriter struct {
+	db            txBeginner
+	queries       *persistence.Queries
+	dispatcher    dispatcher
+	size          int
+	flushInterval time.Duration
+	tasks         chan sourceTask
+}
+
+func newBatchWriter(db txBeginner, queries *persistence.Queries, d dispatcher, config Batch) *batchWriter {
+	flushInterval := time.Duration(config.FlushIntervalMs) * time.Millisecond
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Millisecond
+	}
+	return &batchWriter{
+		db:            db,
+		queries:       queries,
+		dispatcher:    d,
+		size:          config.Size,
+		flushInterval: flushInterval,
+		tasks:         make(chan sourceTask, config.Size),
+	}
+}
+
+// add queues a task for the next batch. The task joins the backlog right away, so max_backlog
+// still holds while it waits; add blocks once a full batch is waiting on a flush.
+func (w *batchWriter) add(task sourceTask) {
+	size := currentBacklog.add(task.Namespace, 1)
+	logger.LogInfo(fmt.Sprintf("Current backlog size: %d", size), &logger.LogContext{
+		"namespace":    task.Namespace,
+		"backlog_size": size,
+	})
+	w.tasks <- task
+}
+
+// run collects the queued tasks into batches and flushes them
+func (w *batchWriter) run() {
+	batch := make([]sourceTask, 0, w.size)
+	// deadline is nil, blocking forever, while the batch is empty
+	var deadline <-chan time.Time
+
+	for {
+		select {
+		case task := <-w.tasks:
+			batch = append(batch, task)
+			if len(batch) == 1 {
+				deadline = time.After(w.flushInterval)
+			}
+			if len(batch) < w.size {
+				continue
+			}
+		case <-deadline:
+		}
+
+		w.flush(batch)
+		batch = batch[:0]
+		deadline = nil
+	}
+}
+
+// flush stores a batch and sends its tasks. A batch that cannot be stored is dropped as a whole,
+// like a single task whose createTask fails, and leaves the backlog.
+func (w *batchWriter) flush(batch []sourceTask) {
+	start := time.Now()
+	entries, err := w.insert(batch)
+	taskBatchSize.Observe(float64(len(batch)))
+	taskBatchFlushDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		taskProductionFailures.Add(float64(len(batch)))
+		logger.LogError("Failed to create task batch", err, &logger.LogContext{
+			"batch_size": len(batch),
+		})
+		for _, task := range batch {
+			currentBacklog.add(task.Namespace, -1)
+		}
+		return
+	}
+
+	tasksProduced.Add(float64(len(batch)))
+	logger.LogInfo("Task batch created", &logger.LogContext{
+		"batch_size":     len(batch),
+		"first_task_id":  entries[0].TaskID,
+		"last_task_id":   entries[len(entries)-1].TaskID,
+		"flush_duration": time.Since(start),
+	})
+
+	for _, entry := range entries {
+		w.dispatcher.send(entry)
+	}
+}
+
+// insert stores and dispatches a batch of tasks, returning what to send in batch order
+func (w *batchWriter) insert(batch []sourceTask) ([]persistence.ClaimOutboxEntriesRow, error) {
+	ctx := context.Background()
+
+	params := persistence.CreateTasksParams{
+		TaskTypes:  make([]int32, 0, len(batch)),
+		TaskValues: make([]int32, 0, len(batch)),
+		Comments:   make([]string, 0, len(batch)),
+		Namespaces: make([]string, 0, len(batch)),
+	}
+	for _, task := range batch {
+		params.TaskTypes = append(params.TaskTypes, int32(task.Type))
+		params.TaskValues = append(params.TaskValues, int32(task.Value))
+		params.Comments = append(params.Comments, task.Comment)
+		params.Namespaces = append(params.Namespaces, task.Namespace)
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	qtx := w.queries.WithTx(tx)
+	rows, err := qtx.CreateTasks(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != len(batch) {
+		return nil, fmt.Errorf("created %d tasks for a batch of %d", len(rows), len(batch))
+	}
+
+	// Each ID comes back with the 1-based position of its task in the batch, in no particular order
+	stored := make([]persistence.Task, len(batch))
+	for _, row := range rows {
+		if row.Ord < 1 || row.Ord > int64(len(batch)) || stored[row.Ord-1].ID != 0 {
+			return nil, fmt.Errorf("created task %d at unexpected position %d of a batch of %d", row.ID, row.Ord, len(batch))
+		}
+		task := batch[row.Ord-1]
+		stored[row.Ord-1] = persistence.Task{
+			ID:        row.ID,
+			Type:      sql.NullInt32{Int32: int32(task.Type), Valid: true},
+			Value:     sql.NullInt32{Int32: int32(task.Value), Valid: true},
+			Namespace: task.Namespace,
+		}
+	}
+	entries, err := w.dispatcher.enqueueBatch(ctx, qtx, stored)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Distribution kinds
+const (
+	distributionUniform  = "uniform"
+	distributionWeighted = "weighted"
+	distributionZipf     = "zipf"
+	distributionNormal   = "normal"
+	distributionFixed    = "fixed"
+)
+
+// sampler draws one value of a task field
+type sampler func() int
+
+// newSampler returns a sampler of the distribution that never leaves [low, high], the bounds the
+// tasks table CHECK constraints put on the field. It draws from rng, so a seeded run stays reproducible.
+func newSampler(config Distribution, low int, high int, rng *rand.Rand) (sampler, error) {
+	switch config.Kind {
+	case "", distributionUniform:
+		return func() int {
+			return low + rng.Intn(high-low+1)
+		}, nil
+
+	case distributionWeighted:
+		if len(config.Weights) == 0 || len(config.Weights) > high-low+1 {
+			return nil, fmt.Errorf("weights must list 1 to %d weights, got %d", high-low+1, len(config.Weights))
+		}
+		// cumulative[i] is the total weight of the values up to low+i
+		cumulative := make([]float64, len(config.Weights))
+		total := 0.0
+		for i, weight := range config.Weights {
+			if weight < 0 {
+				return nil, fmt.Errorf("weight %d must not be negative, got %v", i, weight)
+			}
+			total += weight
+			cumulative[i] = total
+		}
+		if total <= 0 {
+			return nil, fmt.Errorf("weights must not all be zero")
+		}
+		return func() int {
+			target := rng.Float64() * total
+			for i, bound := range cumulative {
+				if target < bound {
+					return low + i
+				}
+			}
+			// Unreachable but for rounding, target is below the total weight
+			return low + len(cumulative) - 1
+		}, nil
+
+	case distributionZipf:
+		if config.S <= 1 || config.V < 1 {
+			return nil, fmt.Errorf("zipf needs s > 1 and v >= 1, got s %v and v %v", config.S, config.V)
+		}
+		// Ranks start at low, which is drawn most often
+		zipf := rand.NewZipf(rng, config.S, config.V, uint64(high-low))
+		return func() int {
+			return low + int(zipf.Uint64())
+		}, nil
+
+	case distributionNormal:
+		if config.StdDev < 0 {
+			return nil, fmt.Errorf("std_dev must not be negative, got %v", config.StdDev)
+		}
+		return func() int {
+			// Clamp before converting, so a mean far outside the bounds cannot overflow
+			value := math.Round(rng.NormFloat64()*config.StdDev + config.Mean)
+			return int(math.Max(float64(low), math.Min(float64(high), value)))
+		}, nil
+
+	case distributionFixed:
+		if config.Value < low || config.Value > high {
+			return nil, fmt.Errorf("value %d is outside [%d, %d]", config.Value, low, high)
+		}
+		return func() int {
+			return config.Value
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", config.Kind)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"strconv"
+	"time"
+)
+
+// Dry-run sinks
+const (
+	sinkNoop     = "noop"
+	sinkConsumer = "consumer"
+)
+
+// dryRunMetadataKey marks the requests of a dry run, which the consumer answers without touching its database
+const dryRunMetadataKey = "x-dry-run"
+
+// dryRunSendTimeout bounds a SendTask call of the consumer sink, which has no outbox lease to bound it
+const dryRunSendTimeout = 30 * time.Second
+
+// taskSink receives the tasks of a dry run; satisfied by pb.TaskServiceClient
+type taskSink interface {
+	SendTask(ctx context.Context, in *pb.TaskRequest, opts ...grpc.CallOption) (*pb.TaskResponse, error)
+}
+
+// noopSink acknowledges every task after a fixed latency, standing in for a consumer
+type noopSink struct {
+	latency time.Duration
+}
+
+func (s noopSink) SendTask(ctx context.Context, in *pb.TaskRequest, _ ...grpc.CallOption) (*pb.TaskResponse, error) {
+	if s.latency > 0 {
+		timer := time.NewTimer(s.latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return &pb.TaskResponse{Result: fmt.Sprintf("dry run: task %d not processed", in.GetId())}, nil
+}
+
+// directProducer produces tasks without the outbox: deferred tasks wait on a timer instead of the
+// scheduler, and deliveries are not retried, so failed deliveries fail their task. Metrics, logs and
+// the backlog are kept as in a regular run. A dry run keeps its tasks in a MemoryStore, so the sources,
+// load profiles and rate control can be exercised on their own.
+type directProducer struct {
+	sink taskSink
+	// dryRun marks every request, so the consumer does not look the in-memory IDs up in its database
+	dryRun bool
+	// store holds the tasks and assigns their IDs
+	store persistence.TaskStore
+	// controller is told the outcome of every delivery; nil when adaptive_rate is disabled
+	controller *rateController
+}
+
+// newDryRun returns a dry run delivering to the configured sink, and a function releasing the sink
+func newDryRun(config Config) (*directProducer, func(), error) {
+	switch config.DryRun.Sink {
+	case "", sinkNoop:
+		sink := noopSink{latency: time.Duration(config.DryRun.SinkLatencyMs) * time.Millisecond}
+		return &directProducer{sink: sink, dryRun: true, store: persistence.NewMemoryStore()}, func() {}, nil
+	case sinkConsumer:
+		conn, err := grpc.Dial(config.Producer.GrpcConsumerUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &directProducer{sink: pb.NewTaskServiceClient(conn), dryRun: true, store: persistence.NewMemoryStore()}, func() { _ = conn.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown dry run sink %q", config.DryRun.Sink)
+	}
+}
+
+// newSQLiteProducer returns a producer storing tasks in a SQLite database and sending them to
+// grpc_consumer_url, and a function releasing the connection
+func newSQLiteProducer(config Config, store persistence.TaskStore) (*directProducer, func(), error) {
+	conn, err := grpc.Dial(config.Producer.GrpcConsumerUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &directProducer{sink: pb.NewTaskServiceClient(conn), store: store}, func() { _ = conn.Close() }, nil
+}
+
+// produce stands in for produceTask: it assigns the task an ID and dispatches it, right away or once due
+func (d *directProducer) produce(task sourceTask) {
+	id, err := d.create(task)
+	if err != nil {
+		taskProductionFailures.Inc()
+		logger.LogError("Failed to create task", err, &logger.LogContext{
+			"namespace": task.Namespace,
+		})
+		return
+	}
+	tasksProduced.Inc()
+	logger.LogInfo("Task created", &logger.LogContext{
+		"task_id":    id,
+		"namespace":  task.Namespace,
+		"task_type":  task.Type,
+		"task_value": task.Value,
+		"run_at":     task.RunAt,
+		"dry_run":    d.dryRun,
+	})
+
+	if delay := time.Until(task.RunAt); !task.RunAt.IsZero() && delay > 0 {
+		time.AfterFunc(delay, func() {
+			d.dispatch(id, task)
+		})
+		return
+	}
+	d.dispatch(id, task)
+}
+
+// create stores the task as "received" and returns its ID
+func (d *directProducer) create(task sourceTask) (int32, error) {
+	return d.store.CreateTask(context.Background(), persistence.CreateTaskParams{
+		Type:      sql.NullInt32{Int32: int32(task.Type), Valid: true},
+		Value:     sql.NullInt32{Int32: int32(task.Value), Valid: true},
+		Comment:   sql.NullString{String: task.Comment, Valid: task.Comment != ""},
+		Namespace: task.Namespace,
+	})
+}
+
+// dispatch adds a task to the backlog and delivers it to the sink in the background. The task
+// leaves the backlog with the response whatever its outcome, as there is no outbox to retry it.
+func (d *directProducer) dispatch(id int32, task sourceTask) {
+	size := currentBacklog.add(task.Namespace, 1)
+	logger.LogInfo(fmt.Sprintf("Current backlog size: %d", size), &logger.LogContext{
+		"namespace":    task.Namespace,
+		"backlog_size": size,
+	})
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dryRunSendTimeout)
+		defer cancel()
+		if d.dryRun {
+			ctx = metadata.AppendToOutgoingContext(ctx, dryRunMetadataKey, "true")
+		}
+
+		start := time.Now()
+		res, err := d.sink.SendTask(ctx, &pb.TaskRequest{
+			Id:        id,
+			Type:      int32(task.Type),
+			Value:     int32(task.Value),
+			Namespace: task.Namespace,
+		})
+		taskSendDuration.With(prometheus.Labels{
+			"namespace": task.Namespace,
+			"task_type": strconv.Itoa(task.Type),
+			"outcome":   outcomeLabel(err),
+		}).Observe(time.Since(start).Seconds())
+		if d.controller != nil {
+			d.controller.observe(task.Namespace, res.GetLoad(), err)
+		}
+
+		size := currentBacklog.add(task.Namespace, -1)
+		if err != nil {
+			logger.LogError("Failed to send task", err, &logger.LogContext{
+				"task_id":   id,
+				"namespace": task.Namespace,
+				"dry_run":   d.dryRun,
+			})
+			d.fail(id, err)
+			return
+		}
+		logger.LogInfo("Task processed, backlog decremented", &logger.LogContext{
+			"task_id":   id,
+			"namespace": task.Namespace,
+			"backlog":   size,
+			"result":    res.GetResult(),
+		})
+	}()
+}
+
+// fail records a delivery that failed on a stored task, which would otherwise stay "received" for good.
+// A task the consumer started before its response was lost keeps the outcome the consumer records.
+func (d *directProducer) fail(id int32, sendErr error) {
+	result, err := json.Marshal(map[string]string{"error": sendErr.Error()})
+	if err == nil {
+		_, err = d.store.AbandonTask(context.Background(), persistence.AbandonTaskParams{ID: id, Result: result})
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		logger.LogError("Failed to mark task failed", err, &logger.LogContext{
+			"task_id": id,
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"grpc-in-go/util/logger"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// The delays between retries of a failed Accept
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// ingestSource hands out tasks pushed to it over HTTP or a Unix socket. The channel is unbuffered,
+// so senders are held back until the producer is ready for another task.
+type ingestSource struct {
+	tasks chan sourceTask
+}
+
+func newIngestSource() *ingestSource {
+	return &ingestSource{tasks: make(chan sourceTask)}
+}
+
+func (s *ingestSource) Next(ctx context.Context) (sourceTask, error) {
+	select {
+	case <-ctx.Done():
+		return sourceTask{}, ctx.Err()
+	case task := <-s.tasks:
+		return task, nil
+	}
+}
+
+// ingest reads JSONL tasks from r and queues each one, stopping at the first invalid line.
+// It returns how many tasks were queued.
+func (s *ingestSource) ingest(ctx context.Context, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTaskLineBytes)
+
+	accepted := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		task, err := decodeTask(scanner.Bytes())
+		if err != nil {
+			return accepted, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return accepted, ctx.Err()
+		case s.tasks <- task:
+			accepted++
+		}
+	}
+	return accepted, scanner.Err()
+}
+
+// ingestResponse is returned to HTTP and socket clients once their tasks are queued
+type ingestResponse struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// newHTTPSource accepts JSONL tasks POSTed to /tasks on addr
+func newHTTPSource(addr string) (*ingestSource, error) {
+	if addr == "" {
+		return nil, errors.New("source.http_addr is required for the http source")
+	}
+	source := newIngestSource()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks", source.handleTasks)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		logger.LogInfo("Accepting tasks over HTTP", &logger.LogContext{
+			"url": fmt.Sprintf("http://%s/tasks", listener.Addr()),
+		})
+		if err := http.Serve(listener, mux); err != nil {
+			logger.LogError("Task ingest server stopped", err, &logger.LogContext{
+				"addr": addr,
+			})
+		}
+	}()
+
+	return source, nil
+}
+
+// handleTasks queues the JSONL tasks of a POST body, answering 202 with the accepted count,
+// or 400 with the count accepted before the first invalid line
+func (s *ingestSource) handleTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accepted, err := s.ingest(r.Context(), r.Body)
+	res := ingestResponse{Accepted: accepted}
+	status := http.StatusAccepted
+	if err != nil {
+		res.Error = err.Error()
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// newUnixSource accepts JSONL tasks streamed over connections to the Unix socket at path.
+// Each connection gets one response line once it is closed for writing or sends an invalid task.
+func newUnixSource(path string) (*ingestSource, error) {
+	if path == "" {
+		return nil, errors.New("source.path is required for the unix source")
+	}
+	// A socket left behind by a previous run would make Listen fail
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	source := newIngestSource()
+	go func() {
+		logger.LogInfo("Accepting tasks over Unix socket", &logger.LogContext{
+			"path": path,
+		})
+		source.serve(listener)
+		logger.LogInfo("Task ingest socket closed", &logger.LogContext{
+			"path": path,
+		})
+	}()
+
+	return source, nil
+}
+
+// serve accepts connections until the listener is closed. Other accept errors, such as running out
+// of file descriptors, are retried after a backoff that doubles up to maxAcceptBackoff, as net/http does.
+func (s *ingestSource) serve(listener net.Listener) {
+	var backoff time.Duration
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else {
+				backoff = min(2*backoff, maxAcceptBackoff)
+			}
+			logger.LogError("Failed to accept task ingest connection, retrying", err, &logger.LogContext{
+				"addr":        listener.Addr().String(),
+				"retry_after": backoff,
+			})
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		go s.serveConn(conn)
+	}
+}
+
+func (s *ingestSource) serveConn(conn net.Conn) {
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	accepted, err := s.ingest(context.Background(), conn)
+	res := ingestResponse{Accepted: accepted}
+	if err != nil {
+		res.Error = err.Error()
+		logger.LogError("Rejected task from Unix socket", err, &logger.LogContext{
+			"accepted": accepted,
+		})
+	}
+	_ = json.NewEncoder(conn).Encode(res)
+}
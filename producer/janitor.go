@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Retention actions
+const (
+	retentionDelete  = "delete"
+	retentionArchive = "archive"
+)
+
+// janitor removes the tasks the retention policy has expired, deleting them or moving them into
+// tasks_archive. Each batch is one statement claiming its tasks with FOR UPDATE SKIP LOCKED, so
+// locks stay short and several producers can run the janitor side by side.
+type janitor struct {
+	queries   *persistence.Queries
+	action    string
+	states    []string
+	maxAge    time.Duration
+	batchSize int32
+}
+
+// newJanitor validates the retention policy and fills in its defaults
+func newJanitor(queries *persistence.Queries, config Retention) (*janitor, error) {
+	action := config.Action
+	switch action {
+	case "":
+		action = retentionDelete
+	case retentionDelete, retentionArchive:
+	default:
+		return nil, fmt.Errorf("unknown retention action %q", config.Action)
+	}
+	if config.MaxAgeDays <= 0 {
+		return nil, fmt.Errorf("retention.max_age_days must be positive, got %d", config.MaxAgeDays)
+	}
+	states := config.States
+	if len(states) == 0 {
+		states = []string{"done"}
+	}
+	// Only finished tasks may be removed, or the janitor would take tasks from under the consumers
+	for _, state := range states {
+		switch state {
+		case "done", "failed", "skipped":
+		default:
+			return nil, fmt.Errorf("retention.states may only hold done, failed and skipped, got %q", state)
+		}
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &janitor{
+		queries:   queries,
+		action:    action,
+		states:    states,
+		maxAge:    time.Duration(config.MaxAgeDays) * 24 * time.Hour,
+		batchSize: int32(batchSize),
+	}, nil
+}
+
+// run purges expired tasks every interval
+func (j *janitor) run(config Retention) {
+	interval := time.Duration(config.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := j.purge(context.Background(), time.Now())
+		if err != nil {
+			logger.LogError("Failed to purge expired tasks", err, &logger.LogContext{
+				"action":  j.action,
+				"removed": removed,
+			})
+			continue
+		}
+		if removed > 0 {
+			logger.LogInfo("Purged expired tasks", &logger.LogContext{
+				"action":  j.action,
+				"removed": removed,
+				"states":  j.states,
+			})
+		}
+	}
+}
+
+// purge removes the tasks that expired by now, a batch at a time until a batch comes back short,
+// and returns how many it removed
+func (j *janitor) purge(ctx context.Context, now time.Time) (int64, error) {
+	cutoff := now.Add(-j.maxAge)
+	var total int64
+	for {
+		removed, err := j.purgeBatch(ctx, cutoff)
+		total += removed
+		if err != nil {
+			return total, err
+		}
+		tasksPurged.With(prometheus.Labels{"action": j.action}).Add(float64(removed))
+		if removed < int64(j.batchSize) {
+			return total, nil
+		}
+	}
+}
+
+func (j *janitor) purgeBatch(ctx context.Context, cutoff time.Time) (int64, error) {
+	if j.action == retentionArchive {
+		return j.queries.ArchiveExpiredTasks(ctx, persistence.ArchiveExpiredTasksParams{
+			States:    j.states,
+			Cutoff:    cutoff,
+			BatchSize: j.batchSize,
+		})
+	}
+	return j.queries.DeleteExpiredTasks(ctx, persistence.DeleteExpiredTasksParams{
+		States:    j.states,
+		Cutoff:    cutoff,
+		BatchSize: j.batchSize,
+	})
+}
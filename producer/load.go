@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Load phase shapes
+const (
+	shapeConstant = "constant"
+	shapeRamp     = "ramp"
+	shapeStep     = "step"
+	shapeSine     = "sine"
+	shapeBurst    = "burst"
+	shapePoisson  = "poisson"
+)
+
+// loadIdlePoll is how often a waiting source checks whether its target rate changed
+const loadIdlePoll = 10 * time.Millisecond
+
+// loadProfile is the sequence of load phases the random source follows
+type loadProfile struct {
+	phases []LoadPhase
+	total  time.Duration
+	repeat bool
+}
+
+// newLoadProfile validates the configured phases. Without phases the profile is a constant rate
+// of one task per rate_limiter.ticker_time, repeated forever.
+func newLoadProfile(config Load, rateLimiter RateLimiter) (*loadProfile, error) {
+	phases := config.Phases
+	repeat := config.Repeat
+	if len(phases) == 0 {
+		if rateLimiter.TickerTime <= 0 {
+			return nil, fmt.Errorf("rate_limiter.ticker_time must be positive, got %v", rateLimiter.TickerTime)
+		}
+		phases = []LoadPhase{{
+			Shape:      shapeConstant,
+			DurationMs: int(time.Hour / time.Millisecond),
+			Rate:       float64(time.Second/time.Microsecond) / rateLimiter.TickerTime,
+		}}
+		repeat = true
+	}
+
+	var total time.Duration
+	for i, phase := range phases {
+		if err := validateLoadPhase(phase); err != nil {
+			return nil, fmt.Errorf("load phase %d: %w", i, err)
+		}
+		total += phase.duration()
+	}
+
+	return &loadProfile{phases: phases, total: total, repeat: repeat}, nil
+}
+
+func validateLoadPhase(phase LoadPhase) error {
+	if phase.DurationMs <= 0 {
+		return fmt.Errorf("duration_ms must be positive, got %d", phase.DurationMs)
+	}
+	if phase.Rate < 0 || phase.From < 0 || phase.To < 0 {
+		return fmt.Errorf("rates must not be negative")
+	}
+
+	switch phase.Shape {
+	case shapeConstant, shapePoisson, shapeRamp:
+	case shapeStep:
+		if phase.Steps < 1 {
+			return fmt.Errorf("steps must be at least 1, got %d", phase.Steps)
+		}
+	case shapeSine:
+		if phase.PeriodMs <= 0 {
+			return fmt.Errorf("period_ms must be positive, got %d", phase.PeriodMs)
+		}
+	case shapeBurst:
+		if phase.BurstMs <= 0 || phase.IdleMs < 0 {
+			return fmt.Errorf("burst_ms must be positive and idle_ms not negative")
+		}
+	default:
+		return fmt.Errorf("unknown shape %q", phase.Shape)
+	}
+	return nil
+}
+
+// at returns the phase active at elapsed time into the profile and how far into that phase it is.
+// ok is false once a profile that does not repeat has run its course.
+func (p *loadProfile) at(elapsed time.Duration) (phase LoadPhase, offset time.Duration, ok bool) {
+	if elapsed >= p.total {
+		if !p.repeat {
+			return LoadPhase{}, 0, false
+		}
+		elapsed %= p.total
+	}
+
+	for _, phase := range p.phases {
+		if elapsed < phase.duration() {
+			return phase, elapsed, true
+		}
+		elapsed -= phase.duration()
+	}
+	// Unreachable, elapsed is below the total duration of the phases
+	return p.phases[len(p.phases)-1], elapsed, true
+}
+
+func (phase LoadPhase) duration() time.Duration {
+	return time.Duration(phase.DurationMs) * time.Millisecond
+}
+
+// rate returns the target tasks per second offset into the phase
+func (phase LoadPhase) rate(offset time.Duration) float64 {
+	progress := float64(offset) / float64(phase.duration())
+
+	switch phase.Shape {
+	case shapeRamp:
+		return phase.From + (phase.To-phase.From)*progress
+	case shapeStep:
+		// Steps equal increments from From to To, each held for an equal share of the phase
+		step := math.Min(math.Floor(progress*float64(phase.Steps+1)), float64(phase.Steps))
+		return phase.From + (phase.To-phase.From)*step/float64(phase.Steps)
+	case shapeSine:
+		period := time.Duration(phase.PeriodMs) * time.Millisecond
+		rate := phase.Rate + phase.Amplitude*math.Sin(2*math.Pi*float64(offset)/float64(period))
+		return math.Max(rate, 0)
+	case shapeBurst:
+		cycle := time.Duration(phase.BurstMs+phase.IdleMs) * time.Millisecond
+		if offset%cycle < time.Duration(phase.BurstMs)*time.Millisecond {
+			return phase.Rate
+		}
+		return 0
+	default:
+		return phase.Rate
+	}
+}
+
+// interval returns the time until the next task at the given rate: fixed for every shape
+// but poisson, whose arrivals are exponentially distributed around the same mean
+func (phase LoadPhase) interval(rate float64, rng *rand.Rand) time.Duration {
+	mean := float64(time.Second) / rate
+	if phase.Shape == shapePoisson {
+		return time.Duration(rng.ExpFloat64() * mean)
+	}
+	return time.Duration(mean)
+}
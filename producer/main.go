@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,11 +14,14 @@ import (
 	"grpc-in-go/pb"
 	"grpc-in-go/persistence"
 	"grpc-in-go/util"
+	"grpc-in-go/util/breaker"
 	"grpc-in-go/util/logger"
-	"math/rand"
+	"io"
 	"net/http"
 	_ "net/http/pprof" // This import is necessary to initialize the pprof endpoints
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -31,23 +35,87 @@ var (
 		Name: "task_production_failures_total",
 		Help: "Total number of task production failures",
 	})
-	backlogSize = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "task_producer_backlog_size",
-		Help: "Current number of unprocessed tasks in the backlog",
+	backlogSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "task_producer_backlog_size",
+			Help: "Current number of unprocessed tasks in the backlog",
+		},
+		[]string{"namespace"},
+	)
+	dbCircuitBreakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_circuit_breaker_state",
+		Help: "State of the database circuit breaker: 0 closed, 1 half-open, 2 open",
+	})
+	producerTargetRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_producer_target_rate",
+		Help: "Tasks per second the load profile of the random task source currently aims for",
+	})
+	adaptiveRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_producer_adaptive_rate",
+		Help: "Tasks per second the AIMD controller currently allows, based on the consumer's load hints",
+	})
+	observedRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "task_producer_observed_rate",
+		Help: "Tasks per second the consumer acknowledged over the last adjust interval",
+	})
+	taskBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "task_producer_batch_size",
+		Help:    "Number of tasks stored by each batched INSERT",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+	})
+	taskBatchFlushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "task_producer_batch_flush_duration_seconds",
+		Help:    "Latency of storing a batch of tasks with their outbox entries",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
 	})
+	tasksPurged = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "task_janitor_purged_total",
+			Help: "Total number of expired tasks the retention janitor deleted or archived",
+		},
+		[]string{"action"},
+	)
+	taskSendDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_send_duration_seconds",
+			Help:    "Latency of the SendTask RPC to the consumer",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		},
+		[]string{"namespace", "task_type", "outcome"},
+	)
 )
 
 // Config struct to hold configuration values
 type Config struct {
-	Database    Database          `mapstructure:"database"`
-	Producer    Producer          `mapstructure:"producer"`
-	Prometheus  Prometheus        `mapstructure:"prometheus"`
-	Logger      *logger.LogConfig `mapstructure:"logger"`
-	RateLimiter RateLimiter       `mapstructure:"rate_limiter"`
-	MaxBackLog  int               `mapstructure:"max_backlog"`
+	Database       Database          `mapstructure:"database"`
+	Producer       Producer          `mapstructure:"producer"`
+	Prometheus     Prometheus        `mapstructure:"prometheus"`
+	Logger         *logger.LogConfig `mapstructure:"logger"`
+	RateLimiter    RateLimiter       `mapstructure:"rate_limiter"`
+	CircuitBreaker CircuitBreaker    `mapstructure:"circuit_breaker"`
+	Scheduler      Scheduler         `mapstructure:"scheduler"`
+	Recurring      Recurring         `mapstructure:"recurring"`
+	Backlog        Backlog           `mapstructure:"backlog"`
+	Source         Source            `mapstructure:"source"`
+	Load           Load              `mapstructure:"load"`
+	Distributions  Distributions     `mapstructure:"distributions"`
+	Outbox         Outbox            `mapstructure:"outbox"`
+	Batch          Batch             `mapstructure:"batch"`
+	Dispatch       Dispatch          `mapstructure:"dispatch"`
+	AdaptiveRate   AdaptiveRate      `mapstructure:"adaptive_rate"`
+	DryRun         DryRun            `mapstructure:"dry_run"`
+	Retention      Retention         `mapstructure:"retention"`
+	MaxBackLog     int               `mapstructure:"max_backlog"`
+	// Seed makes the random source reproducible; 0 seeds it from the clock and logs the seed
+	Seed int64 `mapstructure:"seed"`
+	// Namespaces generated tasks are spread across, each with its own backlog cap
+	Namespaces []Namespace `mapstructure:"namespaces"`
 }
 
 type Database struct {
+	// Driver is "postgres" (default) or "sqlite", which keeps the tasks in the file at Path
+	Driver   string `mapstructure:"driver"`
+	Path     string `mapstructure:"path"`
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	User     string `mapstructure:"user"`
@@ -70,13 +138,190 @@ type RateLimiter struct {
 	TickerTime float64 `mapstructure:"ticker_time"`
 }
 
-var currentBacklog int
+type Scheduler struct {
+	PollIntervalMs int `mapstructure:"poll_interval_ms"`
+	BatchSize      int `mapstructure:"batch_size"`
+	// DelayedRatio is the fraction of generated tasks deferred by up to MaxDelayMs
+	DelayedRatio float64 `mapstructure:"delayed_ratio"`
+	MaxDelayMs   int     `mapstructure:"max_delay_ms"`
+}
+
+type Recurring struct {
+	Enabled        bool `mapstructure:"enabled"`
+	PollIntervalMs int  `mapstructure:"poll_interval_ms"`
+	// Fires missed by more than MisfireThresholdMs are skipped for definitions without catch_up
+	MisfireThresholdMs int `mapstructure:"misfire_threshold_ms"`
+	// MaxCatchUp bounds how many missed fires a catch_up definition replays after downtime; 100 when not set
+	MaxCatchUp int `mapstructure:"max_catch_up"`
+}
+
+type AdaptiveRate struct {
+	// Enabled caps the random source at a rate adapted to the consumer's load hints
+	Enabled     bool    `mapstructure:"enabled"`
+	InitialRate float64 `mapstructure:"initial_rate"`
+	MinRate     float64 `mapstructure:"min_rate"`
+	MaxRate     float64 `mapstructure:"max_rate"`
+	// IncreaseRate is added once per AdjustIntervalMs while deliveries succeed
+	IncreaseRate float64 `mapstructure:"increase_rate"`
+	// DecreaseFactor multiplies the rate, at most once per AdjustIntervalMs, when the consumer is overloaded
+	DecreaseFactor   float64 `mapstructure:"decrease_factor"`
+	AdjustIntervalMs int     `mapstructure:"adjust_interval_ms"`
+}
+
+type Dispatch struct {
+	// Transport is "grpc" (default), pushing tasks to grpc_consumer_url through the outbox, or "notify",
+	// firing pg_notify('tasks', id) for the consumers to claim the task from the database
+	Transport string `mapstructure:"transport"`
+}
+
+type Batch struct {
+	// Size is the most tasks stored by one INSERT; 0 or 1 stores every task on its own
+	Size int `mapstructure:"size"`
+	// FlushIntervalMs is the longest a task waits for its batch to fill up
+	FlushIntervalMs int `mapstructure:"flush_interval_ms"`
+}
+
+type DryRun struct {
+	// Enabled produces without a database, delivering to Sink: scheduled, recurring and workflow tasks are not dispatched
+	Enabled bool `mapstructure:"enabled"`
+	// Sink is "noop" (default), which acknowledges every task in-process, or "consumer", which sends to grpc_consumer_url
+	Sink string `mapstructure:"sink"`
+	// SinkLatencyMs delays the acknowledgements of the noop sink, to stand in for a consumer's processing time
+	SinkLatencyMs int `mapstructure:"sink_latency_ms"`
+}
+
+type Retention struct {
+	// Enabled runs the janitor, which removes tasks in States that last changed over MaxAgeDays ago
+	Enabled    bool     `mapstructure:"enabled"`
+	MaxAgeDays int      `mapstructure:"max_age_days"`
+	States     []string `mapstructure:"states"`
+	// Action is "delete" (default) or "archive", which moves the tasks into tasks_archive
+	Action string `mapstructure:"action"`
+	// BatchSize bounds the tasks removed by one statement; every IntervalMs the janitor removes batches until one comes back short
+	BatchSize  int `mapstructure:"batch_size"`
+	IntervalMs int `mapstructure:"interval_ms"`
+}
+
+type Outbox struct {
+	PollIntervalMs int `mapstructure:"poll_interval_ms"`
+	BatchSize      int `mapstructure:"batch_size"`
+	// LeaseMs is how long a sender owns an entry before the relay delivers it again
+	LeaseMs int `mapstructure:"lease_ms"`
+	// SendTimeoutMs bounds a SendTask call, which includes the consumer's queueing and processing of the task
+	SendTimeoutMs int `mapstructure:"send_timeout_ms"`
+	// MaxAttempts failed deliveries mark the entry dead and fail its task
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Failed deliveries are retried after RetryBackoffMs, doubling up to MaxRetryBackoffMs
+	RetryBackoffMs    int `mapstructure:"retry_backoff_ms"`
+	MaxRetryBackoffMs int `mapstructure:"max_retry_backoff_ms"`
+}
+
+type Backlog struct {
+	// ReconcileIntervalMs is how often the in-memory backlog is reset to the database counts; 0 disables it
+	ReconcileIntervalMs int `mapstructure:"reconcile_interval_ms"`
+	// UseDBCount checks max_backlog against the database count instead of the in-memory one, at one query per tick
+	UseDBCount bool `mapstructure:"use_db_count"`
+}
+
+type Source struct {
+	// Kind selects where tasks come from: "random" (default), "file", "stdin", "http" or "unix"
+	Kind string `mapstructure:"kind"`
+	// Path is the JSONL file of the "file" source or the socket of the "unix" source
+	Path string `mapstructure:"path"`
+	// HTTPAddr is the listen address of the "http" source, which accepts POST /tasks
+	HTTPAddr string `mapstructure:"http_addr"`
+	// ReplaySpeed scales the timing of the "replay" source, which re-issues the recording at Path:
+	// 1 is the original speed, 2 twice as fast and 0 as fast as possible
+	ReplaySpeed float64 `mapstructure:"replay_speed"`
+	// RecordPath, when set, records every task the source produces for a later replay
+	RecordPath string `mapstructure:"record_path"`
+}
+
+type Load struct {
+	// Phases shape the rate of the random source, run in order; empty keeps one task per ticker_time
+	Phases []LoadPhase `mapstructure:"phases"`
+	// Repeat restarts the phases once they finish; otherwise the random source is exhausted
+	Repeat bool `mapstructure:"repeat"`
+}
+
+// LoadPhase is one stretch of a load profile, with rates in tasks per second
+type LoadPhase struct {
+	// Shape is "constant", "ramp", "step", "sine", "burst" or "poisson"
+	Shape      string `mapstructure:"shape"`
+	DurationMs int    `mapstructure:"duration_ms"`
+	// Rate of constant and poisson phases, the mean of sine phases and the rate during bursts
+	Rate float64 `mapstructure:"rate"`
+	// From and To bound ramp and step phases, which climb from one to the other in Steps increments
+	From  float64 `mapstructure:"from"`
+	To    float64 `mapstructure:"to"`
+	Steps int     `mapstructure:"steps"`
+	// Amplitude and PeriodMs shape sine phases around Rate
+	Amplitude float64 `mapstructure:"amplitude"`
+	PeriodMs  int     `mapstructure:"period_ms"`
+	// Burst phases produce at Rate for BurstMs, then nothing for IdleMs
+	BurstMs int `mapstructure:"burst_ms"`
+	IdleMs  int `mapstructure:"idle_ms"`
+}
+
+type Distributions struct {
+	// Type and Value shape the fields of generated tasks, each within the bounds of the tasks table
+	Type  Distribution `mapstructure:"type"`
+	Value Distribution `mapstructure:"value"`
+}
+
+// Distribution is how the random source draws one task field
+type Distribution struct {
+	// Kind is "uniform" (default), "weighted", "zipf", "normal" or "fixed"
+	Kind string `mapstructure:"kind"`
+	// Weights of a weighted distribution, one per value from the field's minimum up; missing values are never drawn
+	Weights []float64 `mapstructure:"weights"`
+	// S > 1 and V >= 1 parameterize a zipf distribution, whose most frequent value is the field's minimum
+	S float64 `mapstructure:"s"`
+	V float64 `mapstructure:"v"`
+	// Mean and StdDev of a normal distribution, whose draws are clamped to the field's bounds
+	Mean   float64 `mapstructure:"mean"`
+	StdDev float64 `mapstructure:"std_dev"`
+	// Value of a fixed distribution
+	Value int `mapstructure:"value"`
+}
+
+type Namespace struct {
+	Name string `mapstructure:"name"`
+	// MaxBacklog caps the unprocessed tasks of the namespace; 0 uses the top-level max_backlog
+	MaxBacklog int `mapstructure:"max_backlog"`
+}
+
+type CircuitBreaker struct {
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	CooldownMs       int `mapstructure:"cooldown_ms"`
+}
+
+// defaultNamespace is the only namespace produced to when none are configured
+const defaultNamespace = "default"
+
+// backlogWaitInterval is how often a task held back by a full namespace checks the backlog again
+const backlogWaitInterval = 100 * time.Millisecond
+
+var currentBacklog = newBacklog()
+
+// txBeginner starts the transactions that span several queries; satisfied by *sql.DB and *breaker.DB
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
 
 func init() {
 	// Register the Prometheus metrics
 	prometheus.MustRegister(tasksProduced)
 	prometheus.MustRegister(taskProductionFailures)
 	prometheus.MustRegister(backlogSize)
+	prometheus.MustRegister(taskSendDuration)
+	prometheus.MustRegister(dbCircuitBreakerState)
+	prometheus.MustRegister(producerTargetRate)
+	prometheus.MustRegister(adaptiveRate)
+	prometheus.MustRegister(observedRate)
+	prometheus.MustRegister(taskBatchSize)
+	prometheus.MustRegister(taskBatchFlushDuration)
+	prometheus.MustRegister(tasksPurged)
 }
 
 var version string
@@ -148,14 +393,33 @@ func main() {
 		}
 	}()
 
+	// Exercise the sources and rate control without Postgres, and optionally without a consumer
+	if config.DryRun.Enabled {
+		runDryRun(config)
+		return
+	}
+
+	// Keep the tasks in a SQLite file instead of Postgres, for single-node deployments
+	switch config.Database.Driver {
+	case "", persistence.DriverPostgres:
+	case persistence.DriverSQLite:
+		runSQLite(config)
+		return
+	default:
+		logger.LogError("Failed to connect to the database", fmt.Errorf("unknown database driver %q", config.Database.Driver), &logger.LogContext{})
+		return
+	}
+
 	// Initialize DB connection using the config values
-	dbSource := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+	// The application_name identifies this instance as the actor of the task transitions it makes
+	dbSource := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s&application_name=%s",
 		config.Database.User,
 		config.Database.Password,
 		config.Database.Host,
 		config.Database.Port,
 		config.Database.DbName,
 		config.Database.SslMode,
+		url.QueryEscape(util.InstanceName("producer")),
 	)
 
 	db, err := sql.Open("postgres", dbSource)
@@ -169,102 +433,393 @@ func main() {
 	}
 	defer db.Close()
 
-	queries := persistence.New(db)
+	// Guard every DB call with a circuit breaker so an unavailable database pauses production
+	dbBreaker := breaker.New(breaker.Options{
+		FailureThreshold: config.CircuitBreaker.FailureThreshold,
+		Cooldown:         time.Duration(config.CircuitBreaker.CooldownMs) * time.Millisecond,
+		OnStateChange: func(from breaker.State, to breaker.State) {
+			dbCircuitBreakerState.Set(float64(to))
+			logger.LogWarn("Database circuit breaker state changed", &logger.LogContext{
+				"from": from.String(),
+				"to":   to.String(),
+			})
+		},
+	})
+
+	guardedDB := breaker.NewDB(db, dbBreaker)
+	queries := persistence.New(guardedDB)
+	store := persistence.NewPostgresStore(guardedDB)
+
+	// Deliver tasks over gRPC through the outbox by default, or let the consumers claim them from the database
+	var taskDispatcher dispatcher
+	var controller *rateController
+	switch config.Dispatch.Transport {
+	case "", transportGRPC:
+		// Establish gRPC connection with the consumer
+		conn, err := grpc.Dial(config.Producer.GrpcConsumerUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			logger.LogError("Failed to connect to Consumer", err, &logger.LogContext{
+				"grpc_url": config.Producer.GrpcConsumerUrl,
+			})
+			return
+		}
+		defer conn.Close()
+
+		client := pb.NewTaskServiceClient(conn)
+
+		// Retry the deliveries that failed or were interrupted by a restart
+		taskRelay := newRelay(guardedDB, queries, client, config.Outbox)
+		go taskRelay.run(config.Outbox)
+
+		// Adapt the production rate to the load the consumer reports with each response
+		if config.AdaptiveRate.Enabled {
+			controller = newRateController(config.AdaptiveRate)
+			taskRelay.controller = controller
+			go controller.runObservedRate()
+		}
+		taskDispatcher = taskRelay
+	case transportNotify:
+		// Consumers never answer, so the backlog only shrinks when it is reconciled with the database
+		if config.Backlog.ReconcileIntervalMs <= 0 {
+			config.Backlog.ReconcileIntervalMs = notifyReconcileIntervalMs
+		}
+		taskDispatcher = notifier{}
+	default:
+		logger.LogError("Failed to select dispatch transport", fmt.Errorf("unknown transport %q", config.Dispatch.Transport), &logger.LogContext{})
+		return
+	}
+
+	// Start from the tasks dispatched before a restart rather than from an empty backlog
+	if err := syncBacklog(context.Background(), queries, currentBacklog); err != nil {
+		logger.LogError("Failed to seed backlog from database, starting empty", err, &logger.LogContext{})
+	}
+	if config.Backlog.ReconcileIntervalMs > 0 {
+		go runBacklogReconciler(queries, currentBacklog, config.Backlog)
+	}
+
+	// Store immediate tasks in batches rather than with an INSERT each
+	var writer *batchWriter
+	if config.Batch.Size > 1 {
+		writer = newBatchWriter(guardedDB, queries, taskDispatcher, config.Batch)
+		go writer.run()
+	}
+
+	// Dispatch scheduled tasks as they become due
+	go runScheduler(guardedDB, queries, taskDispatcher, config.Scheduler)
+
+	// Materialise tasks from the recurring task definitions at each fire time
+	if config.Recurring.Enabled {
+		go runRecurringScheduler(guardedDB, queries, config.Recurring)
+	}
+
+	// Keep the tasks table from growing without bound
+	if config.Retention.Enabled {
+		taskJanitor, err := newJanitor(queries, config.Retention)
+		if err != nil {
+			logger.LogError("Failed to start retention janitor", err, &logger.LogContext{})
+			return
+		}
+		go taskJanitor.run(config.Retention)
+	}
+
+	// Produce tasks from the configured source: generated at random by default, or a real workload
+	// read from a file, stdin, HTTP or a Unix socket
+	namespaces := producerNamespaces(config)
+	hasRoom := func(namespace string) bool {
+		return namespaceBacklog(queries, currentBacklog, config.Backlog, namespace) < backlogCap(config, namespaces, namespace)
+	}
+	source, err := newProductionSource(config, namespaces, hasRoom, controller)
+	if err != nil {
+		logger.LogError("Failed to create task source", err, &logger.LogContext{
+			"source": config.Source.Kind,
+		})
+		return
+	}
+
+	runSource(source, config.Source.Kind, hasRoom, func(task sourceTask) {
+		// While the database is unavailable every createTask would fail, so hold the task until a probe is due
+		for dbBreaker.State() == breaker.Open {
+			retryAfter := dbBreaker.RetryAfter()
+			logger.LogWarn("Database unavailable, pausing task production", &logger.LogContext{
+				"retry_after": retryAfter,
+			})
+			time.Sleep(retryAfter)
+		}
+
+		// Deferred tasks are few and go to the scheduler, so they are stored on their own
+		if writer != nil && task.RunAt.IsZero() {
+			writer.add(task)
+			return
+		}
+		produceTask(guardedDB, store, queries, taskDispatcher, task)
+	})
+
+	// Keep dispatching scheduled, recurring and workflow tasks after the source is done
+	select {}
+}
+
+// runDryRun produces from the configured source without a database, delivering to the dry-run sink
+func runDryRun(config Config) {
+	run, closeSink, err := newDryRun(config)
+	if err != nil {
+		logger.LogError("Failed to create dry run sink", err, &logger.LogContext{
+			"sink": config.DryRun.Sink,
+		})
+		return
+	}
+	defer closeSink()
+
+	logger.LogWarn("Dry run, tasks are not stored", &logger.LogContext{
+		"sink": config.DryRun.Sink,
+	})
+
+	runDirect(config, run)
+}
+
+// runSQLite produces from the configured source into a SQLite database, sending every task straight to
+// the consumer. Delayed tasks wait on a timer in the producer. Recurring tasks, batching, retention and
+// the notify transport are Postgres features, which the sqlite driver refuses to start with.
+func runSQLite(config Config) {
+	if features := postgresOnlyFeatures(config); len(features) > 0 {
+		logger.LogError("Failed to configure the sqlite driver", fmt.Errorf("%s need the %s driver", strings.Join(features, ", "), persistence.DriverPostgres), &logger.LogContext{})
+		return
+	}
 
-	// Establish gRPC connection with the consumer
-	conn, err := grpc.Dial(config.Producer.GrpcConsumerUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	db, err := persistence.OpenSQLite(config.Database.Path)
+	if err != nil {
+		logger.LogError("Failed to connect to the database", err, &logger.LogContext{
+			"driver": config.Database.Driver,
+			"path":   config.Database.Path,
+		})
+		return
+	}
+	defer db.Close()
+
+	run, closeConn, err := newSQLiteProducer(config, persistence.NewSQLiteStore(db))
 	if err != nil {
 		logger.LogError("Failed to connect to Consumer", err, &logger.LogContext{
 			"grpc_url": config.Producer.GrpcConsumerUrl,
 		})
 		return
 	}
-	defer conn.Close()
+	defer closeConn()
 
-	client := pb.NewTaskServiceClient(conn)
+	logger.LogInfo("Using SQLite database", &logger.LogContext{
+		"path": config.Database.Path,
+	})
 
-	// Simulate task production with controlled rate and backlog handling
-	// produce one task every 500 microseconds
-	ticker := time.NewTicker(time.Duration(config.RateLimiter.TickerTime) * time.Microsecond)
-	defer ticker.Stop()
+	runDirect(config, run)
+}
 
-	maxBacklog := config.MaxBackLog
-	for range ticker.C {
-		if currentBacklog >= maxBacklog {
-			logger.LogWarn("Max backlog reached, pausing task production", &logger.LogContext{
-				"backlog_size": currentBacklog,
-			})
-			continue
-		}
+// postgresOnlyFeatures lists the enabled features that the sqlite driver does not have
+func postgresOnlyFeatures(config Config) []string {
+	var features []string
+	if config.Recurring.Enabled {
+		features = append(features, "recurring")
+	}
+	if config.Batch.Size > 1 {
+		features = append(features, "batch")
+	}
+	if config.Retention.Enabled {
+		features = append(features, "retention")
+	}
+	if config.Dispatch.Transport == transportNotify {
+		features = append(features, "the notify transport")
+	}
+	return features
+}
+
+// runDirect produces from the configured source through a producer without the outbox
+func runDirect(config Config, run *directProducer) {
+	var controller *rateController
+	if config.AdaptiveRate.Enabled {
+		controller = newRateController(config.AdaptiveRate)
+		run.controller = controller
+		go controller.runObservedRate()
+	}
+
+	namespaces := producerNamespaces(config)
+	hasRoom := func(namespace string) bool {
+		return currentBacklog.size(namespace) < backlogCap(config, namespaces, namespace)
+	}
+	source, err := newProductionSource(config, namespaces, hasRoom, controller)
+	if err != nil {
+		logger.LogError("Failed to create task source", err, &logger.LogContext{
+			"source": config.Source.Kind,
+		})
+		return
+	}
 
-		taskType := rand.Intn(10)
-		taskValue := rand.Intn(100)
+	runSource(source, config.Source.Kind, hasRoom, run.produce)
 
-		taskID, err := createTask(queries, taskType, taskValue)
+	// Keep serving metrics after the source is done
+	select {}
+}
+
+// newProductionSource creates the configured task source, recording it when record_path is set
+func newProductionSource(config Config, namespaces []Namespace, hasRoom func(namespace string) bool, controller *rateController) (TaskSource, error) {
+	source, err := newTaskSource(config, namespaces, hasRoom, controller)
+	if err != nil || config.Source.RecordPath == "" {
+		return source, err
+	}
+	return newRecordingSource(source, config.Source.RecordPath)
+}
+
+// runSource hands every task of the source to produce until the source is exhausted or fails
+func runSource(source TaskSource, kind string, hasRoom func(namespace string) bool, produce func(task sourceTask)) {
+	ctx := context.Background()
+	for {
+		task, err := source.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			logger.LogInfo("Task source exhausted", &logger.LogContext{
+				"source": kind,
+			})
+			return
+		}
 		if err != nil {
-			taskProductionFailures.Inc()
-			logger.LogError("Failed to create task", err, &logger.LogContext{
-				"task_type":  taskType,
-				"task_value": taskValue,
+			logger.LogError("Failed to read from task source", err, &logger.LogContext{
+				"source": kind,
 			})
-			continue
+			return
 		}
 
-		tasksProduced.Inc()
-		currentBacklog++
-		backlogSize.Set(float64(currentBacklog))
-		logger.LogInfo(fmt.Sprintf("Current backlog size: %d", currentBacklog), &logger.LogContext{
-			"backlog_size": currentBacklog,
+		// Sources other than the random generator cannot skip a full namespace, so wait for it to drain
+		for !hasRoom(task.Namespace) {
+			logger.LogWarn("Max backlog reached, pausing task production", &logger.LogContext{
+				"namespace": task.Namespace,
+			})
+			time.Sleep(backlogWaitInterval)
+		}
+
+		produce(task)
+	}
+}
+
+// produceTask stores a task from the source and dispatches it to the consumers unless it is deferred
+func produceTask(db txBeginner, store persistence.TaskStore, queries *persistence.Queries, d dispatcher, task sourceTask) {
+	entry, err := createTask(db, store, queries, d, task)
+	if err != nil {
+		taskProductionFailures.Inc()
+		logger.LogError("Failed to create task", err, &logger.LogContext{
+			"namespace":  task.Namespace,
+			"task_type":  task.Type,
+			"task_value": task.Value,
 		})
+		return
+	}
+
+	tasksProduced.Inc()
 
-		sendTask(client, taskID, taskType, taskValue)
+	// Deferred tasks join the backlog when the scheduler dispatches them
+	if !task.RunAt.IsZero() {
+		return
 	}
+
+	size := currentBacklog.add(task.Namespace, 1)
+	logger.LogInfo(fmt.Sprintf("Current backlog size: %d", size), &logger.LogContext{
+		"namespace":    task.Namespace,
+		"backlog_size": size,
+	})
+
+	d.send(entry)
 }
 
-func createTask(queries *persistence.Queries, taskType int, taskValue int) (int32, error) {
+// backlogCap returns the backlog cap of a namespace; namespaces that are not configured,
+// e.g. ones named by an ingested task, are capped at the top-level max_backlog
+func backlogCap(config Config, namespaces []Namespace, namespace string) int {
+	for _, ns := range namespaces {
+		if ns.Name == namespace {
+			return ns.MaxBacklog
+		}
+	}
+	return config.MaxBackLog
+}
+
+// producerNamespaces returns the configured namespaces with their backlog caps resolved,
+// or just the default namespace capped at max_backlog when none are configured
+func producerNamespaces(config Config) []Namespace {
+	if len(config.Namespaces) == 0 {
+		return []Namespace{{Name: defaultNamespace, MaxBacklog: config.MaxBackLog}}
+	}
+
+	namespaces := make([]Namespace, 0, len(config.Namespaces))
+	for _, namespace := range config.Namespaces {
+		if namespace.MaxBacklog <= 0 {
+			namespace.MaxBacklog = config.MaxBackLog
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+// createTask stores a new task. A non-zero RunAt stores it as "scheduled" for the scheduler to
+// dispatch once due; otherwise it is stored and dispatched in one transaction, returning what to send once committed.
+// The dispatcher's rows are written with queries, in the transaction the store joins.
+func createTask(db txBeginner, store persistence.TaskStore, queries *persistence.Queries, d dispatcher, task sourceTask) (persistence.ClaimOutboxEntriesRow, error) {
 	ctx := context.Background()
 
-	params := persistence.CreateTaskParams{
-		Type:  sql.NullInt32{Int32: int32(taskType), Valid: true},
-		Value: sql.NullInt32{Int32: int32(taskValue), Valid: true},
+	comment := sql.NullString{String: task.Comment, Valid: task.Comment != ""}
+	stored := persistence.Task{
+		Type:      sql.NullInt32{Int32: int32(task.Type), Valid: true},
+		Value:     sql.NullInt32{Int32: int32(task.Value), Valid: true},
+		Namespace: task.Namespace,
 	}
 
-	// Create task and return the generated ID
-	taskID, err := queries.CreateTask(ctx, params)
-	if err != nil {
-		return 0, err
+	var entry persistence.ClaimOutboxEntriesRow
+	if task.RunAt.IsZero() {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return entry, err
+		}
+		defer func(tx *sql.Tx) {
+			_ = tx.Rollback()
+		}(tx)
+
+		// Create task and return the generated ID
+		stored.ID, err = store.WithTx(tx).CreateTask(ctx, persistence.CreateTaskParams{
+			Type:      stored.Type,
+			Value:     stored.Value,
+			Comment:   comment,
+			Namespace: task.Namespace,
+		})
+		if err != nil {
+			return entry, err
+		}
+		if entry, err = d.enqueue(ctx, queries.WithTx(tx), stored); err != nil {
+			return entry, err
+		}
+		if err := tx.Commit(); err != nil {
+			return entry, err
+		}
+	} else {
+		var err error
+		stored.ID, err = store.ScheduleTask(ctx, persistence.ScheduleTaskParams{
+			Type:      stored.Type,
+			Value:     stored.Value,
+			Comment:   comment,
+			RunAt:     task.RunAt,
+			Namespace: task.Namespace,
+		})
+		if err != nil {
+			return entry, err
+		}
 	}
 
 	logger.LogInfo("Task created", &logger.LogContext{
-		"task_id":    taskID,
-		"task_type":  taskType,
-		"task_value": taskValue,
+		"task_id":    stored.ID,
+		"namespace":  task.Namespace,
+		"task_type":  task.Type,
+		"task_value": task.Value,
+		"run_at":     task.RunAt,
 	})
 
-	return taskID, nil
+	return entry, nil
 }
 
-func sendTask(client pb.TaskServiceClient, taskID int32, taskType int, taskValue int) {
-	go func() {
-		_, err := client.SendTask(context.Background(), &pb.TaskRequest{
-			Id:    taskID,
-			Type:  int32(taskType),
-			Value: int32(taskValue),
-		})
-		if err != nil {
-			logger.LogError("Failed to send task", err, &logger.LogContext{
-				"task_id":    taskID,
-				"task_type":  taskType,
-				"task_value": taskValue,
-			})
-		} else {
-			// Only decrement backlog when the consumer successfully processes the task
-			currentBacklog--
-			backlogSize.Set(float64(currentBacklog))
-			logger.LogInfo("Task processed, backlog decremented", &logger.LogContext{
-				"task_id": taskID,
-				"backlog": currentBacklog,
-			})
-		}
-	}()
+// outcomeLabel renders the result of a SendTask call as a Prometheus label value
+func outcomeLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
 }
@@ -2,12 +2,32 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
+	"io"
+	"math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 const bufSize = 1024 * 1024
@@ -27,7 +47,7 @@ func TestTaskGeneration(t *testing.T) {
 
 	go func() {
 		if err := s.Serve(lis); err != nil {
-			t.Fatalf("Server failed to start: %v", err)
+			t.Errorf("Server failed to start: %v", err)
 		}
 	}()
 
@@ -57,3 +77,1020 @@ type mockTaskServer struct {
 func (s *mockTaskServer) SendTask(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse, error) {
 	return &pb.TaskResponse{Status: "Processed"}, nil
 }
+
+// TestRandomRunAt validates that only the configured share of tasks is deferred, within the maximum delay
+func TestRandomRunAt(t *testing.T) {
+	assert.True(t, randomRunAt(Scheduler{}, rand.New(rand.NewSource(1))).IsZero())
+	assert.True(t, randomRunAt(Scheduler{DelayedRatio: 0, MaxDelayMs: 1000}, rand.New(rand.NewSource(1))).IsZero())
+
+	before := time.Now()
+	runAt := randomRunAt(Scheduler{DelayedRatio: 1, MaxDelayMs: 1000}, rand.New(rand.NewSource(1)))
+	assert.True(t, runAt.After(before))
+	assert.True(t, runAt.Before(before.Add(1001*time.Millisecond)))
+}
+
+// TestDueFireTimes validates the catch-up and skip policies for missed recurring task fires
+func TestDueFireTimes(t *testing.T) {
+	schedule, err := cron.ParseStandard("*/10 * * * *")
+	assert.NoError(t, err)
+
+	next := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 9, 1, 12, 35, 0, 0, time.UTC)
+
+	// Catching up replays every missed fire, bounded by maxCatchUp
+	fires, skipped, following := dueFireTimes(schedule, next, now, true, time.Minute, 10)
+	assert.Len(t, fires, 4)
+	assert.False(t, skipped)
+	assert.Equal(t, time.Date(2024, 9, 1, 12, 40, 0, 0, time.UTC), following)
+
+	fires, skipped, _ = dueFireTimes(schedule, next, now, true, time.Minute, 2)
+	assert.Equal(t, []time.Time{next.Add(20 * time.Minute), next.Add(30 * time.Minute)}, fires)
+	assert.True(t, skipped)
+
+	// Skipping drops every missed fire when the latest is older than the threshold
+	fires, skipped, _ = dueFireTimes(schedule, next, now, false, time.Minute, 10)
+	assert.Empty(t, fires)
+	assert.True(t, skipped)
+
+	// ...but still fires on time when the latest is within it
+	fires, skipped, _ = dueFireTimes(schedule, next, next.Add(30*time.Second), false, time.Minute, 10)
+	assert.Equal(t, []time.Time{next}, fires)
+	assert.False(t, skipped)
+
+	// Nothing is due before next
+	fires, skipped, following = dueFireTimes(schedule, next, next.Add(-time.Minute), true, time.Minute, 10)
+	assert.Empty(t, fires)
+	assert.False(t, skipped)
+	assert.Equal(t, next, following)
+}
+
+// TestDueFireTimesAfterLongOutage validates that only the fires returned are stepped through after a long outage
+func TestDueFireTimesAfterLongOutage(t *testing.T) {
+	schedule := &countingSchedule{schedule: cron.Every(time.Second)}
+	next := time.Date(2014, 9, 1, 12, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	fires, skipped, following := dueFireTimes(schedule, next, now, true, time.Minute, 3)
+	assert.Equal(t, []time.Time{now.Add(-2 * time.Second), now.Add(-time.Second), now}, fires)
+	assert.True(t, skipped)
+	assert.Equal(t, now.Add(time.Second), following)
+	assert.Less(t, schedule.calls, 100)
+
+	schedule.calls = 0
+	fires, _, _ = dueFireTimes(schedule, next, now.Add(500*time.Millisecond), false, time.Minute, 3)
+	assert.Equal(t, []time.Time{now}, fires)
+	assert.Less(t, schedule.calls, 100)
+}
+
+// countingSchedule counts the fire times asked of a schedule
+type countingSchedule struct {
+	schedule cron.Schedule
+	calls    int
+}
+
+func (s *countingSchedule) Next(t time.Time) time.Time {
+	s.calls++
+	return s.schedule.Next(t)
+}
+
+// TestProducerNamespaces validates that namespaces default to max_backlog and to the default namespace
+func TestProducerNamespaces(t *testing.T) {
+	namespaces := producerNamespaces(Config{MaxBackLog: 100})
+	assert.Equal(t, []Namespace{{Name: "default", MaxBacklog: 100}}, namespaces)
+
+	namespaces = producerNamespaces(Config{
+		MaxBackLog: 100,
+		Namespaces: []Namespace{{Name: "team-a", MaxBacklog: 10}, {Name: "team-b"}},
+	})
+	assert.Equal(t, []Namespace{{Name: "team-a", MaxBacklog: 10}, {Name: "team-b", MaxBacklog: 100}}, namespaces)
+}
+
+// TestBacklogPerNamespace validates that each namespace's backlog is counted separately
+func TestBacklogPerNamespace(t *testing.T) {
+	b := newBacklog()
+
+	assert.Equal(t, 1, b.add("team-a", 1))
+	assert.Equal(t, 2, b.add("team-a", 1))
+	assert.Equal(t, 1, b.add("team-b", 1))
+	assert.Equal(t, 1, b.add("team-a", -1))
+
+	assert.Equal(t, 1, b.size("team-a"))
+	assert.Equal(t, 1, b.size("team-b"))
+	assert.Equal(t, 0, b.size("team-c"))
+}
+
+// TestBacklogConcurrentUpdates validates that concurrent sends and completions leave the backlog consistent
+func TestBacklogConcurrentUpdates(t *testing.T) {
+	b := newBacklog()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.add("default", 1)
+			b.add("default", -1)
+			b.add("default", 1)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 100, b.size("default"))
+}
+
+// TestSyncBacklog validates that the backlog is seeded from the database and stale namespaces are zeroed
+func TestSyncBacklog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	b := newBacklog()
+	b.add("team-a", 3)
+	b.add("team-b", 2)
+
+	mock.ExpectQuery("SELECT namespace, COUNT(.+) FROM tasks").
+		WillReturnRows(sqlmock.NewRows([]string{"namespace", "count"}).AddRow("team-a", 7).AddRow("default", 1))
+
+	err = syncBacklog(context.Background(), persistence.New(db), b)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, b.size("team-a"))
+	assert.Equal(t, 0, b.size("team-b"))
+	assert.Equal(t, 1, b.size("default"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestNamespaceBacklog validates that the database count is used only when configured, with the in-memory count as fallback
+func TestNamespaceBacklog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+	b := newBacklog()
+	b.add("team-a", 2)
+
+	assert.Equal(t, 2, namespaceBacklog(queries, b, Backlog{}, "team-a"))
+
+	mock.ExpectQuery("SELECT COUNT(.+) FROM tasks WHERE namespace").
+		WithArgs("team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(9))
+	mock.ExpectQuery("SELECT COUNT(.+) FROM tasks WHERE namespace").
+		WithArgs("team-a").
+		WillReturnError(errors.New("connection reset"))
+
+	assert.Equal(t, 9, namespaceBacklog(queries, b, Backlog{UseDBCount: true}, "team-a"))
+	assert.Equal(t, 2, namespaceBacklog(queries, b, Backlog{UseDBCount: true}, "team-a"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDecodeTask validates that JSON tasks are checked against the tasks table bounds and default to the default namespace
+func TestDecodeTask(t *testing.T) {
+	task, err := decodeTask([]byte(`{"type": 3, "value": 42, "comment": "nightly", "run_at": "2030-01-01T00:00:00Z"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, sourceTask{
+		Namespace: "default",
+		Type:      3,
+		Value:     42,
+		Comment:   "nightly",
+		RunAt:     time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, task)
+
+	for _, line := range []string{
+		`{"value": 1}`,
+		`{"type": 10, "value": 1}`,
+		`{"type": 1, "value": 100}`,
+		`{"type": 1, "value": 1, "namespace": "Team A"}`,
+		`not json`,
+	} {
+		_, err := decodeTask([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
+
+// TestJSONLSource validates that a JSONL source skips blank and invalid lines and ends with io.EOF
+func TestJSONLSource(t *testing.T) {
+	source := newJSONLSource(strings.NewReader("{\"type\": 1, \"value\": 2}\n\n{\"type\": 99}\n{\"type\": 4, \"value\": 5, \"namespace\": \"team-a\"}\n"), "test")
+
+	task, err := source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, sourceTask{Namespace: "default", Type: 1, Value: 2}, task)
+
+	task, err = source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, sourceTask{Namespace: "team-a", Type: 4, Value: 5}, task)
+
+	_, err = source.Next(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// TestRandomSourceSkipsFullNamespaces validates that generated tasks only go to namespaces with backlog room
+func TestRandomSourceSkipsFullNamespaces(t *testing.T) {
+	namespaces := []Namespace{{Name: "full"}, {Name: "open"}}
+	profile, err := newLoadProfile(Load{}, RateLimiter{TickerTime: 1})
+	assert.NoError(t, err)
+	source := newRandomSource(profile, namespaces, func(namespace string) bool {
+		return namespace == "open"
+	}, Scheduler{}, rand.New(rand.NewSource(1)))
+
+	for i := 0; i < 20; i++ {
+		task, err := source.Next(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "open", task.Namespace)
+		assert.True(t, task.Type >= minTaskType && task.Type <= maxTaskType)
+		assert.True(t, task.Value >= minTaskValue && task.Value <= maxTaskValue)
+	}
+}
+
+// TestHTTPSource validates that POSTed JSONL tasks are handed to the producer and invalid lines are rejected
+func TestHTTPSource(t *testing.T) {
+	source := newIngestSource()
+	server := httptest.NewServer(http.HandlerFunc(source.handleTasks))
+	defer server.Close()
+
+	received := make(chan sourceTask, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			task, err := source.Next(context.Background())
+			assert.NoError(t, err)
+			received <- task
+		}
+	}()
+
+	res, err := http.Post(server.URL, "application/x-ndjson", strings.NewReader("{\"type\": 1, \"value\": 2}\n{\"type\": 3, \"value\": 4}\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Equal(t, 1, (<-received).Type)
+	assert.Equal(t, 3, (<-received).Type)
+
+	res, err = http.Post(server.URL, "application/x-ndjson", strings.NewReader(`{"type": 11, "value": 4}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var body ingestResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, 0, body.Accepted)
+	assert.Contains(t, body.Error, "line 1")
+
+	res, err = http.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+// TestUnixSource validates that tasks streamed over the Unix socket are acknowledged once queued
+func TestUnixSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "producer.sock")
+	source, err := newUnixSource(path)
+	assert.NoError(t, err)
+
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	defer func(conn net.Conn) {
+		err := conn.Close()
+		if err != nil {
+
+		}
+	}(conn)
+
+	_, err = conn.Write([]byte("{\"type\": 5, \"value\": 6, \"namespace\": \"team-b\"}\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, conn.(*net.UnixConn).CloseWrite())
+
+	task, err := source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, sourceTask{Namespace: "team-b", Type: 5, Value: 6}, task)
+
+	var res ingestResponse
+	assert.NoError(t, json.NewDecoder(conn).Decode(&res))
+	assert.Equal(t, ingestResponse{Accepted: 1}, res)
+}
+
+// failingListener fails its first accepts with EMFILE, as a process out of file descriptors does
+type failingListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, &net.OpError{Op: "accept", Net: "unix", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+// TestIngestServeRetriesAccept validates that failed accepts are retried and that closing the listener stops serving
+func TestIngestServeRetriesAccept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "producer.sock")
+	listener, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+
+	source := newIngestSource()
+	stopped := make(chan struct{})
+	go func() {
+		source.serve(&failingListener{Listener: listener, failures: 3})
+		close(stopped)
+	}()
+
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("{\"type\": 1, \"value\": 2}\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, conn.(*net.UnixConn).CloseWrite())
+
+	task, err := source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, sourceTask{Namespace: "default", Type: 1, Value: 2}, task)
+	_ = conn.Close()
+
+	assert.NoError(t, listener.Close())
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("serve did not return once the listener was closed")
+	}
+}
+
+// TestBacklogCap validates that unconfigured namespaces fall back to the top-level max_backlog
+func TestBacklogCap(t *testing.T) {
+	config := Config{MaxBackLog: 50}
+	namespaces := []Namespace{{Name: "team-a", MaxBacklog: 5}}
+
+	assert.Equal(t, 5, backlogCap(config, namespaces, "team-a"))
+	assert.Equal(t, 50, backlogCap(config, namespaces, "team-z"))
+}
+
+// TestLoadPhaseRates validates the target rate of each load shape over its phase
+func TestLoadPhaseRates(t *testing.T) {
+	ramp := LoadPhase{Shape: "ramp", DurationMs: 1000, From: 100, To: 200}
+	assert.Equal(t, 100.0, ramp.rate(0))
+	assert.Equal(t, 150.0, ramp.rate(500*time.Millisecond))
+
+	step := LoadPhase{Shape: "step", DurationMs: 900, From: 0, To: 30, Steps: 2}
+	assert.Equal(t, 0.0, step.rate(100*time.Millisecond))
+	assert.Equal(t, 15.0, step.rate(400*time.Millisecond))
+	assert.Equal(t, 30.0, step.rate(899*time.Millisecond))
+
+	sine := LoadPhase{Shape: "sine", DurationMs: 4000, Rate: 10, Amplitude: 20, PeriodMs: 4000}
+	assert.InDelta(t, 10.0, sine.rate(0), 1e-9)
+	assert.InDelta(t, 30.0, sine.rate(time.Second), 1e-9)
+	assert.Equal(t, 0.0, sine.rate(3*time.Second))
+
+	burst := LoadPhase{Shape: "burst", DurationMs: 10000, Rate: 500, BurstMs: 100, IdleMs: 900}
+	assert.Equal(t, 500.0, burst.rate(1050*time.Millisecond))
+	assert.Equal(t, 0.0, burst.rate(1500*time.Millisecond))
+
+	constant := LoadPhase{Shape: "constant", DurationMs: 1000, Rate: 4}
+	assert.Equal(t, 4.0, constant.rate(999*time.Millisecond))
+	assert.Equal(t, 250*time.Millisecond, constant.interval(4, nil))
+
+	// Poisson arrivals vary around the mean interval
+	poisson := LoadPhase{Shape: "poisson", DurationMs: 1000, Rate: 1000}
+	rng := rand.New(rand.NewSource(1))
+	var total time.Duration
+	for i := 0; i < 10000; i++ {
+		total += poisson.interval(1000, rng)
+	}
+	assert.InDelta(t, float64(time.Millisecond), float64(total/10000), float64(100*time.Microsecond))
+}
+
+// TestLoadProfile validates phase lookup, repetition and the ticker_time fallback
+func TestLoadProfile(t *testing.T) {
+	profile, err := newLoadProfile(Load{Phases: []LoadPhase{
+		{Shape: "constant", DurationMs: 1000, Rate: 1},
+		{Shape: "constant", DurationMs: 2000, Rate: 2},
+	}}, RateLimiter{})
+	assert.NoError(t, err)
+
+	phase, offset, ok := profile.at(1500 * time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, phase.Rate)
+	assert.Equal(t, 500*time.Millisecond, offset)
+
+	_, _, ok = profile.at(3 * time.Second)
+	assert.False(t, ok)
+
+	profile.repeat = true
+	phase, offset, ok = profile.at(3500 * time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, phase.Rate)
+	assert.Equal(t, 500*time.Millisecond, offset)
+
+	profile, err = newLoadProfile(Load{}, RateLimiter{TickerTime: 500})
+	assert.NoError(t, err)
+	phase, _, ok = profile.at(48 * time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, 2000.0, phase.rate(0))
+
+	for _, phase := range []LoadPhase{
+		{Shape: "constant"},
+		{Shape: "zigzag", DurationMs: 1000},
+		{Shape: "step", DurationMs: 1000},
+		{Shape: "sine", DurationMs: 1000},
+		{Shape: "burst", DurationMs: 1000},
+		{Shape: "ramp", DurationMs: 1000, From: -1},
+	} {
+		_, err := newLoadProfile(Load{Phases: []LoadPhase{phase}}, RateLimiter{})
+		assert.Error(t, err, phase.Shape)
+	}
+}
+
+// TestRandomSourceFollowsProfile validates that the random source paces tasks at the profile rate and ends with it
+func TestRandomSourceFollowsProfile(t *testing.T) {
+	profile, err := newLoadProfile(Load{Phases: []LoadPhase{
+		{Shape: "constant", DurationMs: 200, Rate: 50},
+	}}, RateLimiter{})
+	assert.NoError(t, err)
+	source := newRandomSource(profile, []Namespace{{Name: "default"}}, func(string) bool { return true }, Scheduler{}, rand.New(rand.NewSource(1)))
+
+	produced := 0
+	for {
+		_, err := source.Next(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		produced++
+	}
+	// 50 tasks per second for 200ms
+	assert.InDelta(t, 10, produced, 2)
+}
+
+// TestRandomSourceFollowsPhaseChange validates that a long wait at a low rate ends once the profile moves to a higher rate
+func TestRandomSourceFollowsPhaseChange(t *testing.T) {
+	profile, err := newLoadProfile(Load{Phases: []LoadPhase{
+		{Shape: "constant", DurationMs: 100, Rate: 0.01},
+		{Shape: "constant", DurationMs: 200, Rate: 50},
+	}}, RateLimiter{})
+	assert.NoError(t, err)
+	source := newRandomSource(profile, []Namespace{{Name: "default"}}, func(string) bool { return true }, Scheduler{}, rand.New(rand.NewSource(1)))
+
+	start := time.Now()
+	produced := 0
+	for {
+		_, err := source.Next(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		produced++
+	}
+	// Nothing in the first 100ms, then 50 tasks per second for 200ms rather than a 100s sleep
+	assert.InDelta(t, 10, produced, 3)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// TestSamplers validates that every distribution stays within the field's bounds and has the expected skew
+func TestSamplers(t *testing.T) {
+	draw := func(config Distribution) map[int]int {
+		sample, err := newSampler(config, minTaskValue, maxTaskValue, rand.New(rand.NewSource(1)))
+		assert.NoError(t, err)
+
+		counts := make(map[int]int)
+		for i := 0; i < 10000; i++ {
+			value := sample()
+			assert.True(t, value >= minTaskValue && value <= maxTaskValue, "value %d out of bounds", value)
+			counts[value]++
+		}
+		return counts
+	}
+
+	assert.Len(t, draw(Distribution{}), maxTaskValue+1)
+
+	weighted := draw(Distribution{Kind: "weighted", Weights: []float64{1, 0, 3}})
+	assert.Len(t, weighted, 2)
+	assert.InDelta(t, 7500, weighted[2], 300)
+
+	zipf := draw(Distribution{Kind: "zipf", S: 2, V: 1})
+	for value, count := range zipf {
+		assert.LessOrEqual(t, count, zipf[minTaskValue], "value %d drawn more often than the minimum", value)
+	}
+
+	// Half the draws fall below the minimum and are clamped to it
+	normal := draw(Distribution{Kind: "normal", Mean: 0, StdDev: 10})
+	assert.InDelta(t, 5000, normal[minTaskValue], 300)
+
+	assert.Equal(t, map[int]int{42: 10000}, draw(Distribution{Kind: "fixed", Value: 42}))
+
+	for _, invalid := range []Distribution{
+		{Kind: "weighted"},
+		{Kind: "weighted", Weights: make([]float64, maxTaskValue+2)},
+		{Kind: "weighted", Weights: []float64{0, 0}},
+		{Kind: "weighted", Weights: []float64{1, -1}},
+		{Kind: "zipf", S: 1, V: 1},
+		{Kind: "normal", StdDev: -1},
+		{Kind: "fixed", Value: maxTaskValue + 1},
+		{Kind: "pareto"},
+	} {
+		_, err := newSampler(invalid, minTaskValue, maxTaskValue, rand.New(rand.NewSource(1)))
+		assert.Error(t, err, "%+v", invalid)
+	}
+}
+
+// TestCreateTaskWritesOutboxEntry validates that an immediate task and its outbox entry are written in one transaction
+func TestCreateTaskWritesOutboxEntry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+	r := newRelay(db, queries, nil, Outbox{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO tasks").
+		WithArgs(sql.NullInt32{Int32: 2, Valid: true}, sql.NullInt32{Int32: 40, Valid: true}, sql.NullString{String: "replayed", Valid: true}, "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery("INSERT INTO task_outbox").
+		WithArgs(int32(7), "team-a", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectCommit()
+
+	entry, err := createTask(db, persistence.NewPostgresStore(db), queries, r, sourceTask{Namespace: "team-a", Type: 2, Value: 40, Comment: "replayed"})
+	assert.NoError(t, err)
+	assert.Equal(t, persistence.ClaimOutboxEntriesRow{
+		ID:        11,
+		TaskID:    7,
+		Namespace: "team-a",
+		Type:      sql.NullInt32{Int32: 2, Valid: true},
+		Value:     sql.NullInt32{Int32: 40, Valid: true},
+	}, entry)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateTaskNotifies validates that on the notify transport a task is stored and announced in one transaction, without an outbox entry
+func TestCreateTaskNotifies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO tasks").
+		WithArgs(sql.NullInt32{Int32: 2, Valid: true}, sql.NullInt32{Int32: 40, Valid: true}, sql.NullString{}, "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec("SELECT pg_notify").
+		WithArgs("{7}").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	entry, err := createTask(db, persistence.NewPostgresStore(db), queries, notifier{}, sourceTask{Namespace: "team-a", Type: 2, Value: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), entry.TaskID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestBatchWriterInsert validates that a batch of tasks and their outbox entries are written with two INSERTs in one
+// transaction, and that the returned IDs are matched to their tasks whatever order they come back in
+func TestBatchWriterInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+	w := newBatchWriter(db, queries, newRelay(db, queries, nil, Outbox{}), Batch{Size: 2})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM unnest(.+)INSERT INTO tasks").
+		WithArgs("{2,5}", "{40,50}", `{"replayed",""}`, `{"team-a","team-b"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ord"}).AddRow(8, 2).AddRow(7, 1))
+	mock.ExpectQuery("INSERT INTO task_outbox(.+)FROM unnest").
+		WithArgs(sqlmock.AnyArg(), "{7,8}", `{"team-a","team-b"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "task_id"}).AddRow(12, 8).AddRow(11, 7))
+	mock.ExpectCommit()
+
+	entries, err := w.insert([]sourceTask{
+		{Namespace: "team-a", Type: 2, Value: 40, Comment: "replayed"},
+		{Namespace: "team-b", Type: 5, Value: 50},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []persistence.ClaimOutboxEntriesRow{
+		{ID: 11, TaskID: 7, Namespace: "team-a", Type: sql.NullInt32{Int32: 2, Valid: true}, Value: sql.NullInt32{Int32: 40, Valid: true}},
+		{ID: 12, TaskID: 8, Namespace: "team-b", Type: sql.NullInt32{Int32: 5, Valid: true}, Value: sql.NullInt32{Int32: 50, Valid: true}},
+	}, entries)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestBatchWriterFailedFlush validates that a batch that cannot be stored is counted as failed and leaves the backlog
+func TestBatchWriterFailedFlush(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+	w := newBatchWriter(db, queries, newRelay(db, queries, nil, Outbox{}), Batch{Size: 2})
+	failures := testutil.ToFloat64(taskProductionFailures)
+
+	batch := []sourceTask{{Namespace: "batch-test", Type: 1, Value: 1}, {Namespace: "batch-test", Type: 2, Value: 2}}
+	for _, task := range batch {
+		w.add(task)
+		<-w.tasks
+	}
+	assert.Equal(t, 2, currentBacklog.size("batch-test"))
+
+	mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+	w.flush(batch)
+
+	assert.Equal(t, failures+2, testutil.ToFloat64(taskProductionFailures))
+	assert.Equal(t, 0, currentBacklog.size("batch-test"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRelaySettle validates that deliveries are marked sent, retried with backoff or abandoned after the last attempt or for a missing task
+func TestRelaySettle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+	r := newRelay(db, queries, nil, Outbox{MaxAttempts: 3})
+	entry := persistence.ClaimOutboxEntriesRow{ID: 4, TaskID: 9, Namespace: "settle-test"}
+	currentBacklog.add("settle-test", 4)
+
+	// Delivered, then delivered again by an overlapping attempt
+	mock.ExpectExec("UPDATE task_outbox SET state = 'sent'").WithArgs(int32(4)).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, r.settle(entry, &pb.TaskResponse{Status: "Processed"}, nil))
+	mock.ExpectExec("UPDATE task_outbox SET state = 'sent'").WithArgs(int32(4)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, r.settle(entry, nil, status.Error(codes.FailedPrecondition, "already started")))
+	assert.Equal(t, 3, currentBacklog.size("settle-test"))
+
+	// A failed delivery is retried
+	mock.ExpectExec("UPDATE task_outbox SET attempts = attempts \\+ 1").
+		WithArgs(int32(4), sql.NullString{String: "rpc error: code = Unavailable desc = down", Valid: true}, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, r.settle(entry, nil, status.Error(codes.Unavailable, "down")))
+	assert.Equal(t, 3, currentBacklog.size("settle-test"))
+
+	// The last attempt gives up and fails the task
+	entry.Attempts = 2
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE task_outbox SET state = 'dead'").WithArgs(int32(4), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tasks SET state = 'failed'").WithArgs(int32(9), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("WITH RECURSIVE dependents").WithArgs(int32(9)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	assert.NoError(t, r.settle(entry, nil, status.Error(codes.Unavailable, "down")))
+	assert.Equal(t, 2, currentBacklog.size("settle-test"))
+
+	// A task the consumer already ran, whose responses were lost, is not failed and its dependents are not skipped
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE task_outbox SET state = 'dead'").WithArgs(int32(4), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tasks SET state = 'failed'(.+)AND state = 'received'").WithArgs(int32(9), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.NoError(t, r.settle(entry, nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")))
+	assert.Equal(t, 1, currentBacklog.size("settle-test"))
+
+	// A missing task is given up on right away
+	entry.Attempts = 0
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE task_outbox SET state = 'dead'").WithArgs(int32(4), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tasks SET state = 'failed'").WithArgs(int32(9), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.NoError(t, r.settle(entry, nil, status.Error(codes.NotFound, "task 9 not found")))
+	assert.Equal(t, 0, currentBacklog.size("settle-test"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRelayBackoff validates that the retry delay doubles per attempt up to the maximum
+func TestRelayBackoff(t *testing.T) {
+	r := newRelay(nil, nil, nil, Outbox{RetryBackoffMs: 100, MaxRetryBackoffMs: 1000})
+
+	assert.Equal(t, 100*time.Millisecond, r.backoff(0))
+	assert.Equal(t, 400*time.Millisecond, r.backoff(2))
+	assert.Equal(t, time.Second, r.backoff(4))
+	assert.Equal(t, time.Second, r.backoff(40))
+}
+
+// TestRateControllerAIMD validates additive increase on success, multiplicative decrease on overload and the suggested ceiling
+func TestRateControllerAIMD(t *testing.T) {
+	c := newRateController(AdaptiveRate{InitialRate: 100, MinRate: 10, MaxRate: 130, IncreaseRate: 20, DecreaseFactor: 0.5, AdjustIntervalMs: 1})
+
+	time.Sleep(2 * time.Millisecond)
+	c.observe("default", &pb.LoadHint{}, nil)
+	assert.Equal(t, 120.0, c.limit())
+
+	time.Sleep(2 * time.Millisecond)
+	c.observe("default", &pb.LoadHint{}, nil)
+	assert.Equal(t, 130.0, c.limit())
+
+	time.Sleep(2 * time.Millisecond)
+	c.observe("default", &pb.LoadHint{Overloaded: true}, nil)
+	assert.Equal(t, 65.0, c.limit())
+
+	// Only one decrease per interval for the same overload
+	c.observe("default", nil, status.Error(codes.ResourceExhausted, "concurrency limit of 1 reached"))
+	assert.Equal(t, 65.0, c.limit())
+
+	time.Sleep(2 * time.Millisecond)
+	c.observe("default", nil, status.Error(codes.Unavailable, "database unavailable"))
+	assert.Equal(t, 32.5, c.limit())
+
+	time.Sleep(2 * time.Millisecond)
+	c.observe("default", nil, status.Error(codes.Unavailable, "database unavailable"))
+	assert.Equal(t, 16.25, c.limit())
+	time.Sleep(2 * time.Millisecond)
+	c.observe("default", nil, status.Error(codes.Unavailable, "database unavailable"))
+	assert.Equal(t, 10.0, c.limit())
+
+	// The rate never exceeds what the consumer suggests across namespaces
+	c = newRateController(AdaptiveRate{InitialRate: 100, IncreaseRate: 25, AdjustIntervalMs: 1})
+	c.observe("team-a", &pb.LoadHint{SuggestedRate: 20}, nil)
+	assert.Equal(t, 20.0, c.limit())
+	time.Sleep(2 * time.Millisecond)
+	c.observe("team-b", &pb.LoadHint{SuggestedRate: 30}, nil)
+	assert.Equal(t, 45.0, c.limit())
+	time.Sleep(2 * time.Millisecond)
+	c.observe("team-b", &pb.LoadHint{SuggestedRate: 30}, nil)
+	assert.Equal(t, 50.0, c.limit())
+	assert.Greater(t, c.observedRate(), 0.0)
+	assert.Equal(t, 0.0, c.observedRate())
+}
+
+// TestRandomSourceCappedByController validates that the adaptive rate caps the load profile
+func TestRandomSourceCappedByController(t *testing.T) {
+	profile, err := newLoadProfile(Load{Phases: []LoadPhase{
+		{Shape: "constant", DurationMs: 200, Rate: 1000},
+	}}, RateLimiter{})
+	assert.NoError(t, err)
+	source := newRandomSource(profile, []Namespace{{Name: "default"}}, func(string) bool { return true }, Scheduler{}, rand.New(rand.NewSource(1)))
+	source.controller = newRateController(AdaptiveRate{InitialRate: 50, MinRate: 50, MaxRate: 50})
+
+	produced := 0
+	for {
+		_, err := source.Next(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		produced++
+	}
+	// 50 tasks per second rather than 1000 for 200ms
+	assert.InDelta(t, 10, produced, 2)
+}
+
+// TestSeededRandomSource validates that the same seed generates the same tasks
+func TestSeededRandomSource(t *testing.T) {
+	generate := func() []sourceTask {
+		profile, err := newLoadProfile(Load{}, RateLimiter{TickerTime: 1})
+		assert.NoError(t, err)
+		source := newRandomSource(profile, []Namespace{{Name: "team-a"}, {Name: "team-b"}}, func(string) bool { return true },
+			Scheduler{}, newRand(42))
+
+		tasks := make([]sourceTask, 0, 50)
+		for i := 0; i < 50; i++ {
+			task, err := source.Next(context.Background())
+			assert.NoError(t, err)
+			tasks = append(tasks, task)
+		}
+		return tasks
+	}
+
+	assert.Equal(t, generate(), generate())
+}
+
+// TestRecordAndReplay validates that a recording replays the same tasks with their relative timing
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workload.jsonl")
+	tasks := []sourceTask{
+		{Namespace: "default", Type: 1, Value: 10},
+		{Namespace: "team-a", Type: 9, Value: 99, Comment: "last"},
+	}
+
+	recorder, err := newRecordingSource(&sliceSource{tasks: tasks, pause: 100 * time.Millisecond}, path)
+	assert.NoError(t, err)
+	for {
+		_, err := recorder.Next(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+	}
+
+	replay := func(speed float64) ([]sourceTask, time.Duration) {
+		file, err := os.Open(path)
+		assert.NoError(t, err)
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+
+		source, err := newReplaySource(file, speed)
+		assert.NoError(t, err)
+		start := time.Now()
+		var replayed []sourceTask
+		for {
+			task, err := source.Next(context.Background())
+			if errors.Is(err, io.EOF) {
+				return replayed, time.Since(start)
+			}
+			assert.NoError(t, err)
+			replayed = append(replayed, task)
+		}
+	}
+
+	replayed, elapsed := replay(1)
+	assert.Equal(t, tasks, replayed)
+	assert.GreaterOrEqual(t, elapsed, 90*time.Millisecond)
+
+	_, elapsed = replay(0)
+	assert.Less(t, elapsed, 50*time.Millisecond)
+
+	_, err = newReplaySource(strings.NewReader(""), -1)
+	assert.Error(t, err)
+}
+
+// TestDryRun validates that a dry run stores, delivers and counts tasks without a database,
+// holding deferred tasks until they are due
+func TestDryRun(t *testing.T) {
+	sink := &capturingSink{}
+	store := persistence.NewMemoryStore()
+	run := &directProducer{sink: sink, dryRun: true, store: store}
+	produced := testutil.ToFloat64(tasksProduced)
+
+	source := &sliceSource{tasks: []sourceTask{
+		{Namespace: "dry-run", Type: 1, Value: 10},
+		{Namespace: "dry-run", Type: 2, Value: 20, RunAt: time.Now().Add(100 * time.Millisecond)},
+		{Namespace: "dry-run", Type: 3, Value: 30},
+	}}
+	runSource(source, "test", func(string) bool { return true }, run.produce)
+
+	assert.Equal(t, produced+3, testutil.ToFloat64(tasksProduced))
+	assert.Eventually(t, func() bool { return len(sink.received()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(sink.received()) == 3 }, time.Second, 5*time.Millisecond)
+
+	received := sink.received()
+	// Immediate tasks are delivered concurrently, the deferred one only once due
+	assert.ElementsMatch(t, []int32{1, 3}, []int32{received[0].Id, received[1].Id})
+	assert.Equal(t, int32(2), received[2].Id)
+	assert.Equal(t, int32(20), received[2].Value)
+	// Every request is marked, so a consumer sink never looks the in-memory IDs up in its database
+	sink.mu.Lock()
+	assert.Equal(t, 3, sink.dryRuns)
+	sink.mu.Unlock()
+	assert.Eventually(t, func() bool { return currentBacklog.size("dry-run") == 0 }, time.Second, 5*time.Millisecond)
+
+	// The tasks are kept in memory, as a database would keep them
+	stored, err := store.ListTasks(context.Background(), persistence.GetTasksByStateParams{
+		State:     sql.NullString{String: "received", Valid: true},
+		Namespace: "dry-run",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, stored, 3)
+}
+
+// TestPostgresOnlyFeatures validates that the enabled features the sqlite driver does not have are listed
+func TestPostgresOnlyFeatures(t *testing.T) {
+	assert.Empty(t, postgresOnlyFeatures(Config{Batch: Batch{Size: 1}}))
+
+	config := Config{
+		Recurring: Recurring{Enabled: true},
+		Batch:     Batch{Size: 100},
+		Retention: Retention{Enabled: true},
+		Dispatch:  Dispatch{Transport: transportNotify},
+	}
+	assert.Equal(t, []string{"recurring", "batch", "retention", "the notify transport"}, postgresOnlyFeatures(config))
+}
+
+// TestDirectProducerStoresTasks validates that a producer with a store takes the task IDs from it,
+// and fails a stored task whose delivery fails rather than leaving it "received"
+func TestDirectProducerStoresTasks(t *testing.T) {
+	store := persistence.NewMemoryStore()
+	run := &directProducer{sink: rejectingSink{}, store: store}
+
+	run.produce(sourceTask{Namespace: "direct", Type: 4, Value: 40, Comment: "edge"})
+
+	assert.Eventually(t, func() bool {
+		task, err := store.GetTask(context.Background(), persistence.GetTaskByIDParams{ID: 1, Namespace: "direct"})
+		return err == nil && task.State.String == "failed"
+	}, time.Second, 5*time.Millisecond)
+
+	task, err := store.GetTask(context.Background(), persistence.GetTaskByIDParams{ID: 1, Namespace: "direct"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), task.Type.Int32)
+	assert.Equal(t, "edge", task.Comment.String)
+	assert.Contains(t, string(task.Result), "not found")
+	assert.Eventually(t, func() bool { return currentBacklog.size("direct") == 0 }, time.Second, 5*time.Millisecond)
+}
+
+// rejectingSink answers every task as a consumer without it in its database would
+type rejectingSink struct{}
+
+func (rejectingSink) SendTask(ctx context.Context, in *pb.TaskRequest, _ ...grpc.CallOption) (*pb.TaskResponse, error) {
+	return nil, status.Error(codes.NotFound, "not found")
+}
+
+// capturingSink records the tasks a dry run delivers, and how many of them were marked as dry-run
+type capturingSink struct {
+	mu       sync.Mutex
+	requests []*pb.TaskRequest
+	dryRuns  int
+}
+
+func (s *capturingSink) SendTask(ctx context.Context, in *pb.TaskRequest, _ ...grpc.CallOption) (*pb.TaskResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, in)
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(dryRunMetadataKey)) > 0 {
+		s.dryRuns++
+	}
+	return &pb.TaskResponse{}, nil
+}
+
+func (s *capturingSink) received() []*pb.TaskRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*pb.TaskRequest(nil), s.requests...)
+}
+
+// sliceSource produces the given tasks with a pause before each one but the first
+type sliceSource struct {
+	tasks []sourceTask
+	pause time.Duration
+	next  int
+}
+
+func (s *sliceSource) Next(ctx context.Context) (sourceTask, error) {
+	if s.next >= len(s.tasks) {
+		return sourceTask{}, io.EOF
+	}
+	if s.next > 0 {
+		time.Sleep(s.pause)
+	}
+	s.next++
+	return s.tasks[s.next-1], nil
+}
+
+// TestJanitorPurge validates that the janitor removes expired tasks in batches until a batch comes back short
+func TestJanitorPurge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	_, err = newJanitor(persistence.New(db), Retention{MaxAgeDays: 7, Action: "shred"})
+	assert.Error(t, err)
+	_, err = newJanitor(persistence.New(db), Retention{})
+	assert.Error(t, err)
+	_, err = newJanitor(persistence.New(db), Retention{MaxAgeDays: 7, States: []string{"done", "processing"}})
+	assert.Error(t, err)
+
+	j, err := newJanitor(persistence.New(db), Retention{MaxAgeDays: 7, Action: retentionArchive, BatchSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"done"}, j.states)
+
+	now := time.Now()
+	cutoff := now.Add(-7 * 24 * time.Hour)
+	archived := testutil.ToFloat64(tasksPurged.WithLabelValues(retentionArchive))
+
+	mock.ExpectExec("INSERT INTO tasks_archive").
+		WithArgs(`{"done"}`, cutoff, int32(2)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO tasks_archive").
+		WithArgs(`{"done"}`, cutoff, int32(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	removed, err := j.purge(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), removed)
+	assert.Equal(t, archived+3, testutil.ToFloat64(tasksPurged.WithLabelValues(retentionArchive)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"grpc-in-go/persistence"
+)
+
+// Dispatch transports
+const (
+	transportGRPC   = "grpc"
+	transportNotify = "notify"
+)
+
+// notifyReconcileIntervalMs is the backlog reconcile interval of the notify transport when none is configured
+const notifyReconcileIntervalMs = 1000
+
+// dispatcher hands the tasks made "received" to the consumers. enqueue and enqueueBatch run within
+// the transaction that stores or claims the tasks, and send follows once it is committed.
+type dispatcher interface {
+	enqueue(ctx context.Context, qtx *persistence.Queries, task persistence.Task) (persistence.ClaimOutboxEntriesRow, error)
+	enqueueBatch(ctx context.Context, qtx *persistence.Queries, tasks []persistence.Task) ([]persistence.ClaimOutboxEntriesRow, error)
+	send(entry persistence.ClaimOutboxEntriesRow)
+}
+
+// notifier dispatches without talking to the consumers: it fires pg_notify('tasks', id), delivered
+// when the transaction commits, and the consumers LISTENing on the channel claim the task from the table.
+// A consumer that is down or misses the notification finds the task on its next poll.
+type notifier struct{}
+
+func (notifier) enqueue(ctx context.Context, qtx *persistence.Queries, task persistence.Task) (persistence.ClaimOutboxEntriesRow, error) {
+	entries, err := notifier{}.enqueueBatch(ctx, qtx, []persistence.Task{task})
+	if err != nil {
+		return persistence.ClaimOutboxEntriesRow{}, err
+	}
+	return entries[0], nil
+}
+
+func (notifier) enqueueBatch(ctx context.Context, qtx *persistence.Queries, tasks []persistence.Task) ([]persistence.ClaimOutboxEntriesRow, error) {
+	ids := make([]int32, 0, len(tasks))
+	entries := make([]persistence.ClaimOutboxEntriesRow, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+		entries = append(entries, persistence.ClaimOutboxEntriesRow{
+			TaskID:    task.ID,
+			Namespace: task.Namespace,
+			Type:      task.Type,
+			Value:     task.Value,
+		})
+	}
+	if err := qtx.NotifyTasks(ctx, ids); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// send has nothing to do, the notification went out with the commit
+func (notifier) send(persistence.ClaimOutboxEntriesRow) {}
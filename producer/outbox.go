@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"grpc-in-go/pb"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"strconv"
+	"time"
+)
+
+// relay delivers tasks to the consumer through the task_outbox table. An outbox entry is written in
+// the same transaction that makes a task "received"; whoever holds the entry's lease sends the task
+// and settles the entry, and the relay loop retries entries whose lease ran out without being settled,
+// e.g. because the send failed or the producer crashed. Delivery is at least once: the consumer
+// only starts a task that is still "received", so a repeated delivery is answered with NotFound.
+type relay struct {
+	db      txBeginner
+	queries *persistence.Queries
+	client  pb.TaskServiceClient
+	// controller is told the outcome of every delivery; nil when adaptive_rate is disabled
+	controller *rateController
+
+	lease        time.Duration
+	sendTimeout  time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+}
+
+func newRelay(db txBeginner, queries *persistence.Queries, client pb.TaskServiceClient, config Outbox) *relay {
+	r := &relay{
+		db:           db,
+		queries:      queries,
+		client:       client,
+		lease:        time.Duration(config.LeaseMs) * time.Millisecond,
+		sendTimeout:  time.Duration(config.SendTimeoutMs) * time.Millisecond,
+		maxAttempts:  config.MaxAttempts,
+		retryBackoff: time.Duration(config.RetryBackoffMs) * time.Millisecond,
+		maxBackoff:   time.Duration(config.MaxRetryBackoffMs) * time.Millisecond,
+	}
+	if r.lease <= 0 {
+		r.lease = 30 * time.Second
+	}
+	if r.sendTimeout <= 0 {
+		r.sendTimeout = 5 * time.Minute
+	}
+	if r.maxAttempts <= 0 {
+		r.maxAttempts = 10
+	}
+	if r.retryBackoff <= 0 {
+		r.retryBackoff = 500 * time.Millisecond
+	}
+	if r.maxBackoff < r.retryBackoff {
+		r.maxBackoff = time.Minute
+	}
+	return r
+}
+
+// enqueue writes the outbox entry of a task that was just made "received", within the caller's
+// transaction. The caller holds the lease and is expected to send the entry once committed.
+func (r *relay) enqueue(ctx context.Context, qtx *persistence.Queries, task persistence.Task) (persistence.ClaimOutboxEntriesRow, error) {
+	id, err := qtx.CreateOutboxEntry(ctx, persistence.CreateOutboxEntryParams{
+		TaskID:          task.ID,
+		Namespace:       task.Namespace,
+		NextAttemptTime: time.Now().Add(r.lease),
+	})
+	if err != nil {
+		return persistence.ClaimOutboxEntriesRow{}, err
+	}
+
+	return persistence.ClaimOutboxEntriesRow{
+		ID:        id,
+		TaskID:    task.ID,
+		Namespace: task.Namespace,
+		Type:      task.Type,
+		Value:     task.Value,
+	}, nil
+}
+
+// enqueueBatch writes the outbox entries of a batch of tasks with one multi-row INSERT, like enqueue
+func (r *relay) enqueueBatch(ctx context.Context, qtx *persistence.Queries, tasks []persistence.Task) ([]persistence.ClaimOutboxEntriesRow, error) {
+	params := persistence.CreateOutboxEntriesParams{
+		NextAttemptTime: time.Now().Add(r.lease),
+		TaskIds:         make([]int32, 0, len(tasks)),
+		Namespaces:      make([]string, 0, len(tasks)),
+	}
+	for _, task := range tasks {
+		params.TaskIds = append(params.TaskIds, task.ID)
+		params.Namespaces = append(params.Namespaces, task.Namespace)
+	}
+
+	rows, err := qtx.CreateOutboxEntries(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != len(tasks) {
+		return nil, fmt.Errorf("created %d outbox entries for %d tasks", len(rows), len(tasks))
+	}
+
+	// The entries come back in no particular order, so they are matched to their tasks by task ID
+	ids := make(map[int32]int32, len(rows))
+	for _, row := range rows {
+		ids[row.TaskID] = row.ID
+	}
+	entries := make([]persistence.ClaimOutboxEntriesRow, 0, len(tasks))
+	for _, task := range tasks {
+		id, ok := ids[task.ID]
+		if !ok {
+			return nil, fmt.Errorf("no outbox entry created for task %d", task.ID)
+		}
+		entries = append(entries, persistence.ClaimOutboxEntriesRow{
+			ID:        id,
+			TaskID:    task.ID,
+			Namespace: task.Namespace,
+			Type:      task.Type,
+			Value:     task.Value,
+		})
+	}
+	return entries, nil
+}
+
+// run periodically claims the entries whose lease expired and sends them again. Claiming uses
+// FOR UPDATE SKIP LOCKED and extends the lease, so several producers can share the work without overlap.
+func (r *relay) run(config Outbox) {
+	pollInterval := time.Duration(config.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		entries, err := r.queries.ClaimOutboxEntries(context.Background(), persistence.ClaimOutboxEntriesParams{
+			NextAttemptTime: time.Now().Add(r.lease),
+			Limit:           int32(batchSize),
+		})
+		if err != nil {
+			logger.LogError("Failed to claim outbox entries", err, &logger.LogContext{
+				"batch_size": batchSize,
+			})
+			continue
+		}
+
+		for _, entry := range entries {
+			logger.LogInfo("Redelivering task from outbox", &logger.LogContext{
+				"task_id":   entry.TaskID,
+				"namespace": entry.Namespace,
+				"attempts":  entry.Attempts,
+			})
+			r.send(entry)
+		}
+	}
+}
+
+// send delivers an outbox entry to the consumer in the background and settles it with the outcome.
+// The RPC has a deadline of its own rather than the lease: the consumer hands back a task whose caller
+// gave up on it, so cutting a slow task short only delays it. An entry whose lease runs out meanwhile
+// is delivered again, which the consumer answers with FailedPrecondition once the task was started.
+func (r *relay) send(entry persistence.ClaimOutboxEntriesRow) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.sendTimeout)
+		defer cancel()
+
+		start := time.Now()
+		res, err := r.client.SendTask(ctx, &pb.TaskRequest{
+			Id:        entry.TaskID,
+			Type:      entry.Type.Int32,
+			Value:     entry.Value.Int32,
+			Namespace: entry.Namespace,
+		})
+		taskSendDuration.With(prometheus.Labels{
+			"namespace": entry.Namespace,
+			"task_type": strconv.Itoa(int(entry.Type.Int32)),
+			"outcome":   outcomeLabel(err),
+		}).Observe(time.Since(start).Seconds())
+		if r.controller != nil {
+			r.controller.observe(entry.Namespace, res.GetLoad(), err)
+		}
+
+		if settleErr := r.settle(entry, res, err); settleErr != nil {
+			// The entry stays pending and is delivered again once its lease runs out
+			logger.LogError("Failed to settle outbox entry", settleErr, &logger.LogContext{
+				"task_id":   entry.TaskID,
+				"namespace": entry.Namespace,
+			})
+		}
+	}()
+}
+
+// settle records the outcome of one delivery: a delivered entry, or one whose task was already started,
+// is marked sent; a failed one is retried with exponential backoff until it runs out of attempts, when
+// it is marked dead and its task failed
+func (r *relay) settle(entry persistence.ClaimOutboxEntriesRow, res *pb.TaskResponse, sendErr error) error {
+	ctx := context.Background()
+
+	switch code := status.Code(sendErr); {
+	case sendErr == nil || code == codes.FailedPrecondition:
+		// FailedPrecondition means an earlier delivery already reached the consumer, which started the task
+		sent, err := r.queries.MarkOutboxSent(ctx, entry.ID)
+		if err != nil {
+			return err
+		}
+		// A concurrent delivery of the same entry may have settled it first
+		if sent == 0 {
+			return nil
+		}
+		size := currentBacklog.add(entry.Namespace, -1)
+		logger.LogInfo("Task processed, backlog decremented", &logger.LogContext{
+			"task_id":   entry.TaskID,
+			"namespace": entry.Namespace,
+			"backlog":   size,
+			"result":    res.GetResult(),
+		})
+		return nil
+
+	// NotFound means the task is gone or outside its namespace, so no later delivery can succeed
+	case code == codes.InvalidArgument || code == codes.NotFound || int(entry.Attempts)+1 >= r.maxAttempts:
+		logger.LogError("Giving up on task delivery", sendErr, &logger.LogContext{
+			"task_id":   entry.TaskID,
+			"namespace": entry.Namespace,
+			"attempts":  entry.Attempts + 1,
+		})
+		return r.abandon(ctx, entry, sendErr)
+
+	default:
+		backoff := r.backoff(entry.Attempts)
+		logger.LogError("Failed to send task, will retry", sendErr, &logger.LogContext{
+			"task_id":     entry.TaskID,
+			"namespace":   entry.Namespace,
+			"attempts":    entry.Attempts + 1,
+			"retry_after": backoff,
+		})
+		return r.queries.RetryOutboxEntry(ctx, persistence.RetryOutboxEntryParams{
+			ID:              entry.ID,
+			LastError:       sql.NullString{String: sendErr.Error(), Valid: true},
+			NextAttemptTime: time.Now().Add(backoff),
+		})
+	}
+}
+
+// abandon marks an entry dead and fails its task, skipping the workflow tasks that depend on it,
+// so the task no longer counts towards the backlog. A task that is no longer "received" was
+// started by a consumer and is left alone.
+func (r *relay) abandon(ctx context.Context, entry persistence.ClaimOutboxEntriesRow, sendErr error) error {
+	result, err := json.Marshal(map[string]string{
+		"error": fmt.Sprintf("delivery failed after %d attempts: %s", entry.Attempts+1, sendErr),
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	qtx := r.queries.WithTx(tx)
+	dead, err := qtx.MarkOutboxDead(ctx, persistence.MarkOutboxDeadParams{
+		ID:        entry.ID,
+		LastError: sql.NullString{String: sendErr.Error(), Valid: true},
+	})
+	if err != nil || dead == 0 {
+		return err
+	}
+	// A consumer may have run the task although its responses were lost; its outcome then stands
+	abandoned, err := qtx.AbandonTask(ctx, persistence.AbandonTaskParams{ID: entry.TaskID, Result: result})
+	if err != nil {
+		return err
+	}
+	if abandoned > 0 {
+		if _, err := qtx.SkipDependentTasks(ctx, entry.TaskID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	currentBacklog.add(entry.Namespace, -1)
+	return nil
+}
+
+// backoff returns the delay before the next delivery of an entry that failed attempts times before
+func (r *relay) backoff(attempts int32) time.Duration {
+	backoff := r.retryBackoff
+	for i := int32(0); i < attempts && backoff < r.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.maxBackoff {
+		return r.maxBackoff
+	}
+	return backoff
+}
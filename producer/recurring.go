@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runRecurringScheduler materialises tasks from the recurring_tasks definitions at each fire time.
+// Each definition is fired under a transaction-scoped advisory lock, so with several producers
+// running only one of them fires a given schedule.
+func runRecurringScheduler(db txBeginner, queries *persistence.Queries, config Recurring) {
+	pollInterval := time.Duration(config.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	if config.MisfireThresholdMs <= 0 {
+		config.MisfireThresholdMs = 60000
+	}
+	// Catching up is always bounded, so a long outage cannot turn into an unbounded burst of tasks
+	if config.MaxCatchUp <= 0 {
+		config.MaxCatchUp = 100
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		definitions, err := queries.ListDueRecurringTasks(context.Background(), sql.NullTime{Time: now, Valid: true})
+		if err != nil {
+			logger.LogError("Failed to list due recurring tasks", err, &logger.LogContext{})
+			continue
+		}
+
+		for _, definition := range definitions {
+			if err := fireRecurringTask(db, queries, definition.ID, now, config); err != nil {
+				logger.LogError("Failed to fire recurring task", err, &logger.LogContext{
+					"recurring_task": definition.Name,
+				})
+			}
+		}
+	}
+}
+
+// fireRecurringTask creates the tasks due for one definition and advances its next fire time
+func fireRecurringTask(db txBeginner, queries *persistence.Queries, id int32, now time.Time, config Recurring) error {
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	qtx := queries.WithTx(tx)
+
+	// Another producer holds this schedule; it will do the firing
+	locked, err := qtx.TryLockRecurringTask(ctx, id)
+	if err != nil || !locked {
+		return err
+	}
+
+	// Re-read under the lock, as another producer may have fired it since it was listed
+	definition, err := qtx.GetRecurringTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !definition.Enabled || (definition.NextFireTime.Valid && definition.NextFireTime.Time.After(now)) {
+		return nil
+	}
+
+	schedule, err := cron.ParseStandard(definition.CronSpec)
+	if err != nil {
+		return err
+	}
+
+	// A new or re-enabled definition starts from its next fire time rather than firing immediately
+	if !definition.NextFireTime.Valid {
+		return advanceRecurringTask(ctx, tx, qtx, definition, sql.NullTime{}, schedule.Next(now))
+	}
+
+	fires, skipped, next := dueFireTimes(schedule, definition.NextFireTime.Time, now, definition.CatchUp,
+		time.Duration(config.MisfireThresholdMs)*time.Millisecond, config.MaxCatchUp)
+
+	lastFire := definition.LastFireTime
+	for _, fireTime := range fires {
+		taskID, err := qtx.ScheduleTask(ctx, persistence.ScheduleTaskParams{
+			Type:      sql.NullInt32{Int32: definition.Type, Valid: true},
+			Value:     sql.NullInt32{Int32: definition.Value, Valid: true},
+			Comment:   sql.NullString{String: "recurring:" + definition.Name, Valid: true},
+			RunAt:     fireTime,
+			Namespace: definition.Namespace,
+		})
+		if err != nil {
+			return err
+		}
+		lastFire = sql.NullTime{Time: fireTime, Valid: true}
+		logger.LogInfo("Recurring task fired", &logger.LogContext{
+			"recurring_task": definition.Name,
+			"task_id":        taskID,
+			"fire_time":      fireTime,
+		})
+	}
+
+	if skipped {
+		logger.LogWarn("Skipped missed recurring task fires", &logger.LogContext{
+			"recurring_task": definition.Name,
+			"missed_since":   definition.NextFireTime.Time,
+		})
+	}
+
+	return advanceRecurringTask(ctx, tx, qtx, definition, lastFire, next)
+}
+
+func advanceRecurringTask(ctx context.Context, tx *sql.Tx, qtx *persistence.Queries, definition persistence.RecurringTask, lastFire sql.NullTime, next time.Time) error {
+	err := qtx.UpdateRecurringTaskFireTimes(ctx, persistence.UpdateRecurringTaskFireTimesParams{
+		ID:           definition.ID,
+		LastFireTime: lastFire,
+		NextFireTime: sql.NullTime{Time: next, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// dueFireTimes returns the fire times from next up to now that should produce a task, whether missed
+// fires were skipped, and the first fire time after now. With catchUp the most recent maxCatchUp missed
+// fires are returned; otherwise only the latest, if it is no older than misfireThreshold. Only the fires
+// near now are stepped through, so a long outage on a fine-grained schedule costs no more than a short one.
+func dueFireTimes(schedule cron.Schedule, next time.Time, now time.Time, catchUp bool, misfireThreshold time.Duration, maxCatchUp int) ([]time.Time, bool, time.Time) {
+	if next.After(now) {
+		return nil, false, next
+	}
+	limit := maxCatchUp
+	if !catchUp || limit <= 0 {
+		limit = 1
+	}
+	following := schedule.Next(now)
+
+	// Look back over a window holding about limit fires, doubling it until it holds limit fires or reaches next
+	var fires []time.Time
+	span := time.Duration(limit) * schedule.Next(following).Sub(following)
+	for {
+		from := now.Add(-span)
+		if !from.After(next) {
+			fires = lastFireTimes(schedule, next, now, limit)
+			break
+		}
+		// The first fire at or after from
+		fires = lastFireTimes(schedule, schedule.Next(from.Add(-time.Nanosecond)), now, limit)
+		if len(fires) == limit {
+			break
+		}
+		span *= 2
+	}
+	skipped := fires[0].After(next)
+
+	if !catchUp && now.Sub(fires[0]) > misfireThreshold {
+		return nil, true, following
+	}
+	return fires, skipped, following
+}
+
+// lastFireTimes steps through the fire times from first up to now and returns the last limit of them
+func lastFireTimes(schedule cron.Schedule, first time.Time, now time.Time, limit int) []time.Time {
+	var fires []time.Time
+	for fireTime := first; !fireTime.After(now); fireTime = schedule.Next(fireTime) {
+		fires = append(fires, fireTime)
+		if len(fires) > limit {
+			fires = fires[1:]
+		}
+	}
+	return fires
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"grpc-in-go/util/logger"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// newRand returns the random source of the task generator. A zero seed picks one from the clock,
+// which is logged so that the run can be reproduced by configuring it.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logger.LogInfo("Seeding task generator", &logger.LogContext{
+		"seed": seed,
+	})
+	return rand.New(rand.NewSource(seed))
+}
+
+// recordedTask is one line of a recording: the task as accepted by the JSONL sources, plus when
+// it was produced and by how much it was deferred, both relative so the recording can be replayed
+//
+//	{"at_ms": 12.5, "type": 3, "value": 42, "namespace": "team-a", "delay_ms": 1000}
+type recordedTask struct {
+	AtMs      float64 `json:"at_ms"`
+	Namespace string  `json:"namespace"`
+	Type      int     `json:"type"`
+	Value     int     `json:"value"`
+	Comment   string  `json:"comment,omitempty"`
+	DelayMs   int64   `json:"delay_ms,omitempty"`
+}
+
+// recordingSource writes every task of the source it wraps to a file, with its offset from the start of the recording
+type recordingSource struct {
+	source TaskSource
+	file   *os.File
+	w      *bufio.Writer
+	start  time.Time
+}
+
+func newRecordingSource(source TaskSource, path string) (*recordingSource, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("Recording produced tasks", &logger.LogContext{
+		"path": path,
+	})
+	return &recordingSource{source: source, file: file, w: bufio.NewWriter(file), start: time.Now()}, nil
+}
+
+func (s *recordingSource) Next(ctx context.Context) (sourceTask, error) {
+	task, err := s.source.Next(ctx)
+	if err != nil {
+		// The recording is complete once the source is exhausted
+		if closeErr := s.close(); closeErr != nil {
+			logger.LogError("Failed to close recording", closeErr, &logger.LogContext{})
+		}
+		return task, err
+	}
+
+	now := time.Now()
+	record := recordedTask{
+		AtMs:      float64(now.Sub(s.start)) / float64(time.Millisecond),
+		Namespace: task.Namespace,
+		Type:      task.Type,
+		Value:     task.Value,
+		Comment:   task.Comment,
+	}
+	if !task.RunAt.IsZero() {
+		record.DelayMs = task.RunAt.Sub(now).Milliseconds()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return task, err
+	}
+	// Flush every line so that a recording survives the producer being killed
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return task, err
+	}
+	return task, s.w.Flush()
+}
+
+func (s *recordingSource) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
+
+// replaySource re-issues a recording. Tasks keep their relative timing divided by speed,
+// so 1 replays at the original speed, 2 twice as fast, and 0 as fast as possible.
+type replaySource struct {
+	scanner *bufio.Scanner
+	speed   float64
+	start   time.Time
+	line    int
+}
+
+func newReplaySource(r io.Reader, speed float64) (*replaySource, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("source.replay_speed must not be negative, got %v", speed)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTaskLineBytes)
+	return &replaySource{scanner: scanner, speed: speed}, nil
+}
+
+func (s *replaySource) Next(ctx context.Context) (sourceTask, error) {
+	for s.scanner.Scan() {
+		s.line++
+		if len(s.scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record recordedTask
+		if err := json.Unmarshal(s.scanner.Bytes(), &record); err != nil {
+			return sourceTask{}, fmt.Errorf("recording line %d: %w", s.line, err)
+		}
+
+		// Timing is relative to the first task, so replay starts without waiting
+		if s.start.IsZero() {
+			s.start = time.Now().Add(-s.offset(record))
+		}
+		if delay := time.Until(s.start.Add(s.offset(record))); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return sourceTask{}, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		task, err := validateTask(sourceTask{
+			Namespace: record.Namespace,
+			Type:      record.Type,
+			Value:     record.Value,
+			Comment:   record.Comment,
+		})
+		if err != nil {
+			return sourceTask{}, fmt.Errorf("recording line %d: %w", s.line, err)
+		}
+		// Deferred tasks are scaled like the rest of the timing, except at max speed
+		if record.DelayMs > 0 {
+			delay := time.Duration(record.DelayMs) * time.Millisecond
+			if s.speed > 0 {
+				delay = time.Duration(float64(delay) / s.speed)
+			}
+			task.RunAt = time.Now().Add(delay)
+		}
+		return task, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return sourceTask{}, err
+	}
+	return sourceTask{}, io.EOF
+}
+
+// offset returns when a recorded task is due relative to the start of the replay
+func (s *replaySource) offset(record recordedTask) time.Duration {
+	if s.speed == 0 {
+		return 0
+	}
+	return time.Duration(record.AtMs / s.speed * float64(time.Millisecond))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+	"math/rand"
+	"time"
+)
+
+// runScheduler periodically claims scheduled tasks whose run time has passed, pending workflow tasks
+// whose parents are all done and processing tasks whose lease expired, and dispatches them. Claiming
+// uses FOR UPDATE SKIP LOCKED, so several producers can share the work without overlap.
+func runScheduler(db txBeginner, queries *persistence.Queries, d dispatcher, config Scheduler) {
+	pollInterval := time.Duration(config.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := dispatchClaimedTasks(db, queries, d, "scheduled", func(qtx *persistence.Queries) ([]persistence.Task, error) {
+			return qtx.ClaimDueTasks(context.Background(), int32(batchSize))
+		}); err != nil {
+			logger.LogError("Failed to claim due tasks", err, &logger.LogContext{
+				"batch_size": batchSize,
+			})
+		}
+
+		if err := dispatchClaimedTasks(db, queries, d, "workflow", func(qtx *persistence.Queries) ([]persistence.Task, error) {
+			return qtx.ClaimReadyTasks(context.Background(), int32(batchSize))
+		}); err != nil {
+			logger.LogError("Failed to claim ready workflow tasks", err, &logger.LogContext{
+				"batch_size": batchSize,
+			})
+		}
+
+		// Tasks whose consumer died while processing them are handed out again once their lease runs out.
+		// Should that consumer finish after all, it no longer holds the lease and its outcome is discarded.
+		if err := dispatchClaimedTasks(db, queries, d, "expired", func(qtx *persistence.Queries) ([]persistence.Task, error) {
+			return qtx.RequeueExpiredTasks(context.Background(), int32(batchSize))
+		}); err != nil {
+			logger.LogError("Failed to requeue expired tasks", err, &logger.LogContext{
+				"batch_size": batchSize,
+			})
+		}
+	}
+}
+
+// dispatchClaimedTasks moves the tasks returned by claim to "received" and dispatches them in one
+// transaction, then sends them on to the consumer
+func dispatchClaimedTasks(db txBeginner, queries *persistence.Queries, d dispatcher, kind string, claim func(qtx *persistence.Queries) ([]persistence.Task, error)) error {
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	qtx := queries.WithTx(tx)
+	tasks, err := claim(qtx)
+	if err != nil {
+		return err
+	}
+	entries, err := d.enqueueBatch(ctx, qtx, tasks)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, task := range tasks {
+		size := currentBacklog.add(task.Namespace, 1)
+		logger.LogInfo(fmt.Sprintf("Dispatching %s task, backlog size: %d", kind, size), &logger.LogContext{
+			"task_id":     task.ID,
+			"namespace":   task.Namespace,
+			"run_at":      task.RunAt,
+			"workflow_id": task.WorkflowID.Int32,
+		})
+
+		d.send(entries[i])
+	}
+	return nil
+}
+
+// randomRunAt defers a DelayedRatio share of generated tasks by up to MaxDelayMs,
+// returning the zero time for tasks that should run immediately
+func randomRunAt(config Scheduler, rng *rand.Rand) time.Time {
+	if config.DelayedRatio <= 0 || config.MaxDelayMs <= 0 || rng.Float64() >= config.DelayedRatio {
+		return time.Time{}
+	}
+	delay := time.Duration(rng.Intn(config.MaxDelayMs)+1) * time.Millisecond
+	return time.Now().Add(delay)
+}
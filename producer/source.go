@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"grpc-in-go/util/logger"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Task type and value bounds, matching the CHECK constraints of the tasks table
+const (
+	minTaskType  = 0
+	maxTaskType  = 9
+	minTaskValue = 0
+	maxTaskValue = 99
+)
+
+// maxTaskLineBytes bounds a single JSONL line read from a file, stdin, HTTP or socket source
+const maxTaskLineBytes = 1024 * 1024
+
+// namespacePattern matches the namespaces the consumer accepts
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// sourceTask is a task produced by a TaskSource, before it is stored and dispatched
+type sourceTask struct {
+	Namespace string
+	Type      int
+	Value     int
+	Comment   string
+	// RunAt defers the task when set; the zero time dispatches it immediately
+	RunAt time.Time
+}
+
+// TaskSource produces the tasks the producer creates and dispatches. Next blocks until a task is
+// available and returns io.EOF once the source is exhausted.
+type TaskSource interface {
+	Next(ctx context.Context) (sourceTask, error)
+}
+
+// newTaskSource creates the source selected by source.kind. hasRoom reports whether a namespace
+// is below its backlog cap, so the random generator can skip full namespaces instead of waiting.
+// The random generator's rate is also capped by controller unless it is nil.
+func newTaskSource(config Config, namespaces []Namespace, hasRoom func(namespace string) bool, controller *rateController) (TaskSource, error) {
+	switch config.Source.Kind {
+	case "", "random":
+		profile, err := newLoadProfile(config.Load, config.RateLimiter)
+		if err != nil {
+			return nil, err
+		}
+		source := newRandomSource(profile, namespaces, hasRoom, config.Scheduler, newRand(config.Seed))
+		source.controller = controller
+		if source.taskType, err = newSampler(config.Distributions.Type, minTaskType, maxTaskType, source.rng); err != nil {
+			return nil, fmt.Errorf("distributions.type: %w", err)
+		}
+		if source.taskValue, err = newSampler(config.Distributions.Value, minTaskValue, maxTaskValue, source.rng); err != nil {
+			return nil, fmt.Errorf("distributions.value: %w", err)
+		}
+		return source, nil
+	case "file":
+		file, err := os.Open(config.Source.Path)
+		if err != nil {
+			return nil, err
+		}
+		return newJSONLSource(file, config.Source.Path), nil
+	case "stdin":
+		return newJSONLSource(os.Stdin, "stdin"), nil
+	case "http":
+		return newHTTPSource(config.Source.HTTPAddr)
+	case "unix":
+		return newUnixSource(config.Source.Path)
+	case "replay":
+		file, err := os.Open(config.Source.Path)
+		if err != nil {
+			return nil, err
+		}
+		return newReplaySource(file, config.Source.ReplaySpeed)
+	default:
+		return nil, fmt.Errorf("unknown task source %q", config.Source.Kind)
+	}
+}
+
+// maxLoadLag is how far the random source may fall behind its load profile before it stops
+// catching up, so a pause such as an open circuit breaker is not followed by a burst
+const maxLoadLag = time.Second
+
+// randomSource generates random tasks at the rate of its load profile, returning
+// io.EOF once a profile that does not repeat has run its course
+type randomSource struct {
+	profile    *loadProfile
+	namespaces []Namespace
+	hasRoom    func(namespace string) bool
+	scheduler  Scheduler
+	rng        *rand.Rand
+	// controller caps the profile's rate to what the consumer can take; nil when adaptive_rate is disabled
+	controller *rateController
+	// taskType and taskValue draw the fields of each task, uniformly unless distributions are configured
+	taskType  sampler
+	taskValue sampler
+
+	start time.Time
+	// last is when the wait was last accounted for, or the zero time while the target rate is zero
+	last time.Time
+	// remaining is the time until the next task at a rate of one task per second; negative when behind
+	remaining time.Duration
+}
+
+func newRandomSource(profile *loadProfile, namespaces []Namespace, hasRoom func(namespace string) bool, scheduler Scheduler, rng *rand.Rand) *randomSource {
+	// The uniform distribution needs no validation
+	taskType, _ := newSampler(Distribution{}, minTaskType, maxTaskType, rng)
+	taskValue, _ := newSampler(Distribution{}, minTaskValue, maxTaskValue, rng)
+	return &randomSource{
+		profile:    profile,
+		namespaces: namespaces,
+		hasRoom:    hasRoom,
+		scheduler:  scheduler,
+		rng:        rng,
+		taskType:   taskType,
+		taskValue:  taskValue,
+		start:      time.Now(),
+	}
+}
+
+func (s *randomSource) Next(ctx context.Context) (sourceTask, error) {
+	for {
+		if err := s.wait(ctx); err != nil {
+			return sourceTask{}, err
+		}
+
+		// Each namespace has its own backlog cap, so a namespace the consumer is slow on does not stall the others
+		namespace := s.namespaces[s.rng.Intn(len(s.namespaces))]
+		if !s.hasRoom(namespace.Name) {
+			logger.LogWarn("Max backlog reached, pausing task production", &logger.LogContext{
+				"namespace": namespace.Name,
+			})
+			continue
+		}
+
+		return sourceTask{
+			Namespace: namespace.Name,
+			Type:      s.taskType(),
+			Value:     s.taskValue(),
+			RunAt:     randomRunAt(s.scheduler, s.rng),
+		}, nil
+	}
+}
+
+// wait blocks until the next task is due under the load profile and exports the target rate. It wakes
+// up at least every loadIdlePoll and counts the time waited at the current rate, so a long gap at a
+// low rate ends early once the profile moves on to a higher one.
+func (s *randomSource) wait(ctx context.Context) error {
+	drawn := false
+	for {
+		now := time.Now()
+		phase, offset, ok := s.profile.at(now.Sub(s.start))
+		if !ok {
+			producerTargetRate.Set(0)
+			return io.EOF
+		}
+		rate := phase.rate(offset)
+		producerTargetRate.Set(rate)
+		if s.controller != nil {
+			rate = math.Min(rate, s.controller.limit())
+		}
+
+		delay := loadIdlePoll
+		if rate > 0 {
+			if !s.last.IsZero() {
+				s.remaining -= time.Duration(float64(now.Sub(s.last)) * rate)
+			}
+			s.last = now
+			if !drawn {
+				s.remaining += phase.interval(1, s.rng)
+				drawn = true
+			}
+			// Oversleeping is made up by the next tasks, so it does not lower the achieved rate
+			if behind := time.Duration(float64(-s.remaining) / rate); behind > maxLoadLag {
+				s.remaining = 0
+			}
+			if s.remaining <= 0 {
+				return nil
+			}
+			delay = min(time.Duration(float64(s.remaining)/rate), loadIdlePoll)
+		} else {
+			s.last = time.Time{}
+			s.remaining = 0
+			drawn = false
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// jsonlSource reads one JSON task per line, e.g. from a file or stdin
+type jsonlSource struct {
+	name    string
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLSource(r io.Reader, name string) *jsonlSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTaskLineBytes)
+	return &jsonlSource{name: name, scanner: scanner}
+}
+
+// Next returns the next valid task, logging and skipping lines that are not
+func (s *jsonlSource) Next(ctx context.Context) (sourceTask, error) {
+	for s.scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return sourceTask{}, err
+		}
+		s.line++
+
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		task, err := decodeTask(line)
+		if err != nil {
+			taskProductionFailures.Inc()
+			logger.LogError("Skipping invalid task", err, &logger.LogContext{
+				"source": s.name,
+				"line":   s.line,
+			})
+			continue
+		}
+		return task, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return sourceTask{}, err
+	}
+	return sourceTask{}, io.EOF
+}
+
+// jsonTask is the JSON form of a task accepted by the file, stdin, HTTP and socket sources:
+//
+//	{"type": 3, "value": 42, "namespace": "team-a", "comment": "nightly", "run_at": "2024-09-01T12:00:00Z"}
+type jsonTask struct {
+	Namespace string    `json:"namespace"`
+	Type      *int      `json:"type"`
+	Value     *int      `json:"value"`
+	Comment   string    `json:"comment"`
+	RunAt     time.Time `json:"run_at"`
+}
+
+// decodeTask parses and validates one JSON task; type and value are required, namespace defaults to "default"
+func decodeTask(data []byte) (sourceTask, error) {
+	var task jsonTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return sourceTask{}, err
+	}
+
+	if task.Type == nil || task.Value == nil {
+		return sourceTask{}, errors.New("type and value are required")
+	}
+
+	return validateTask(sourceTask{
+		Namespace: task.Namespace,
+		Type:      *task.Type,
+		Value:     *task.Value,
+		Comment:   task.Comment,
+		RunAt:     task.RunAt,
+	})
+}
+
+// validateTask checks a task against the tasks table bounds, defaulting its namespace to "default"
+func validateTask(task sourceTask) (sourceTask, error) {
+	if task.Type < minTaskType || task.Type > maxTaskType {
+		return sourceTask{}, fmt.Errorf("type %d is outside [%d, %d]", task.Type, minTaskType, maxTaskType)
+	}
+	if task.Value < minTaskValue || task.Value > maxTaskValue {
+		return sourceTask{}, fmt.Errorf("value %d is outside [%d, %d]", task.Value, minTaskValue, maxTaskValue)
+	}
+	if task.Namespace == "" {
+		task.Namespace = defaultNamespace
+	}
+	if !namespacePattern.MatchString(task.Namespace) {
+		return sourceTask{}, fmt.Errorf("invalid namespace %q", task.Namespace)
+	}
+	return task, nil
+}
@@ -7,17 +7,27 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/lib/pq"
+	"grpc-in-go/persistence"
 	"grpc-in-go/util"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
+// partitionPrefix names the daily partitions of tasks, followed by their day as YYYYMMDD
+const partitionPrefix = "tasks_p"
+
 type Config struct {
-	Database Database `mapstructure:"database"`
+	Database   Database   `mapstructure:"database"`
+	Partitions Partitions `mapstructure:"partitions"`
 }
 
 type Database struct {
+	// Driver is "postgres" (default) or "sqlite", whose migrations are read from migrations/sqlite
+	Driver   string `mapstructure:"driver"`
+	Path     string `mapstructure:"path"`
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	User     string `mapstructure:"user"`
@@ -26,10 +36,20 @@ type Database struct {
 	SslMode  string `mapstructure:"sslmode"`
 }
 
+// Partitions configures the partitions subcommand, for a tasks table partitioned by migrations/optional/partition_tasks.up.sql
+type Partitions struct {
+	// PremakeDays daily partitions are created ahead of today
+	PremakeDays int `mapstructure:"premake_days"`
+	// RetentionDays is how many days of partitions are kept before today; 0 keeps them all
+	RetentionDays int `mapstructure:"retention_days"`
+	// IntervalMs keeps the subcommand running, managing the partitions again every IntervalMs; 0 runs it once
+	IntervalMs int `mapstructure:"interval_ms"`
+}
+
 func main() {
 	appConfig := &util.AppConfig{
 		FilePath: "configs",
-		FileName: "consumer",
+		FileName: "migrate",
 		Type:     util.ConfigYAML,
 	}
 
@@ -52,20 +72,23 @@ func main() {
 	// Accept migration file as an argument
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: go run migrate.go <migration_file.sql>")
+		fmt.Println("       go run migrate.go partitions")
 		os.Exit(1)
 	}
 
-	migrationFile := os.Args[1]
-
-	// Read the SQL file
-	sqlBytes, err := ioutil.ReadFile(fmt.Sprintf("migrations/%s", migrationFile))
-	if err != nil {
-		log.Fatalf("Failed to read the migration file %s: %v", migrationFile, err)
+	// Connect to the database of the configured driver
+	migrationsDir := "migrations"
+	var db *sql.DB
+	var err error
+	switch config.Database.Driver {
+	case "", persistence.DriverPostgres:
+		db, err = sql.Open("postgres", dbSource)
+	case persistence.DriverSQLite:
+		migrationsDir = "migrations/sqlite"
+		db, err = persistence.OpenSQLite(config.Database.Path)
+	default:
+		err = fmt.Errorf("unknown driver %q", config.Database.Driver)
 	}
-	sqlQuery := string(sqlBytes)
-
-	// Connect to the Postgres database (adjust connection string as needed)
-	db, err := sql.Open("postgres", dbSource)
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
@@ -76,6 +99,35 @@ func main() {
 		}
 	}(db)
 
+	if os.Args[1] == "partitions" {
+		if config.Database.Driver == persistence.DriverSQLite {
+			log.Fatalf("Partitions are only available on the %s database driver", persistence.DriverPostgres)
+		}
+		if err := managePartitions(db, config.Partitions, time.Now()); err != nil {
+			log.Fatalf("Failed to manage partitions: %v", err)
+		}
+		if config.Partitions.IntervalMs <= 0 {
+			return
+		}
+		// Keep managing them, so the partitions stay in place without an external scheduler
+		ticker := time.NewTicker(time.Duration(config.Partitions.IntervalMs) * time.Millisecond)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if err := managePartitions(db, config.Partitions, now); err != nil {
+				log.Printf("Failed to manage partitions, retrying in %d ms: %v", config.Partitions.IntervalMs, err)
+			}
+		}
+	}
+
+	migrationFile := os.Args[1]
+
+	// Read the SQL file
+	sqlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", migrationsDir, migrationFile))
+	if err != nil {
+		log.Fatalf("Failed to read the migration file %s: %v", migrationFile, err)
+	}
+	sqlQuery := string(sqlBytes)
+
 	// Run the SQL query (migration)
 	_, err = db.Exec(sqlQuery)
 	if err != nil {
@@ -84,3 +136,152 @@ func main() {
 
 	log.Printf("Migration %s applied successfully!", migrationFile)
 }
+
+// managePartitions creates the daily partitions of tasks from today to PremakeDays ahead, and drops those
+// that ended over RetentionDays ago. A partition still holding unfinished tasks is kept, and left to the janitor.
+func managePartitions(db *sql.DB, config Partitions, now time.Time) error {
+	var partitioned bool
+	err := db.QueryRow(`SELECT EXISTS (
+		SELECT 1 FROM pg_partitioned_table pt JOIN pg_class c ON c.oid = pt.partrelid WHERE c.relname = 'tasks'
+	)`).Scan(&partitioned)
+	if err != nil {
+		return err
+	}
+	if !partitioned {
+		return fmt.Errorf("tasks is not partitioned, apply migrations/optional/partition_tasks.up.sql first")
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	for i := 0; i <= config.PremakeDays; i++ {
+		day := today.AddDate(0, 0, i)
+		if err := createPartition(db, day); err != nil {
+			return fmt.Errorf("creating partition for %s: %w", day.Format(time.DateOnly), err)
+		}
+	}
+	log.Printf("Partitions up to %s are in place", partitionName(today.AddDate(0, 0, config.PremakeDays)))
+
+	if config.RetentionDays <= 0 {
+		return nil
+	}
+
+	rows, err := db.Query(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'tasks'`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	oldest := today.AddDate(0, 0, -config.RetentionDays)
+	for _, name := range names {
+		day, ok := partitionDay(name)
+		if !ok || !day.Before(oldest) {
+			continue
+		}
+
+		var unfinished bool
+		query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE state NOT IN ('done', 'failed', 'skipped'))", name)
+		if err := db.QueryRow(query).Scan(&unfinished); err != nil {
+			return err
+		}
+		if unfinished {
+			log.Printf("Keeping expired partition %s, which still holds unfinished tasks", name)
+			continue
+		}
+
+		if err := dropPartition(db, name); err != nil {
+			return fmt.Errorf("dropping partition %s: %w", name, err)
+		}
+		log.Printf("Dropped expired partition %s", name)
+	}
+	return nil
+}
+
+// createPartition creates the partition of the tasks created on day, unless it exists. Tasks created on
+// that day while it had no partition landed in tasks_default, which keeps a partition for the day from being
+// attached, so they are moved into the new partition first, in the same transaction.
+func createPartition(db *sql.DB, day time.Time) error {
+	name := partitionName(day)
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	from, to := day.Format(time.RFC3339), day.AddDate(0, 0, 1).Format(time.RFC3339)
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (LIKE tasks INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name),
+		fmt.Sprintf("WITH moved AS (DELETE FROM tasks_default WHERE creation_time >= '%s' AND creation_time < '%s' RETURNING *) INSERT INTO %s SELECT * FROM moved", from, to, name),
+		fmt.Sprintf("ALTER TABLE tasks ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')", name, from, to),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// dropPartition drops a partition together with the events, outbox entries and dependencies of its
+// tasks, which have no foreign keys to remove them, in one transaction
+func dropPartition(db *sql.DB, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	statements := []string{
+		fmt.Sprintf("DELETE FROM task_events WHERE task_id IN (SELECT id FROM %s)", name),
+		fmt.Sprintf("DELETE FROM task_outbox WHERE task_id IN (SELECT id FROM %s)", name),
+		fmt.Sprintf("DELETE FROM task_dependencies WHERE task_id IN (SELECT id FROM %[1]s) OR depends_on_id IN (SELECT id FROM %[1]s)", name),
+		fmt.Sprintf("DROP TABLE %s", name),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// partitionName returns the name of the partition holding the tasks created on day
+func partitionName(day time.Time) string {
+	return partitionPrefix + day.Format("20060102")
+}
+
+// partitionDay returns the day of a daily partition, and false for any other partition
+func partitionDay(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, partitionPrefix) {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("20060102", strings.TrimPrefix(name, partitionPrefix))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
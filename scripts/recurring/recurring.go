@@ -0,0 +1,183 @@
+// Manage the recurring task definitions fired by the producer:
+//
+//	go run scripts/recurring/recurring.go list
+//	go run scripts/recurring/recurring.go add <name> "<cron_spec>" <type> <value> [catch-up]
+//	go run scripts/recurring/recurring.go enable <name>
+//	go run scripts/recurring/recurring.go disable <name>
+//	go run scripts/recurring/recurring.go delete <name>
+//
+// Definitions are added to the namespace named by the NAMESPACE environment variable, "default" if unset.
+// Names follow the same rules as the namespaces accepted by the consumer.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
+	"github.com/robfig/cron/v3"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+type Config struct {
+	Database Database `mapstructure:"database"`
+}
+
+type Database struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	DbName   string `mapstructure:"dbname"`
+	SslMode  string `mapstructure:"sslmode"`
+}
+
+// namespacePattern matches the namespaces the consumer accepts
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+const usage = `Usage:
+  go run scripts/recurring/recurring.go list
+  go run scripts/recurring/recurring.go add <name> "<cron_spec>" <type> <value> [catch-up]
+  go run scripts/recurring/recurring.go enable <name>
+  go run scripts/recurring/recurring.go disable <name>
+  go run scripts/recurring/recurring.go delete <name>`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	appConfig := &util.AppConfig{
+		FilePath: "configs",
+		FileName: "producer",
+		Type:     util.ConfigYAML,
+	}
+
+	var config Config
+
+	// Load the configuration using the utility function
+	if err := util.LoadConfig(appConfig, &config); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	dbSource := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		config.Database.User,
+		config.Database.Password,
+		config.Database.Host,
+		config.Database.Port,
+		config.Database.DbName,
+		config.Database.SslMode,
+	)
+
+	db, err := sql.Open("postgres", dbSource)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	queries := persistence.New(db)
+	ctx := context.Background()
+
+	switch command := os.Args[1]; command {
+	case "list":
+		definitions, err := queries.ListRecurringTasks(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list recurring tasks: %v", err)
+		}
+		for _, d := range definitions {
+			next := "-"
+			if d.NextFireTime.Valid {
+				next = d.NextFireTime.Time.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%-20s %-20s namespace=%s type=%d value=%d enabled=%t catch_up=%t next=%s\n",
+				d.Name, d.CronSpec, d.Namespace, d.Type, d.Value, d.Enabled, d.CatchUp, next)
+		}
+
+	case "add":
+		if len(os.Args) < 6 {
+			fmt.Println(usage)
+			os.Exit(1)
+		}
+		name, spec := os.Args[2], os.Args[3]
+		if _, err := cron.ParseStandard(spec); err != nil {
+			log.Fatalf("Invalid cron spec %q: %v", spec, err)
+		}
+		taskType, err := strconv.Atoi(os.Args[4])
+		if err != nil {
+			log.Fatalf("Invalid task type %q: %v", os.Args[4], err)
+		}
+		taskValue, err := strconv.Atoi(os.Args[5])
+		if err != nil {
+			log.Fatalf("Invalid task value %q: %v", os.Args[5], err)
+		}
+
+		namespace := os.Getenv("NAMESPACE")
+		if namespace == "" {
+			namespace = "default"
+		}
+		if !namespacePattern.MatchString(namespace) {
+			log.Fatalf("Invalid namespace %q", namespace)
+		}
+
+		_, err = queries.CreateRecurringTask(ctx, persistence.CreateRecurringTaskParams{
+			Name:      name,
+			CronSpec:  spec,
+			Type:      int32(taskType),
+			Value:     int32(taskValue),
+			Enabled:   true,
+			CatchUp:   len(os.Args) > 6 && os.Args[6] == "catch-up",
+			Namespace: namespace,
+		})
+		if err != nil {
+			log.Fatalf("Failed to add recurring task %s: %v", name, err)
+		}
+		log.Printf("Recurring task %s added to namespace %s", name, namespace)
+
+	case "enable", "disable":
+		if len(os.Args) < 3 {
+			fmt.Println(usage)
+			os.Exit(1)
+		}
+		updated, err := queries.SetRecurringTaskEnabled(ctx, persistence.SetRecurringTaskEnabledParams{
+			Name:    os.Args[2],
+			Enabled: command == "enable",
+		})
+		if err != nil {
+			log.Fatalf("Failed to %s recurring task %s: %v", command, os.Args[2], err)
+		}
+		if updated == 0 {
+			log.Fatalf("Recurring task %s not found", os.Args[2])
+		}
+		log.Printf("Recurring task %s %sd", os.Args[2], command)
+
+	case "delete":
+		if len(os.Args) < 3 {
+			fmt.Println(usage)
+			os.Exit(1)
+		}
+		deleted, err := queries.DeleteRecurringTask(ctx, os.Args[2])
+		if err != nil {
+			log.Fatalf("Failed to delete recurring task %s: %v", os.Args[2], err)
+		}
+		if deleted == 0 {
+			log.Fatalf("Recurring task %s not found", os.Args[2])
+		}
+		log.Printf("Recurring task %s deleted", os.Args[2])
+
+	default:
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+}
@@ -1,13 +1,294 @@
 -- name: CreateTask :one
-INSERT INTO tasks (type, value, state)
-VALUES ($1, $2, 'received')
+INSERT INTO tasks (type, value, state, comment, namespace)
+VALUES ($1, $2, 'received', $3, $4)
 RETURNING id;
 
+-- name: CreateTasks :many
+WITH batch AS (
+    SELECT nextval('tasks_id_seq')::INT AS id, t.type, t.value, t.comment, t.namespace, t.ord
+    FROM unnest(sqlc.arg(task_types)::INT[], sqlc.arg(task_values)::INT[], sqlc.arg(comments)::TEXT[], sqlc.arg(namespaces)::TEXT[])
+        WITH ORDINALITY AS t(type, value, comment, namespace, ord)
+), inserted AS (
+    INSERT INTO tasks (id, type, value, state, comment, namespace)
+    SELECT id, type, value, 'received', NULLIF(comment, ''), namespace FROM batch
+    RETURNING id
+)
+SELECT inserted.id, batch.ord FROM inserted JOIN batch ON batch.id = inserted.id;
+
+-- name: ScheduleTask :one
+INSERT INTO tasks (type, value, state, comment, run_at, namespace)
+VALUES ($1, $2, 'scheduled', $3, $4, $5)
+RETURNING id;
+
+-- name: RescheduleTask :execrows
+UPDATE tasks SET state = 'scheduled', run_at = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND namespace = $3 AND state = 'received';
+
+-- name: ClaimDueTasks :many
+UPDATE tasks SET state = 'received', last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM tasks
+    WHERE state = 'scheduled' AND run_at <= CURRENT_TIMESTAMP
+    ORDER BY run_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: PeekClaimableTasks :many
+SELECT namespace FROM tasks
+WHERE state = 'received' OR (state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP)
+ORDER BY id
+LIMIT $1;
+
+-- name: ClaimTasks :many
+UPDATE tasks SET state = 'processing', lease_expiry = $1, last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM tasks
+    WHERE namespace = $2 AND (state = 'received' OR (state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP))
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RequeueExpiredTasks :many
+UPDATE tasks SET state = 'received', lease_expiry = NULL, last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM tasks
+    WHERE state = 'processing' AND lease_expiry <= CURRENT_TIMESTAMP
+    ORDER BY lease_expiry
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: NotifyTasks :exec
+SELECT pg_notify('tasks', id::TEXT) FROM unnest(sqlc.arg(ids)::INT[]) AS id;
+
 -- name: UpdateTaskState :exec
 UPDATE tasks SET state = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1;
 
+-- name: MarkTaskProcessing :one
+UPDATE tasks SET state = 'processing', lease_expiry = $3, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND namespace = $2 AND state = 'received'
+RETURNING creation_time;
+
+-- name: CompleteTask :one
+UPDATE tasks SET state = 'done', result = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'processing' AND lease_expiry = $3
+RETURNING type, value, namespace;
+
+-- name: ReleaseTask :execrows
+UPDATE tasks SET state = 'received', lease_expiry = NULL, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'processing' AND lease_expiry = $2;
+
 -- name: GetTaskByID :one
-SELECT * FROM tasks WHERE id = $1;
+SELECT * FROM tasks WHERE id = $1 AND namespace = $2;
 
 -- name: GetTasksByState :many
-SELECT * FROM tasks WHERE state = $1;
\ No newline at end of file
+SELECT * FROM tasks WHERE state = $1 AND namespace = $2 ORDER BY id;
+
+-- name: IncrementTaskTypeStats :one
+INSERT INTO task_type_stats (namespace, type, count, sum, min, max)
+VALUES ($1, $2, 1, $3, $3, $3)
+ON CONFLICT (namespace, type) DO UPDATE SET count = task_type_stats.count + 1,
+                                 sum = task_type_stats.sum + EXCLUDED.sum,
+                                 min = LEAST(task_type_stats.min, EXCLUDED.min),
+                                 max = GREATEST(task_type_stats.max, EXCLUDED.max),
+                                 last_update_time = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: ListTaskTypeStats :many
+SELECT * FROM task_type_stats WHERE namespace = $1 ORDER BY type;
+
+-- name: DeleteTaskTypeStats :exec
+DELETE FROM task_type_stats WHERE namespace = $1;
+
+-- name: RebuildTaskTypeStats :exec
+INSERT INTO task_type_stats (namespace, type, count, sum, min, max)
+SELECT namespace, type, COUNT(*), SUM(value), MIN(value), MAX(value)
+FROM tasks
+WHERE namespace = $1 AND state = 'done' AND type IS NOT NULL AND value IS NOT NULL
+GROUP BY namespace, type;
+
+-- name: UpsertRateLimiter :exec
+INSERT INTO rate_limiters (name, tokens, capacity, refill_rate)
+VALUES ($1, $2, $2, $3)
+ON CONFLICT (name) DO UPDATE SET capacity = EXCLUDED.capacity,
+                                 refill_rate = EXCLUDED.refill_rate;
+
+-- name: TakeRateLimiterToken :one
+UPDATE rate_limiters
+SET tokens = LEAST(capacity, tokens + EXTRACT(EPOCH FROM (now() - last_refill_time)) * refill_rate) - 1,
+    last_refill_time = now()
+WHERE name = $1
+  AND LEAST(capacity, tokens + EXTRACT(EPOCH FROM (now() - last_refill_time)) * refill_rate) >= 1
+RETURNING tokens;
+
+-- name: CreateRecurringTask :one
+INSERT INTO recurring_tasks (name, cron_spec, type, value, enabled, catch_up, namespace)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ListRecurringTasks :many
+SELECT * FROM recurring_tasks ORDER BY name;
+
+-- name: ListDueRecurringTasks :many
+SELECT * FROM recurring_tasks
+WHERE enabled AND (next_fire_time IS NULL OR next_fire_time <= $1)
+ORDER BY id;
+
+-- name: GetRecurringTask :one
+SELECT * FROM recurring_tasks WHERE id = $1;
+
+-- name: TryLockRecurringTask :one
+SELECT pg_try_advisory_xact_lock(hashtext('recurring_tasks'), sqlc.arg(id)::INT);
+
+-- name: UpdateRecurringTaskFireTimes :exec
+UPDATE recurring_tasks SET last_fire_time = $2, next_fire_time = $3 WHERE id = $1;
+
+-- name: SetRecurringTaskEnabled :execrows
+UPDATE recurring_tasks SET enabled = $2, next_fire_time = NULL WHERE name = $1;
+
+-- name: DeleteRecurringTask :execrows
+DELETE FROM recurring_tasks WHERE name = $1;
+
+-- name: CreateWorkflow :one
+INSERT INTO workflows (name, namespace)
+VALUES ($1, $2)
+RETURNING id;
+
+-- name: GetWorkflow :one
+SELECT * FROM workflows WHERE id = $1 AND namespace = $2;
+
+-- name: CreatePendingTask :one
+INSERT INTO tasks (type, value, state, comment, workflow_id, namespace)
+VALUES ($1, $2, 'pending', $3, $4, $5)
+RETURNING id;
+
+-- name: CreateTaskDependency :exec
+INSERT INTO task_dependencies (task_id, depends_on_id)
+VALUES ($1, $2);
+
+-- name: ListWorkflowTasks :many
+SELECT * FROM tasks WHERE workflow_id = $1 ORDER BY id;
+
+-- name: ListWorkflowDependencies :many
+SELECT d.task_id, d.depends_on_id
+FROM task_dependencies d
+JOIN tasks t ON t.id = d.task_id
+WHERE t.workflow_id = $1
+ORDER BY d.task_id, d.depends_on_id;
+
+-- name: ClaimReadyTasks :many
+UPDATE tasks SET state = 'received', last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT t.id FROM tasks t
+    WHERE t.state = 'pending'
+      AND NOT EXISTS (
+          SELECT 1 FROM task_dependencies d
+          JOIN tasks p ON p.id = d.depends_on_id
+          WHERE d.task_id = t.id AND p.state <> 'done'
+      )
+    ORDER BY t.id
+    LIMIT $1
+    FOR UPDATE OF t SKIP LOCKED
+)
+RETURNING *;
+
+-- name: FailTask :execrows
+UPDATE tasks SET state = 'failed', result = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'processing' AND lease_expiry = $3;
+
+-- name: AbandonTask :execrows
+UPDATE tasks SET state = 'failed', result = $2, last_update_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'received';
+
+-- name: SkipDependentTasks :many
+WITH RECURSIVE dependents AS (
+    SELECT d.task_id FROM task_dependencies d WHERE d.depends_on_id = $1
+    UNION
+    SELECT d.task_id FROM task_dependencies d JOIN dependents ON d.depends_on_id = dependents.task_id
+)
+UPDATE tasks SET state = 'skipped', last_update_time = CURRENT_TIMESTAMP
+WHERE id IN (SELECT task_id FROM dependents) AND state = 'pending'
+RETURNING id;
+
+-- name: ListTaskEvents :many
+SELECT * FROM task_events WHERE task_id = $1 ORDER BY id;
+
+-- name: CountBacklogTasks :many
+SELECT namespace, COUNT(*) AS count
+FROM tasks
+WHERE state IN ('received', 'processing')
+GROUP BY namespace;
+
+-- name: CountNamespaceBacklog :one
+SELECT COUNT(*) FROM tasks WHERE namespace = $1 AND state IN ('received', 'processing');
+
+-- name: CreateOutboxEntry :one
+INSERT INTO task_outbox (task_id, namespace, next_attempt_time)
+VALUES ($1, $2, $3)
+RETURNING id;
+
+-- name: CreateOutboxEntries :many
+INSERT INTO task_outbox (task_id, namespace, next_attempt_time)
+SELECT t.task_id, t.namespace, sqlc.arg(next_attempt_time)::TIMESTAMPTZ
+FROM unnest(sqlc.arg(task_ids)::INT[], sqlc.arg(namespaces)::TEXT[]) AS t(task_id, namespace)
+RETURNING id, task_id;
+
+-- name: ClaimOutboxEntries :many
+UPDATE task_outbox o SET next_attempt_time = $1
+FROM tasks t
+WHERE o.id IN (
+    SELECT id FROM task_outbox
+    WHERE state = 'pending' AND next_attempt_time <= CURRENT_TIMESTAMP
+    ORDER BY next_attempt_time
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+  AND t.id = o.task_id
+RETURNING o.id, o.task_id, o.namespace, o.attempts, t.type, t.value;
+
+-- name: MarkOutboxSent :execrows
+UPDATE task_outbox SET state = 'sent', sent_time = CURRENT_TIMESTAMP WHERE id = $1 AND state = 'pending';
+
+-- name: RetryOutboxEntry :exec
+UPDATE task_outbox SET attempts = attempts + 1, last_error = $2, next_attempt_time = $3 WHERE id = $1 AND state = 'pending';
+
+-- name: MarkOutboxDead :execrows
+UPDATE task_outbox SET state = 'dead', attempts = attempts + 1, last_error = $2 WHERE id = $1 AND state = 'pending';
+
+-- name: DeleteExpiredTasks :execrows
+WITH expired AS (
+    SELECT id FROM tasks
+    WHERE state = ANY(sqlc.arg(states)::TEXT[]) AND last_update_time < sqlc.arg(cutoff)::TIMESTAMPTZ
+    ORDER BY id
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+), deleted_events AS (
+    DELETE FROM task_events WHERE task_id IN (SELECT id FROM expired)
+), deleted_outbox AS (
+    DELETE FROM task_outbox WHERE task_id IN (SELECT id FROM expired)
+), deleted_dependencies AS (
+    DELETE FROM task_dependencies
+    WHERE task_id IN (SELECT id FROM expired) OR depends_on_id IN (SELECT id FROM expired)
+)
+DELETE FROM tasks WHERE id IN (SELECT id FROM expired);
+
+-- name: ArchiveExpiredTasks :execrows
+WITH expired AS (
+    SELECT id FROM tasks
+    WHERE state = ANY(sqlc.arg(states)::TEXT[]) AND last_update_time < sqlc.arg(cutoff)::TIMESTAMPTZ
+    ORDER BY id
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+), deleted_events AS (
+    DELETE FROM task_events WHERE task_id IN (SELECT id FROM expired)
+), deleted_outbox AS (
+    DELETE FROM task_outbox WHERE task_id IN (SELECT id FROM expired)
+), deleted_dependencies AS (
+    DELETE FROM task_dependencies
+    WHERE task_id IN (SELECT id FROM expired) OR depends_on_id IN (SELECT id FROM expired)
+), archived AS (
+    DELETE FROM tasks WHERE id IN (SELECT id FROM expired)
+    RETURNING id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace
+)
+INSERT INTO tasks_archive (id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace)
+SELECT id, type, value, state, creation_time, last_update_time, comment, result, run_at, workflow_id, namespace
+FROM archived;
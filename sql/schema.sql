@@ -1,8 +1,132 @@
+CREATE TABLE workflows (
+                       id SERIAL PRIMARY KEY,
+                       name TEXT NOT NULL,
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       namespace TEXT NOT NULL DEFAULT 'default'
+);
+
 CREATE TABLE tasks (
                        id SERIAL PRIMARY KEY,
                        type INT CHECK (type >= 0 AND type <= 9),
                        value INT CHECK (value >= 0 AND value <= 99),
-                       state TEXT CHECK (state IN ('received', 'processing', 'done')),
+                       state TEXT CHECK (state IN ('pending', 'scheduled', 'received', 'processing', 'done', 'failed', 'skipped')),
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       last_update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       comment TEXT,
+                       result JSONB NOT NULL DEFAULT 'null',
+                       run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       workflow_id INT REFERENCES workflows (id),
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       lease_expiry TIMESTAMPTZ
+);
+
+CREATE INDEX tasks_scheduled_run_at_idx ON tasks (run_at) WHERE state = 'scheduled';
+CREATE INDEX tasks_workflow_id_idx ON tasks (workflow_id) WHERE workflow_id IS NOT NULL;
+CREATE INDEX tasks_pending_idx ON tasks (id) WHERE state = 'pending';
+CREATE INDEX tasks_received_idx ON tasks (id) WHERE state = 'received';
+CREATE INDEX tasks_namespace_state_idx ON tasks (namespace, state);
+CREATE INDEX tasks_state_last_update_time_idx ON tasks (state, last_update_time);
+CREATE INDEX tasks_processing_lease_expiry_idx ON tasks (lease_expiry) WHERE state = 'processing';
+
+CREATE TABLE task_dependencies (
+                       task_id INT NOT NULL,
+                       depends_on_id INT NOT NULL,
+                       PRIMARY KEY (task_id, depends_on_id),
+                       CHECK (task_id <> depends_on_id)
+);
+
+CREATE INDEX task_dependencies_depends_on_id_idx ON task_dependencies (depends_on_id);
+
+CREATE TABLE tasks_archive (
+                       id INT PRIMARY KEY,
+                       type INT,
+                       value INT,
+                       state TEXT,
+                       creation_time TIMESTAMPTZ,
+                       last_update_time TIMESTAMPTZ,
+                       comment TEXT,
+                       result JSONB NOT NULL DEFAULT 'null',
+                       run_at TIMESTAMPTZ NOT NULL,
+                       workflow_id INT,
+                       namespace TEXT NOT NULL,
+                       archive_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE task_outbox (
+                       id SERIAL PRIMARY KEY,
+                       task_id INT NOT NULL,
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'sent', 'dead')),
+                       attempts INT NOT NULL DEFAULT 0,
+                       next_attempt_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       last_error TEXT,
+                       creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       sent_time TIMESTAMPTZ
+);
+
+CREATE INDEX task_outbox_pending_idx ON task_outbox (next_attempt_time) WHERE state = 'pending';
+
+CREATE TABLE task_events (
+                       id BIGSERIAL PRIMARY KEY,
+                       task_id INT NOT NULL,
+                       old_state TEXT,
+                       new_state TEXT NOT NULL,
+                       event_time TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+                       actor TEXT NOT NULL DEFAULT '',
+                       error TEXT
+);
+
+CREATE INDEX task_events_task_id_idx ON task_events (task_id, id);
+
+CREATE OR REPLACE FUNCTION record_task_event() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.state IS DISTINCT FROM OLD.state THEN
+        INSERT INTO task_events (task_id, old_state, new_state, actor, error)
+        VALUES (
+            NEW.id,
+            CASE WHEN TG_OP = 'UPDATE' THEN OLD.state END,
+            NEW.state,
+            current_setting('application_name'),
+            CASE WHEN NEW.state = 'failed' THEN NEW.result->>'error' END
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_record_event
+    AFTER INSERT OR UPDATE OF state ON tasks
+    FOR EACH ROW EXECUTE FUNCTION record_task_event();
+
+CREATE TABLE task_type_stats (
+                       type INT CHECK (type >= 0 AND type <= 9),
+                       count BIGINT NOT NULL DEFAULT 0,
+                       sum BIGINT NOT NULL DEFAULT 0,
+                       min INT NOT NULL,
+                       max INT NOT NULL,
+                       last_update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                       namespace TEXT NOT NULL DEFAULT 'default',
+                       PRIMARY KEY (namespace, type)
+);
+
+CREATE TABLE rate_limiters (
+                       name TEXT PRIMARY KEY,
+                       tokens DOUBLE PRECISION NOT NULL,
+                       capacity DOUBLE PRECISION NOT NULL,
+                       refill_rate DOUBLE PRECISION NOT NULL,
+                       last_refill_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE recurring_tasks (
+                       id SERIAL PRIMARY KEY,
+                       name TEXT NOT NULL UNIQUE,
+                       cron_spec TEXT NOT NULL,
+                       type INT NOT NULL CHECK (type >= 0 AND type <= 9),
+                       value INT NOT NULL CHECK (value >= 0 AND value <= 99),
+                       enabled BOOLEAN NOT NULL DEFAULT TRUE,
+                       catch_up BOOLEAN NOT NULL DEFAULT FALSE,
+                       last_fire_time TIMESTAMPTZ,
+                       next_fire_time TIMESTAMPTZ,
                        creation_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-                       last_update_time TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+                       namespace TEXT NOT NULL DEFAULT 'default'
+);
@@ -0,0 +1,161 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is the position of a circuit breaker
+type State int
+
+const (
+	// Closed lets every call through and counts consecutive failures
+	Closed State = iota
+	// HalfOpen lets a single probe call through after the cooldown to test recovery
+	HalfOpen
+	// Open rejects every call until the cooldown has elapsed
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// ErrOpen is returned for calls rejected while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Options holds the tuning parameters of a Breaker
+type Options struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before allowing a probe
+	Cooldown time.Duration
+	// OnStateChange, if set, is called on every transition
+	OnStateChange func(from State, to State)
+}
+
+// Breaker is a closed/open/half-open circuit breaker
+type Breaker struct {
+	mu       sync.Mutex
+	opts     Options
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New creates a closed Breaker, filling in defaults for unset options
+func New(opts Options) *Breaker {
+	if opts.FailureThreshold < 1 {
+		opts.FailureThreshold = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Second
+	}
+	return &Breaker{opts: opts}
+}
+
+// Allow reports whether a call may proceed, returning ErrOpen if it may not.
+// Every allowed call must be followed by a Record with its outcome, or by Abandon.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.opts.Cooldown {
+			return ErrOpen
+		}
+		b.transition(HalfOpen)
+		b.probing = true
+		return nil
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a call allowed by Allow; a nil error counts as success
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		b.probing = false
+		if b.state != Closed {
+			b.transition(Closed)
+		}
+		return
+	}
+
+	b.failures++
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		b.open()
+	case Closed:
+		if b.failures >= b.opts.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// Abandon releases a call allowed by Allow without counting its outcome either way
+func (b *Breaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns the current state. An open breaker whose cooldown has elapsed is reported
+// as half-open, since the next call will be let through as a probe.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.opts.Cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// RetryAfter returns how long until an open breaker allows a probe, or zero if it is not open
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != Open {
+		return 0
+	}
+	if remaining := b.opts.Cooldown - time.Since(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	b.transition(Open)
+}
+
+func (b *Breaker) transition(to State) {
+	from := b.state
+	b.state = to
+	if b.opts.OnStateChange != nil && from != to {
+		b.opts.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,144 @@
+package breaker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestBreakerOpensAfterThreshold ensures consecutive failures open the breaker
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	var transitions []State
+	b := New(Options{
+		FailureThreshold: 2,
+		Cooldown:         time.Hour,
+		OnStateChange:    func(from State, to State) { transitions = append(transitions, to) },
+	})
+
+	assert.NoError(t, b.Allow())
+	b.Record(errors.New("boom"))
+	assert.Equal(t, Closed, b.State())
+
+	assert.NoError(t, b.Allow())
+	b.Record(errors.New("boom"))
+	assert.Equal(t, Open, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+	assert.Greater(t, b.RetryAfter(), time.Duration(0))
+	assert.Equal(t, []State{Open}, transitions)
+}
+
+// TestBreakerHalfOpenProbe ensures a single probe is allowed after the cooldown and closes the breaker on success
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b := New(Options{FailureThreshold: 1, Cooldown: time.Millisecond})
+
+	assert.NoError(t, b.Allow())
+	b.Record(errors.New("boom"))
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, HalfOpen, b.State())
+
+	// Only one probe is let through while half-open
+	assert.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+
+	b.Record(nil)
+	assert.Equal(t, Closed, b.State())
+	assert.NoError(t, b.Allow())
+}
+
+// TestBreakerHalfOpenFailureReopens ensures a failed probe opens the breaker again
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := New(Options{FailureThreshold: 1, Cooldown: 20 * time.Millisecond})
+
+	assert.NoError(t, b.Allow())
+	b.Record(errors.New("boom"))
+	time.Sleep(25 * time.Millisecond)
+
+	assert.NoError(t, b.Allow())
+	b.Record(errors.New("still down"))
+	assert.Equal(t, Open, b.State())
+}
+
+// TestDBShortCircuitsWhileOpen ensures the wrapped DB stops reaching the database once open
+func TestDBShortCircuitsWhileOpen(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	b := New(Options{FailureThreshold: 1, Cooldown: time.Hour})
+	wrapped := NewDB(db, b)
+	ctx := context.Background()
+
+	// A missing row is not a failure
+	mock.ExpectQuery("SELECT id FROM tasks").WillReturnError(sql.ErrNoRows)
+	var id int32
+	assert.ErrorIs(t, wrapped.QueryRowContext(ctx, "SELECT id FROM tasks").Scan(&id), sql.ErrNoRows)
+	assert.Equal(t, Closed, b.State())
+
+	mock.ExpectExec("UPDATE tasks").WillReturnError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	_, err = wrapped.ExecContext(ctx, "UPDATE tasks SET state = 'done'")
+	assert.Error(t, err)
+	assert.Equal(t, Open, b.State())
+
+	// No further expectations: these calls must not reach the mock
+	_, err = wrapped.ExecContext(ctx, "UPDATE tasks SET state = 'done'")
+	assert.ErrorIs(t, err, ErrOpen)
+	_, err = wrapped.BeginTx(ctx, nil)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.ErrorIs(t, wrapped.QueryRowContext(ctx, "SELECT id FROM tasks").Scan(&id), ErrOpen)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDBCountsOnlyUnavailability ensures errors the database answered with leave the breaker closed,
+// while connection and timeout errors open it
+func TestDBCountsOnlyUnavailability(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	ctx := context.Background()
+	for _, answered := range []error{
+		&pq.Error{Code: "23505"}, // unique violation
+		&pq.Error{Code: "23514"}, // check violation
+		&pq.Error{Code: "42601"}, // syntax error
+		errors.New("invalid task"),
+	} {
+		b := New(Options{FailureThreshold: 1, Cooldown: time.Hour})
+		mock.ExpectExec("INSERT INTO tasks").WillReturnError(answered)
+		_, err := NewDB(db, b).ExecContext(ctx, "INSERT INTO tasks DEFAULT VALUES")
+		assert.Error(t, err)
+		assert.Equal(t, Closed, b.State(), answered.Error())
+	}
+
+	for _, unreachable := range []error{
+		&pq.Error{Code: "08006"}, // connection failure
+		&pq.Error{Code: "57P01"}, // admin shutdown
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		context.DeadlineExceeded,
+		io.ErrUnexpectedEOF,
+	} {
+		b := New(Options{FailureThreshold: 1, Cooldown: time.Hour})
+		mock.ExpectExec("INSERT INTO tasks").WillReturnError(unreachable)
+		_, err := NewDB(db, b).ExecContext(ctx, "INSERT INTO tasks DEFAULT VALUES")
+		assert.Error(t, err)
+		assert.Equal(t, Open, b.State(), unreachable.Error())
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
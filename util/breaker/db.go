@@ -0,0 +1,128 @@
+package breaker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/lib/pq"
+	"io"
+	"net"
+	"strings"
+)
+
+// DB wraps a *sql.DB so every call goes through a Breaker. It satisfies persistence.DBTX
+// and can also begin transactions; statements run inside a transaction are not tracked.
+type DB struct {
+	db      *sql.DB
+	breaker *Breaker
+}
+
+// NewDB wraps db with the given breaker
+func NewDB(db *sql.DB, breaker *Breaker) *DB {
+	return &DB{db: db, breaker: breaker}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	res, err := d.db.ExecContext(ctx, query, args...)
+	d.record(ctx, err)
+	return res, err
+}
+
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	stmt, err := d.db.PrepareContext(ctx, query)
+	d.record(ctx, err)
+	return stmt, err
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	d.record(ctx, err)
+	return rows, err
+}
+
+// QueryRowContext cannot return ErrOpen directly, as *sql.Row carries no settable error.
+// While the breaker is open the query is issued on rejectedDB instead, so the row fails
+// with ErrOpen without reaching the database.
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if d.breaker.Allow() != nil {
+		return rejectedDB.QueryRowContext(ctx, query, args...)
+	}
+	row := d.db.QueryRowContext(ctx, query, args...)
+	d.record(ctx, row.Err())
+	return row
+}
+
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	tx, err := d.db.BeginTx(ctx, opts)
+	d.record(ctx, err)
+	return tx, err
+}
+
+// record reports the outcome of a call. A call abandoned by its caller says nothing about database
+// health, and neither does an error the database answered with, such as a missing row, a violated
+// constraint or bad SQL: only errors that show the database unreachable or too slow are failures.
+func (d *DB) record(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		d.breaker.Abandon()
+		return
+	}
+	if !unavailable(err) {
+		err = nil
+	}
+	d.breaker.Record(err)
+}
+
+// unavailable reports whether err shows the database unreachable or timing out: a broken connection,
+// a network error, a deadline, or a Postgres connection exception (class 08) or shutdown (57P)
+func unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Class() == "08" || strings.HasPrefix(string(pqErr.Code), "57P")
+	}
+	return false
+}
+
+// rejectedDB fails every statement with ErrOpen, as none of its connections can be opened
+var rejectedDB = sql.OpenDB(rejectingConnector{})
+
+// rejectingConnector refuses every connection with ErrOpen
+type rejectingConnector struct{}
+
+func (rejectingConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrOpen
+}
+
+func (rejectingConnector) Driver() driver.Driver {
+	return rejectingDriver{}
+}
+
+// rejectingDriver is the driver of rejectingConnector
+type rejectingDriver struct{}
+
+func (rejectingDriver) Open(string) (driver.Conn, error) {
+	return nil, ErrOpen
+}
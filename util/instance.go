@@ -0,0 +1,16 @@
+package util
+
+import (
+	"fmt"
+	"os"
+)
+
+// InstanceName identifies a running service as "service@hostname", e.g. as the application_name of its
+// database connections, which task_events records as the actor of every task transition
+func InstanceName(service string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s@%s", service, hostname)
+}
@@ -0,0 +1,163 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Algorithm selects how the adaptive limiter reacts to latency samples
+type Algorithm string
+
+const (
+	// AIMD grows the limit additively while latency stays under target and backs off multiplicatively otherwise
+	AIMD Algorithm = "aimd"
+	// Gradient scales the limit by the ratio between the best observed latency and the latest sample
+	Gradient Algorithm = "gradient"
+)
+
+// gradientSmoothing weighs each new gradient estimate against the current limit
+const gradientSmoothing = 0.2
+
+// AdaptiveOptions holds the tuning parameters of an Adaptive limiter
+type AdaptiveOptions struct {
+	Algorithm     Algorithm
+	InitialLimit  int
+	MinLimit      int
+	MaxLimit      int
+	TargetLatency time.Duration
+	BackoffRatio  float64
+	// OnLimitChange, if set, is called with the new limit whenever it changes
+	OnLimitChange func(limit int)
+}
+
+// Adaptive is a concurrency limiter whose limit follows the latency observed by its callers
+type Adaptive struct {
+	mu         sync.Mutex
+	opts       AdaptiveOptions
+	limit      float64
+	inFlight   int
+	minLatency time.Duration
+}
+
+// NewAdaptive creates an Adaptive limiter, filling in defaults for unset options
+func NewAdaptive(opts AdaptiveOptions) *Adaptive {
+	if opts.Algorithm == "" {
+		opts.Algorithm = AIMD
+	}
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = opts.MinLimit
+	}
+	if opts.InitialLimit < opts.MinLimit {
+		opts.InitialLimit = opts.MinLimit
+	}
+	if opts.InitialLimit > opts.MaxLimit {
+		opts.InitialLimit = opts.MaxLimit
+	}
+	if opts.BackoffRatio <= 0 || opts.BackoffRatio >= 1 {
+		opts.BackoffRatio = 0.9
+	}
+
+	l := &Adaptive{
+		opts:  opts,
+		limit: float64(opts.InitialLimit),
+	}
+	l.notify()
+	return l
+}
+
+// Acquire reserves a slot for a unit of work, returning false if the limit has been reached
+func (l *Adaptive) Acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Release frees a slot acquired with Acquire and adjusts the limit from the observed latency.
+// Failed work is treated as a congestion signal regardless of its latency.
+func (l *Adaptive) Release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+
+	previous := int(l.limit)
+	switch l.opts.Algorithm {
+	case Gradient:
+		l.updateGradient(latency, failed)
+	default:
+		l.updateAIMD(latency, failed, inFlight)
+	}
+	l.limit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), l.limit))
+
+	if int(l.limit) != previous {
+		l.notify()
+	}
+}
+
+// Cancel frees a slot acquired with Acquire for work that never ran, leaving the limit as it is
+func (l *Adaptive) Cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+}
+
+// Limit returns the current concurrency limit
+func (l *Adaptive) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of slots currently held
+func (l *Adaptive) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// updateAIMD only grows the limit when it is actually being used, so an idle
+// service does not accumulate headroom it has never proven it can handle
+func (l *Adaptive) updateAIMD(latency time.Duration, failed bool, inFlight int) {
+	if failed || (l.opts.TargetLatency > 0 && latency > l.opts.TargetLatency) {
+		l.limit *= l.opts.BackoffRatio
+		return
+	}
+	if float64(inFlight)*2 >= l.limit {
+		l.limit++
+	}
+}
+
+// updateGradient tracks the best latency seen as the no-load baseline and moves the limit
+// towards limit*baseline/sample, plus a sqrt(limit) queue allowance so it can keep probing upwards
+func (l *Adaptive) updateGradient(latency time.Duration, failed bool) {
+	if failed {
+		l.limit *= l.opts.BackoffRatio
+		return
+	}
+	if latency <= 0 {
+		return
+	}
+	if l.minLatency == 0 || latency < l.minLatency {
+		l.minLatency = latency
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, float64(l.minLatency)/float64(latency)))
+	target := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-gradientSmoothing) + target*gradientSmoothing
+}
+
+func (l *Adaptive) notify() {
+	if l.opts.OnLimitChange != nil {
+		l.opts.OnLimitChange(int(l.limit))
+	}
+}
@@ -0,0 +1,83 @@
+package limiter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestAdaptiveRejectsOverLimit ensures work beyond the current limit is rejected
+func TestAdaptiveRejectsOverLimit(t *testing.T) {
+	l := NewAdaptive(AdaptiveOptions{InitialLimit: 2, MinLimit: 1, MaxLimit: 10})
+
+	assert.True(t, l.Acquire())
+	assert.True(t, l.Acquire())
+	assert.False(t, l.Acquire())
+	assert.Equal(t, 2, l.InFlight())
+}
+
+// TestAdaptiveAIMD ensures the limit grows under target latency and backs off above it
+func TestAdaptiveAIMD(t *testing.T) {
+	var reported int
+	l := NewAdaptive(AdaptiveOptions{
+		Algorithm:     AIMD,
+		InitialLimit:  4,
+		MinLimit:      1,
+		MaxLimit:      10,
+		TargetLatency: 100 * time.Millisecond,
+		BackoffRatio:  0.5,
+		OnLimitChange: func(limit int) { reported = limit },
+	})
+
+	// Fill the limiter so it is fully utilised, then complete quickly
+	for i := 0; i < 4; i++ {
+		assert.True(t, l.Acquire())
+	}
+	l.Release(10*time.Millisecond, false)
+	assert.Equal(t, 5, l.Limit())
+	assert.Equal(t, 5, reported)
+
+	// A slow sample halves the limit
+	l.Release(200*time.Millisecond, false)
+	assert.Equal(t, 2, l.Limit())
+
+	// Failures back off down to the minimum but never below it
+	l.Release(time.Millisecond, true)
+	l.Release(time.Millisecond, true)
+	assert.Equal(t, 1, l.Limit())
+	assert.Equal(t, 1, reported)
+}
+
+// TestAdaptiveGradient ensures the limit shrinks as latency rises above the baseline
+func TestAdaptiveGradient(t *testing.T) {
+	l := NewAdaptive(AdaptiveOptions{
+		Algorithm:    Gradient,
+		InitialLimit: 20,
+		MinLimit:     1,
+		MaxLimit:     100,
+	})
+
+	// Establish a baseline, then report latencies well above it
+	assert.True(t, l.Acquire())
+	l.Release(10*time.Millisecond, false)
+	grown := l.Limit()
+	assert.GreaterOrEqual(t, grown, 20)
+
+	for i := 0; i < 20; i++ {
+		assert.True(t, l.Acquire())
+		l.Release(100*time.Millisecond, false)
+	}
+	assert.Less(t, l.Limit(), grown)
+}
+
+// TestAdaptiveCancel ensures a cancelled slot is freed without moving the limit
+func TestAdaptiveCancel(t *testing.T) {
+	l := NewAdaptive(AdaptiveOptions{InitialLimit: 1, MinLimit: 1, MaxLimit: 10})
+
+	assert.True(t, l.Acquire())
+	assert.False(t, l.Acquire())
+	l.Cancel()
+	assert.Equal(t, 0, l.InFlight())
+	assert.Equal(t, 1, l.Limit())
+	assert.True(t, l.Acquire())
+}
@@ -0,0 +1,164 @@
+package limiter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"grpc-in-go/persistence"
+	"grpc-in-go/util/logger"
+)
+
+// fallbackPeriod is how long the local limiter is used after the DB fails before it is tried again
+const fallbackPeriod = 5 * time.Second
+
+// SharedOptions holds the parameters of a Shared limiter
+type SharedOptions struct {
+	// Name identifies the token bucket row, so every replica using the same name shares one budget
+	Name           string
+	TasksPerSecond float64
+	Burst          int
+	// Replicas is how many replicas share the bucket. While the DB is unavailable each replica limits
+	// itself to its share of the budget; with 0 or 1 each one takes the whole budget, so N replicas
+	// admit up to N times TasksPerSecond until the DB is back.
+	Replicas int
+	// OnFallback, if set, is called when the limiter switches to or from its local fallback
+	OnFallback func(active bool)
+}
+
+// Shared is a token bucket stored in Postgres and shared by every replica that uses the same name.
+// While the DB is unavailable it falls back to a process-local limiter with this replica's share of the rate.
+type Shared struct {
+	queries  *persistence.Queries
+	opts     SharedOptions
+	fallback *rate.Limiter
+	interval time.Duration
+
+	mu            sync.Mutex
+	fallbackUntil time.Time
+	initialized   bool
+}
+
+// NewShared creates a Shared limiter and registers its bucket. A DB failure here is not fatal:
+// the limiter starts on its local fallback and registers the bucket once the DB is reachable.
+func NewShared(ctx context.Context, queries *persistence.Queries, opts SharedOptions) (*Shared, error) {
+	if opts.TasksPerSecond <= 0 {
+		return nil, fmt.Errorf("shared rate limiter %q: tasks per second must be positive, got %v", opts.Name, opts.TasksPerSecond)
+	}
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+
+	replicas := opts.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	fallbackBurst := opts.Burst / replicas
+	if fallbackBurst < 1 {
+		fallbackBurst = 1
+	}
+
+	s := &Shared{
+		queries:  queries,
+		opts:     opts,
+		fallback: rate.NewLimiter(rate.Limit(opts.TasksPerSecond/float64(replicas)), fallbackBurst),
+		interval: time.Duration(float64(time.Second) / opts.TasksPerSecond),
+	}
+	if err := s.ensureBucket(ctx); err != nil {
+		s.startFallback(err)
+	}
+	return s, nil
+}
+
+// Wait blocks until a token is available in the shared bucket or ctx is done
+func (s *Shared) Wait(ctx context.Context) error {
+	for {
+		if s.inFallback() {
+			return s.fallback.Wait(ctx)
+		}
+
+		err := s.ensureBucket(ctx)
+		if err == nil {
+			_, err = s.queries.TakeRateLimiterToken(ctx, s.opts.Name)
+		}
+
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, sql.ErrNoRows):
+			// The bucket is empty: wait roughly one refill interval before trying again
+			timer := time.NewTimer(s.interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		case ctx.Err() != nil:
+			return ctx.Err()
+		default:
+			s.startFallback(err)
+		}
+	}
+}
+
+// ensureBucket registers the bucket row once, updating its capacity and rate to the configured values
+func (s *Shared) ensureBucket(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.initialized {
+		return nil
+	}
+	err := s.queries.UpsertRateLimiter(ctx, persistence.UpsertRateLimiterParams{
+		Name:       s.opts.Name,
+		Tokens:     float64(s.opts.Burst),
+		RefillRate: s.opts.TasksPerSecond,
+	})
+	if err != nil {
+		return err
+	}
+	s.initialized = true
+	return nil
+}
+
+func (s *Shared) inFallback() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fallbackUntil.IsZero() {
+		return false
+	}
+	if time.Now().Before(s.fallbackUntil) {
+		return true
+	}
+
+	// The fallback period is over: retry the DB, re-registering the bucket in case it was lost
+	s.fallbackUntil = time.Time{}
+	s.initialized = false
+	logger.LogInfo("Retrying shared rate limiter", &logger.LogContext{
+		"name": s.opts.Name,
+	})
+	if s.opts.OnFallback != nil {
+		s.opts.OnFallback(false)
+	}
+	return false
+}
+
+func (s *Shared) startFallback(cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallbackUntil = time.Now().Add(fallbackPeriod)
+	logger.LogError("Shared rate limiter unavailable, falling back to local limiter", cause, &logger.LogContext{
+		"name":           s.opts.Name,
+		"fallback_until": s.fallbackUntil,
+	})
+	if s.opts.OnFallback != nil {
+		s.opts.OnFallback(true)
+	}
+}
@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+	"grpc-in-go/persistence"
+	"testing"
+)
+
+// TestSharedTakesTokenFromDB ensures tokens are taken from the shared bucket
+func TestSharedTakesTokenFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	mock.ExpectExec("INSERT INTO rate_limiters").
+		WithArgs("consumer", float64(1), float64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE rate_limiters").
+		WithArgs("consumer").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(0.0))
+
+	l, err := NewShared(context.Background(), persistence.New(db), SharedOptions{Name: "consumer", TasksPerSecond: 5})
+	assert.NoError(t, err)
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSharedWaitsForRefill ensures an empty bucket is retried rather than treated as a failure
+func TestSharedWaitsForRefill(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	mock.ExpectExec("INSERT INTO rate_limiters").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE rate_limiters").WillReturnRows(sqlmock.NewRows([]string{"tokens"}))
+	mock.ExpectQuery("UPDATE rate_limiters").WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(0.0))
+
+	var fellBack bool
+	l, err := NewShared(context.Background(), persistence.New(db), SharedOptions{
+		Name:           "consumer",
+		TasksPerSecond: 1000,
+		OnFallback:     func(active bool) { fellBack = active },
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.False(t, fellBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSharedFallsBackWhenDBUnavailable ensures the local limiter takes over on DB errors
+func TestSharedFallsBackWhenDBUnavailable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	mock.ExpectExec("INSERT INTO rate_limiters").WillReturnError(errors.New("connection refused"))
+
+	var fellBack bool
+	l, err := NewShared(context.Background(), persistence.New(db), SharedOptions{
+		Name:           "consumer",
+		TasksPerSecond: 1000,
+		OnFallback:     func(active bool) { fellBack = active },
+	})
+	assert.NoError(t, err)
+	assert.True(t, fellBack)
+
+	// No further DB calls are expected while the fallback is active
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSharedRejectsNonPositiveRate ensures a limiter that could never hand out a token is not created
+func TestSharedRejectsNonPositiveRate(t *testing.T) {
+	for _, tasksPerSecond := range []float64{0, -1} {
+		_, err := NewShared(context.Background(), nil, SharedOptions{Name: "consumer", TasksPerSecond: tasksPerSecond})
+		assert.Error(t, err)
+	}
+}
+
+// TestSharedFallbackSplitsBudget ensures each replica falls back to its share of the budget
+func TestSharedFallbackSplitsBudget(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+
+		}
+	}(db)
+
+	mock.ExpectExec("INSERT INTO rate_limiters").WillReturnError(errors.New("connection refused"))
+
+	l, err := NewShared(context.Background(), persistence.New(db), SharedOptions{
+		Name:           "consumer",
+		TasksPerSecond: 90,
+		Burst:          9,
+		Replicas:       3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, rate.Limit(30), l.fallback.Limit())
+	assert.Equal(t, 3, l.fallback.Burst())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}